@@ -0,0 +1,441 @@
+package godiff
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// ArchiveFormat is the format of an archive diffed entry by entry
+type ArchiveFormat int
+
+const (
+	ArchiveTar ArchiveFormat = iota
+	ArchiveZip
+)
+
+func (f ArchiveFormat) String() string {
+	switch f {
+	case ArchiveTar:
+		return "tar"
+	case ArchiveZip:
+		return "zip"
+	default:
+		return ""
+	}
+}
+
+// ArchiveChangeType tells whether an entry of the updated archive was added, modified, or is unchanged
+type ArchiveChangeType int
+
+const (
+	ArchiveEntryUnchanged ArchiveChangeType = iota
+	ArchiveEntryAdded
+	ArchiveEntryModified
+)
+
+func (t ArchiveChangeType) String() string {
+	switch t {
+	case ArchiveEntryUnchanged:
+		return "Unchanged"
+	case ArchiveEntryAdded:
+		return "Added"
+	case ArchiveEntryModified:
+		return "Modified"
+	default:
+		return ""
+	}
+}
+
+// ArchiveDiff contains the differences between 2 archives, entry by entry: the contents of the updated archive's
+// entries are diffed from the contents of the original entries with the same names
+type ArchiveDiff struct {
+	Format  ArchiveFormat
+	Entries []*ArchiveEntryDiff // Entries of the updated archive, in order
+	Removed []string            // Names of the original entries missing from the updated archive
+	Trailer []byte              // Raw end of the updated tar after the last entry, or comment of the updated zip
+}
+
+// ArchiveEntryDiff is an entry of the updated archive, with the differences of its contents
+type ArchiveEntryDiff struct {
+	Name      string
+	Type      ArchiveChangeType
+	Original  int             // Index of the original entry the contents are diffed from, -1 if added
+	Size      int64           // Size of the updated contents
+	Header    []byte          // Raw bytes of the updated tar before the entry's contents: the previous entry's padding, and the entry's header blocks
+	ZipHeader *zip.FileHeader // Header of the updated zip entry
+	Diffs     []*Diff         // Differences from the original contents (as provided by CalcDiffs)
+}
+
+// DiffTar provides the differences between 2 tar archives, entry by entry. Headers scramble the chunks of whole
+// archives, while the entries' contents are chunked on their own. The updated archive can be rebuilt byte for byte
+// with PatchTar.
+func DiffTar(original, updated io.ReaderAt, cfg *Config) (*ArchiveDiff, error) {
+	cfg, err := cfg.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	originalEntries, _, err := readTarEntries(original)
+	if err != nil {
+		return nil, fmt.Errorf("error reading original tar: %w", err)
+	}
+	updatedEntries, trailer, err := readTarEntries(updated)
+	if err != nil {
+		return nil, fmt.Errorf("error reading updated tar: %w", err)
+	}
+
+	diff := &ArchiveDiff{Format: ArchiveTar, Trailer: trailer}
+	matches := matchArchiveEntries(tarEntryNames(originalEntries), tarEntryNames(updatedEntries))
+	for i, entry := range updatedEntries {
+		o := matches[i]
+		entryDiff := &ArchiveEntryDiff{Name: entry.header.Name, Original: o, Size: entry.size, Header: entry.raw}
+
+		originalData := io.NewSectionReader(original, 0, 0)
+		if o >= 0 {
+			originalData = io.NewSectionReader(original, originalEntries[o].offset, originalEntries[o].size)
+		}
+		if entryDiff.Diffs, err = CalcDiffsWithConfig(originalData, io.NewSectionReader(updated, entry.offset, entry.size), cfg); err != nil {
+			return nil, fmt.Errorf("error diffing tar entry %q: %w", entry.header.Name, err)
+		}
+
+		switch {
+		case o < 0:
+			entryDiff.Type = ArchiveEntryAdded
+		case len(entryDiff.Diffs) > 0 || !reflect.DeepEqual(originalEntries[o].header, entry.header):
+			entryDiff.Type = ArchiveEntryModified
+		}
+		diff.Entries = append(diff.Entries, entryDiff)
+	}
+	diff.Removed = removedArchiveEntries(tarEntryNames(originalEntries), matches)
+	return diff, nil
+}
+
+// PatchTar writes the updated tar archive, byte for byte, from the original one and the differences provided by
+// DiffTar
+func PatchTar(original io.ReaderAt, diff *ArchiveDiff, w io.Writer) error {
+	if diff.Format != ArchiveTar {
+		return fmt.Errorf("%s archive diff, expected tar: %w", diff.Format, ErrInvalidDiffs)
+	}
+	originalEntries, _, err := readTarEntries(original)
+	if err != nil {
+		return fmt.Errorf("error reading original tar: %w", err)
+	}
+
+	for _, entry := range diff.Entries {
+		if _, err = w.Write(entry.Header); err != nil {
+			return fmt.Errorf("error writing tar entry %q header: %w", entry.Name, err)
+		}
+
+		if entry.Original < -1 || entry.Original >= len(originalEntries) {
+			return fmt.Errorf("tar entry %q is diffed from original entry #%d, out of %d: %w", entry.Name, entry.Original, len(originalEntries), ErrInvalidDiffs)
+		}
+		originalData := io.NewSectionReader(original, 0, 0)
+		if entry.Original >= 0 {
+			e := originalEntries[entry.Original]
+			originalData = io.NewSectionReader(original, e.offset, e.size)
+		}
+		if err = Patch(originalData, entry.Diffs, w); err != nil {
+			return fmt.Errorf("error patching tar entry %q: %w", entry.Name, err)
+		}
+	}
+
+	if _, err = w.Write(diff.Trailer); err != nil {
+		return fmt.Errorf("error writing tar trailer: %w", err)
+	}
+	return nil
+}
+
+// DiffZip provides the differences between 2 zip archives, entry by entry. Compression scrambles the chunks of
+// whole archives, while the entries' decompressed contents are chunked on their own (in memory, one entry at a
+// time). An equivalent updated archive, with the same entries and contents, can be rebuilt with PatchZip.
+func DiffZip(original io.ReaderAt, originalSize int64, updated io.ReaderAt, updatedSize int64, cfg *Config) (*ArchiveDiff, error) {
+	cfg, err := cfg.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	originalZip, err := zip.NewReader(original, originalSize)
+	if err != nil {
+		return nil, fmt.Errorf("error reading original zip (%s): %w", err, ErrInvalidFormat)
+	}
+	updatedZip, err := zip.NewReader(updated, updatedSize)
+	if err != nil {
+		return nil, fmt.Errorf("error reading updated zip (%s): %w", err, ErrInvalidFormat)
+	}
+
+	diff := &ArchiveDiff{Format: ArchiveZip, Trailer: []byte(updatedZip.Comment)}
+	matches := matchArchiveEntries(zipEntryNames(originalZip), zipEntryNames(updatedZip))
+	for i, f := range updatedZip.File {
+		o := matches[i]
+		header := f.FileHeader
+		entryDiff := &ArchiveEntryDiff{Name: f.Name, Original: o, ZipHeader: &header}
+
+		var originalData []byte
+		if o >= 0 {
+			if originalData, err = readZipEntry(originalZip.File[o]); err != nil {
+				return nil, fmt.Errorf("error reading original zip entry %q: %w", originalZip.File[o].Name, err)
+			}
+		}
+		updatedData, err := readZipEntry(f)
+		if err != nil {
+			return nil, fmt.Errorf("error reading updated zip entry %q: %w", f.Name, err)
+		}
+		entryDiff.Size = int64(len(updatedData))
+
+		if entryDiff.Diffs, err = CalcDiffsWithConfig(bytes.NewReader(originalData), bytes.NewReader(updatedData), cfg); err != nil {
+			return nil, fmt.Errorf("error diffing zip entry %q: %w", f.Name, err)
+		}
+
+		switch {
+		case o < 0:
+			entryDiff.Type = ArchiveEntryAdded
+		case len(entryDiff.Diffs) > 0 || !sameZipHeader(&originalZip.File[o].FileHeader, &header):
+			entryDiff.Type = ArchiveEntryModified
+		}
+		diff.Entries = append(diff.Entries, entryDiff)
+	}
+	diff.Removed = removedArchiveEntries(zipEntryNames(originalZip), matches)
+	return diff, nil
+}
+
+// PatchZip writes an updated zip archive from the original one and the differences provided by DiffZip. Its
+// entries have the updated headers and contents, but they're compressed again, so the archive isn't byte for byte
+// the updated one.
+func PatchZip(original io.ReaderAt, originalSize int64, diff *ArchiveDiff, w io.Writer) error {
+	if diff.Format != ArchiveZip {
+		return fmt.Errorf("%s archive diff, expected zip: %w", diff.Format, ErrInvalidDiffs)
+	}
+	originalZip, err := zip.NewReader(original, originalSize)
+	if err != nil {
+		return fmt.Errorf("error reading original zip (%s): %w", err, ErrInvalidFormat)
+	}
+
+	zw := zip.NewWriter(w)
+	for _, entry := range diff.Entries {
+		if entry.ZipHeader == nil {
+			return fmt.Errorf("zip entry %q has no header: %w", entry.Name, ErrInvalidDiffs)
+		}
+		if entry.Original < -1 || entry.Original >= len(originalZip.File) {
+			return fmt.Errorf("zip entry %q is diffed from original entry #%d, out of %d: %w", entry.Name, entry.Original, len(originalZip.File), ErrInvalidDiffs)
+		}
+
+		var originalData []byte
+		if entry.Original >= 0 {
+			if originalData, err = readZipEntry(originalZip.File[entry.Original]); err != nil {
+				return fmt.Errorf("error reading original zip entry %q: %w", originalZip.File[entry.Original].Name, err)
+			}
+		}
+
+		// The sizes and checksum are calculated again by the writer, along with their extra fields
+		header := *entry.ZipHeader
+		header.Extra = zipExtraWithout(header.Extra, zipExtendedTimestampID, zipZip64ID)
+		fw, err := zw.CreateHeader(&header)
+		if err != nil {
+			return fmt.Errorf("error writing zip entry %q header: %w", entry.Name, err)
+		}
+		if err = Patch(bytes.NewReader(originalData), entry.Diffs, fw); err != nil {
+			return fmt.Errorf("error patching zip entry %q: %w", entry.Name, err)
+		}
+	}
+
+	if err = zw.SetComment(string(diff.Trailer)); err != nil {
+		return fmt.Errorf("error writing zip comment: %w", err)
+	}
+	if err = zw.Close(); err != nil {
+		return fmt.Errorf("error writing zip: %w", err)
+	}
+	return nil
+}
+
+// tarEntry is an entry of a tar archive, whose contents are at [offset, offset+size) in the archive
+type tarEntry struct {
+	header *tar.Header
+	raw    []byte // Raw bytes since the previous entry's contents
+	offset int64
+	size   int64
+}
+
+// readTarEntries reads the entries of the tar archive, and the raw end of the archive after the last entry
+func readTarEntries(data io.ReaderAt) ([]*tarEntry, []byte, error) {
+	// The offsets are counted from what the tar reader read, it reads the headers block by block
+	counter := &countingReader{r: io.NewSectionReader(data, 0, 1<<62)}
+	tr := tar.NewReader(counter)
+
+	var (
+		entries []*tarEntry
+		end     int64 // End of the previous entry's contents
+	)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid header (%s): %w", err, ErrInvalidFormat)
+		}
+		if isSparseTarEntry(header) {
+			return nil, nil, fmt.Errorf("sparse entry %q isn't supported: %w", header.Name, ErrInvalidFormat)
+		}
+
+		entry := &tarEntry{header: header, offset: counter.n, size: tarContentSize(header)}
+		if entry.raw, err = readOriginal(data, end, entry.offset-end); err != nil {
+			return nil, nil, fmt.Errorf("error reading header of %q: %w", header.Name, err)
+		}
+		entries = append(entries, entry)
+		end = entry.offset + entry.size
+	}
+
+	trailer, err := io.ReadAll(io.NewSectionReader(data, end, 1<<62))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading end of archive: %w", err)
+	}
+	return entries, trailer, nil
+}
+
+// tarContentSize provides the size of the entry's contents in the archive: none for the entries made of a header
+// only, whatever their size says
+func tarContentSize(header *tar.Header) int64 {
+	switch header.Typeflag {
+	case tar.TypeLink, tar.TypeSymlink, tar.TypeChar, tar.TypeBlock, tar.TypeDir, tar.TypeFifo:
+		return 0
+	default:
+		return header.Size
+	}
+}
+
+// isSparseTarEntry tells whether the entry's contents are stored with holes, so that its size in the archive isn't
+// the size of its contents
+func isSparseTarEntry(header *tar.Header) bool {
+	if header.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for key := range header.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
+
+func tarEntryNames(entries []*tarEntry) []string {
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.header.Name
+	}
+	return names
+}
+
+func zipEntryNames(r *zip.Reader) []string {
+	names := make([]string, len(r.File))
+	for i, f := range r.File {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// matchArchiveEntries provides the index of the original entry matching each updated entry, or -1. Entries match
+// by name, the entries with the same name matching in order.
+func matchArchiveEntries(original, updated []string) []int {
+	indexes := make(map[string][]int, len(original))
+	for i, name := range original {
+		indexes[name] = append(indexes[name], i)
+	}
+
+	matches := make([]int, len(updated))
+	for i, name := range updated {
+		matches[i] = -1
+		if candidates := indexes[name]; len(candidates) > 0 {
+			matches[i], indexes[name] = candidates[0], candidates[1:]
+		}
+	}
+	return matches
+}
+
+func removedArchiveEntries(original []string, matches []int) []string {
+	matched := make([]bool, len(original))
+	for _, o := range matches {
+		if o >= 0 {
+			matched[o] = true
+		}
+	}
+
+	var removed []string
+	for i, name := range original {
+		if !matched[i] {
+			removed = append(removed, name)
+		}
+	}
+	return removed
+}
+
+func readZipEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("error opening entry (%s): %w", err, ErrInvalidFormat)
+	}
+	defer rc.Close()
+
+	if f.UncompressedSize64 > 1<<62 {
+		return nil, fmt.Errorf("entry size %d is too big: %w", f.UncompressedSize64, ErrInvalidFormat)
+	}
+	// The size is checked while decompressing, so that a zip bomb can't take all the memory
+	data, err := io.ReadAll(io.LimitReader(rc, int64(f.UncompressedSize64)+1))
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing entry (%s): %w", err, ErrInvalidFormat)
+	}
+	if uint64(len(data)) > f.UncompressedSize64 {
+		return nil, fmt.Errorf("entry decompresses to more than its %d bytes: %w", f.UncompressedSize64, ErrInvalidFormat)
+	}
+	return data, nil
+}
+
+// IDs of the extra fields written by zip.Writer from the header
+const (
+	zipZip64ID             = 0x0001
+	zipExtendedTimestampID = 0x5455
+)
+
+// zipExtraWithout provides the extra fields without the ones of the given IDs. Malformed fields are kept as they are.
+func zipExtraWithout(extra []byte, ids ...uint16) []byte {
+	var kept []byte
+	for len(extra) >= 4 {
+		id, size := binary.LittleEndian.Uint16(extra), int(binary.LittleEndian.Uint16(extra[2:]))
+		if 4+size > len(extra) {
+			break
+		}
+		field := extra[:4+size]
+		extra = extra[4+size:]
+		removed := false
+		for _, removedID := range ids {
+			removed = removed || id == removedID
+		}
+		if !removed {
+			kept = append(kept, field...)
+		}
+	}
+	return append(kept, extra...)
+}
+
+// sameZipHeader tells whether the zip headers have the same metadata, the sizes and checksums aside
+func sameZipHeader(a, b *zip.FileHeader) bool {
+	return a.Name == b.Name && a.Comment == b.Comment && a.Method == b.Method && a.Modified.Equal(b.Modified) &&
+		a.ExternalAttrs == b.ExternalAttrs && bytes.Equal(a.Extra, b.Extra)
+}
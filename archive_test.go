@@ -0,0 +1,242 @@
+package godiff_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/mihailozarinschi/godiff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// archiveEntry is a file (or a directory, if its name ends with /) of a test archive
+type archiveEntry struct {
+	name string
+	data []byte
+}
+
+func archiveEntries(seed int64) (original, updated []archiveEntry) {
+	big := randomData(seed, 256*1024)
+	changed := append(append(append([]byte{}, big[:100*1024]...), "inserted"...), big[100*1024:]...)
+	longName := "dir/" + strings.Repeat("long-name-", 12) + "file.txt"
+
+	original = []archiveEntry{
+		{name: "dir/"},
+		{name: "dir/big.bin", data: big},
+		{name: "dir/removed.txt", data: []byte("removed")},
+		{name: longName, data: []byte(loremIpsum)},
+		{name: "unchanged.txt", data: []byte("unchanged")},
+	}
+	updated = []archiveEntry{
+		{name: "dir/"},
+		{name: "dir/big.bin", data: changed},
+		{name: longName, data: []byte(loremIpsum + " More.")},
+		{name: "unchanged.txt", data: []byte("unchanged")},
+		{name: "added.txt", data: []byte("added")},
+	}
+	return original, updated
+}
+
+func writeTar(t *testing.T, entries []archiveEntry, format tar.Format) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0o644, Size: int64(len(entry.data)), ModTime: time.Unix(1700000000, 0), Format: format}
+		if strings.HasSuffix(entry.name, "/") {
+			header.Typeflag, header.Mode = tar.TypeDir, 0o755
+		}
+		require.NoError(t, tw.WriteHeader(header))
+		_, err := tw.Write(entry.data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func writeZip(t *testing.T, entries []archiveEntry, comment string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: entry.name, Method: zip.Deflate, Modified: time.Unix(1700000000, 0)})
+		require.NoError(t, err)
+		_, err = w.Write(entry.data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.SetComment(comment))
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+// assertArchiveDiff checks the entries of the diff, and that it only holds the changed data
+func assertArchiveDiff(t *testing.T, diff *godiff.ArchiveDiff) {
+	types := make(map[string]godiff.ArchiveChangeType)
+	var added int64
+	for _, entry := range diff.Entries {
+		types[entry.Name] = entry.Type
+		for _, d := range entry.Diffs {
+			if d.Type == godiff.DeltaTypeAdd {
+				added += d.DataLen
+			}
+		}
+	}
+	assert.Equal(t, godiff.ArchiveEntryUnchanged, types["dir/"])
+	assert.Equal(t, godiff.ArchiveEntryModified, types["dir/big.bin"])
+	assert.Equal(t, godiff.ArchiveEntryUnchanged, types["unchanged.txt"])
+	assert.Equal(t, godiff.ArchiveEntryAdded, types["added.txt"])
+	assert.Equal(t, []string{"dir/removed.txt"}, diff.Removed)
+	assert.Less(t, added, int64(64*1024))
+}
+
+func TestDiffTar(t *testing.T) {
+	cfg := &godiff.Config{AvgChunkSize: 4 * 1024}
+
+	for _, format := range []tar.Format{tar.FormatGNU, tar.FormatPAX} {
+		t.Run(format.String(), func(t *testing.T) {
+			originalEntries, updatedEntries := archiveEntries(14)
+			original := writeTar(t, originalEntries, format)
+			updated := writeTar(t, updatedEntries, format)
+
+			diff, err := godiff.DiffTar(bytes.NewReader(original), bytes.NewReader(updated), cfg)
+			require.NoError(t, err)
+			assert.Equal(t, godiff.ArchiveTar, diff.Format)
+			assertArchiveDiff(t, diff)
+
+			var patched bytes.Buffer
+			require.NoError(t, godiff.PatchTar(bytes.NewReader(original), diff, &patched))
+			assert.Equal(t, updated, patched.Bytes())
+		})
+	}
+}
+
+func TestDiffTarHeaderOnlyEntries(t *testing.T) {
+	cfg := &godiff.Config{AvgChunkSize: 4 * 1024}
+
+	// Directories and links have no contents in the archive, whatever their size says
+	tarData := func(contents string) []byte {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0o755, Size: 4096, Format: tar.FormatGNU}))
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "dir/a", Size: 4096, Format: tar.FormatGNU}))
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "dir/a", Mode: 0o644, Size: int64(len(contents)), Format: tar.FormatGNU}))
+		_, err := tw.Write([]byte(contents))
+		require.NoError(t, err)
+		require.NoError(t, tw.Close())
+		return buf.Bytes()
+	}
+	original, updated := tarData(loremIpsum), tarData(loremIpsum+" More.")
+
+	diff, err := godiff.DiffTar(bytes.NewReader(original), bytes.NewReader(updated), cfg)
+	require.NoError(t, err)
+	require.Len(t, diff.Entries, 3)
+	assert.Equal(t, godiff.ArchiveEntryUnchanged, diff.Entries[0].Type)
+	assert.Equal(t, godiff.ArchiveEntryUnchanged, diff.Entries[1].Type)
+	assert.Equal(t, godiff.ArchiveEntryModified, diff.Entries[2].Type)
+
+	var patched bytes.Buffer
+	require.NoError(t, godiff.PatchTar(bytes.NewReader(original), diff, &patched))
+	assert.Equal(t, updated, patched.Bytes())
+}
+
+func TestDiffZip(t *testing.T) {
+	cfg := &godiff.Config{AvgChunkSize: 4 * 1024}
+	originalEntries, updatedEntries := archiveEntries(15)
+	original := writeZip(t, originalEntries, "original")
+	updated := writeZip(t, updatedEntries, "updated")
+
+	diff, err := godiff.DiffZip(bytes.NewReader(original), int64(len(original)), bytes.NewReader(updated), int64(len(updated)), cfg)
+	require.NoError(t, err)
+	assert.Equal(t, godiff.ArchiveZip, diff.Format)
+	assertArchiveDiff(t, diff)
+
+	var patched bytes.Buffer
+	require.NoError(t, godiff.PatchZip(bytes.NewReader(original), int64(len(original)), diff, &patched))
+
+	// Same entries, in the same order, with the same headers and contents
+	updatedZip, err := zip.NewReader(bytes.NewReader(updated), int64(len(updated)))
+	require.NoError(t, err)
+	zr, err := zip.NewReader(bytes.NewReader(patched.Bytes()), int64(patched.Len()))
+	require.NoError(t, err)
+	assert.Equal(t, "updated", zr.Comment)
+	require.Len(t, zr.File, len(updatedEntries))
+	for i, f := range zr.File {
+		assert.Equal(t, updatedEntries[i].name, f.Name)
+		assert.Equal(t, updatedZip.File[i].Method, f.Method)
+		assert.True(t, f.Modified.Equal(time.Unix(1700000000, 0)))
+		assert.Equal(t, updatedZip.File[i].Extra, f.Extra)
+
+		rc, err := f.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		assert.Equal(t, len(updatedEntries[i].data), len(data))
+		assert.True(t, bytes.Equal(updatedEntries[i].data, data))
+	}
+
+	// The patched archive is equivalent to the updated one, again after another round
+	for round := 0; round < 2; round++ {
+		diff, err = godiff.DiffZip(bytes.NewReader(updated), int64(len(updated)), bytes.NewReader(patched.Bytes()), int64(patched.Len()), cfg)
+		require.NoError(t, err)
+		for _, entry := range diff.Entries {
+			assert.Equal(t, godiff.ArchiveEntryUnchanged, entry.Type, entry.Name)
+		}
+		assert.Empty(t, diff.Removed)
+
+		var repatched bytes.Buffer
+		require.NoError(t, godiff.PatchZip(bytes.NewReader(updated), int64(len(updated)), diff, &repatched))
+		patched = repatched
+	}
+}
+
+func TestArchiveDiffInvalid(t *testing.T) {
+	cfg := &godiff.Config{AvgChunkSize: 4 * 1024}
+	entries, _ := archiveEntries(16)
+	tarData := writeTar(t, entries, tar.FormatPAX)
+	zipData := writeZip(t, entries, "")
+
+	_, err := godiff.DiffTar(bytes.NewReader(tarData), bytes.NewReader(zipData), cfg)
+	assert.ErrorIs(t, err, godiff.ErrInvalidFormat)
+	_, err = godiff.DiffZip(bytes.NewReader(zipData), int64(len(zipData)), bytes.NewReader(tarData), int64(len(tarData)), cfg)
+	assert.ErrorIs(t, err, godiff.ErrInvalidFormat)
+
+	// A diff only applies to its format, and to its original archive
+	zipDiff, err := godiff.DiffZip(bytes.NewReader(zipData), int64(len(zipData)), bytes.NewReader(zipData), int64(len(zipData)), cfg)
+	require.NoError(t, err)
+	err = godiff.PatchTar(bytes.NewReader(tarData), zipDiff, io.Discard)
+	assert.ErrorIs(t, err, godiff.ErrInvalidDiffs)
+
+	tarDiff, err := godiff.DiffTar(bytes.NewReader(tarData), bytes.NewReader(tarData), cfg)
+	require.NoError(t, err)
+	err = godiff.PatchTar(bytes.NewReader(writeTar(t, entries[:1], tar.FormatPAX)), tarDiff, io.Discard)
+	assert.ErrorIs(t, err, godiff.ErrInvalidDiffs)
+
+	// Entries can't decompress to more than their size, so that a zip bomb can't take all the memory
+	bomb := writeZip(t, []archiveEntry{{name: "bomb", data: make([]byte, 1<<20)}}, "")
+	directory := bytes.LastIndex(bomb, []byte("PK\x01\x02"))
+	require.GreaterOrEqual(t, directory, 0)
+	binary.LittleEndian.PutUint32(bomb[directory+24:], 1024) // Uncompressed size
+	_, err = godiff.DiffZip(bytes.NewReader(zipData), int64(len(zipData)), bytes.NewReader(bomb), int64(len(bomb)), cfg)
+	assert.ErrorIs(t, err, godiff.ErrInvalidFormat)
+	err = godiff.PatchZip(bytes.NewReader(bomb), int64(len(bomb)), &godiff.ArchiveDiff{Format: godiff.ArchiveZip, Entries: []*godiff.ArchiveEntryDiff{
+		{Name: "bomb", Original: 0, ZipHeader: &zip.FileHeader{Name: "bomb"}},
+	}}, io.Discard)
+	assert.ErrorIs(t, err, godiff.ErrInvalidFormat)
+
+	// Sparse entries aren't supported, the tar writer can't write them: the type of a GNU header is changed instead
+	sparse := writeTar(t, []archiveEntry{{name: "sparse"}}, tar.FormatGNU)
+	sparse[156] = tar.TypeGNUSparse
+	copy(sparse[148:156], "        ")
+	var checksum int
+	for _, b := range sparse[:512] {
+		checksum += int(b)
+	}
+	copy(sparse[148:156], fmt.Sprintf("%06o\x00 ", checksum))
+	_, err = godiff.DiffTar(bytes.NewReader(sparse), bytes.NewReader(tarData), cfg)
+	assert.ErrorIs(t, err, godiff.ErrInvalidFormat)
+}
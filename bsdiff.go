@@ -0,0 +1,354 @@
+package godiff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// BinaryPatch is the result of a bsdiff-like comparison of 2 inputs of data. Unlike the chunk-based diffs, which
+// are good at detecting inserted/removed blocks, it's meant for binaries (e.g. recompiled executables), where most
+// of the data is only slightly changed (relocated addresses, offsets) and shifted all over the place.
+type BinaryPatch struct {
+	Blocks []*BinaryBlock
+}
+
+// BinaryBlock is a single step of a BinaryPatch. Applying it means:
+//  1. add Diff byte-by-byte to the original data at the current original position and write the result
+//  2. write Extra as it is
+//  3. move the original position by len(Diff), then by Seek (which can be negative)
+type BinaryBlock struct {
+	Diff  []byte
+	Extra []byte
+	Seek  int64
+}
+
+// CalcBinaryPatch provides a bsdiff-like patch between any 2 given inputs of data.
+// Both inputs are fully loaded in memory, and a suffix array of the original data is built in order
+// to find the approximate matches between the 2 inputs.
+func CalcBinaryPatch(originalData, updatedData io.Reader) (*BinaryPatch, error) {
+	original, err := io.ReadAll(originalData)
+	if err != nil {
+		return nil, fmt.Errorf("error reading original data: %w", err)
+	}
+
+	updated, err := io.ReadAll(updatedData)
+	if err != nil {
+		return nil, fmt.Errorf("error reading updated data: %w", err)
+	}
+
+	return &BinaryPatch{Blocks: binaryBlocks(original, updated)}, nil
+}
+
+// ApplyBinaryPatch writes to w the updated data, rebuilt from the original data and the given patch
+func ApplyBinaryPatch(originalData io.Reader, patch *BinaryPatch, w io.Writer) error {
+	original, err := io.ReadAll(originalData)
+	if err != nil {
+		return fmt.Errorf("error reading original data: %w", err)
+	}
+
+	var pos int64
+	var buf []byte
+	for i, block := range patch.Blocks {
+		diffLen := int64(len(block.Diff))
+		if pos < 0 || pos+diffLen > int64(len(original)) {
+			return fmt.Errorf("block #%d is out of the original data bounds (pos=%d len=%d): %w", i, pos, diffLen, ErrInvalidDiffs)
+		}
+
+		// Add the diff bytes to the original ones
+		buf = append(buf[:0], block.Diff...)
+		for j := range buf {
+			buf[j] += original[pos+int64(j)]
+		}
+
+		if _, err = w.Write(buf); err != nil {
+			return fmt.Errorf("error writing block #%d diff data: %w", i, err)
+		}
+		if _, err = w.Write(block.Extra); err != nil {
+			return fmt.Errorf("error writing block #%d extra data: %w", i, err)
+		}
+
+		pos += diffLen + block.Seek
+	}
+
+	return nil
+}
+
+// binaryBlocks is a port of the bsdiff algorithm. It scans the updated data looking for exact matches in the original
+// data, and extends them forward and backward as long as at least half of the bytes still match (approximate matches).
+// The approximate matches become Diff data, and everything in between becomes Extra data.
+func binaryBlocks(original, updated []byte) []*BinaryBlock {
+	var blocks []*BinaryBlock
+
+	sa := suffixArray(original)
+
+	var (
+		scan, pos, matchLen          int
+		lastScan, lastPos, lastShift int
+	)
+
+	for scan < len(updated) {
+		var oldScore int
+
+		scan += matchLen
+		for scsc := scan; scan < len(updated); scan++ {
+			pos, matchLen = searchSuffixArray(sa, original, updated[scan:])
+
+			// Count how many bytes would match by simply following the previous match
+			for ; scsc < scan+matchLen; scsc++ {
+				if scsc+lastShift < len(original) && original[scsc+lastShift] == updated[scsc] {
+					oldScore++
+				}
+			}
+
+			// Stop when the found match is either the same as the previous one, or much better (8+ bytes)
+			if (matchLen == oldScore && matchLen != 0) || matchLen > oldScore+8 {
+				break
+			}
+
+			if scan+lastShift < len(original) && original[scan+lastShift] == updated[scan] {
+				oldScore--
+			}
+		}
+
+		if matchLen == oldScore && scan != len(updated) {
+			continue
+		}
+
+		// Extend the previous match forward
+		var forwardLen int
+		for i, s, best := 0, 0, 0; lastScan+i < scan && lastPos+i < len(original); {
+			if original[lastPos+i] == updated[lastScan+i] {
+				s++
+			}
+			i++
+			if s*2-i > best*2-forwardLen {
+				best = s
+				forwardLen = i
+			}
+		}
+
+		// Extend the current match backward
+		var backwardLen int
+		if scan < len(updated) {
+			for i, s, best := 1, 0, 0; scan >= lastScan+i && pos >= i; i++ {
+				if original[pos-i] == updated[scan-i] {
+					s++
+				}
+				if s*2-i > best*2-backwardLen {
+					best = s
+					backwardLen = i
+				}
+			}
+		}
+
+		// The extensions overlap, find the best split point between them
+		if lastScan+forwardLen > scan-backwardLen {
+			overlap := (lastScan + forwardLen) - (scan - backwardLen)
+			var s, best, splitLen int
+			for i := 0; i < overlap; i++ {
+				if updated[lastScan+forwardLen-overlap+i] == original[lastPos+forwardLen-overlap+i] {
+					s++
+				}
+				if updated[scan-backwardLen+i] == original[pos-backwardLen+i] {
+					s--
+				}
+				if s > best {
+					best = s
+					splitLen = i + 1
+				}
+			}
+			forwardLen += splitLen - overlap
+			backwardLen -= splitLen
+		}
+
+		block := &BinaryBlock{
+			Diff:  make([]byte, forwardLen),
+			Extra: append([]byte(nil), updated[lastScan+forwardLen:scan-backwardLen]...),
+			Seek:  int64((pos - backwardLen) - (lastPos + forwardLen)),
+		}
+		for i := range block.Diff {
+			block.Diff[i] = updated[lastScan+i] - original[lastPos+i]
+		}
+		blocks = append(blocks, block)
+
+		lastScan = scan - backwardLen
+		lastPos = pos - backwardLen
+		lastShift = pos - scan
+	}
+
+	return blocks
+}
+
+// suffixArray returns the sorted list of all the suffixes' starting positions of the given data, including the
+// empty suffix (at position len(data)). It's a port of the Larsson-Sadakane qsufsort used by bsdiff:
+// suffixes are bucketed by their first byte, then groups are repeatedly split by doubling the sorted prefix length.
+// Sorted groups are marked with negative lengths in sa, and rank holds each suffix's group.
+func suffixArray(data []byte) []int {
+	n := len(data)
+	sa := make([]int, n+1)
+	rank := make([]int, n+1)
+
+	var buckets [256]int
+	for _, b := range data {
+		buckets[b]++
+	}
+	for i := 1; i < 256; i++ {
+		buckets[i] += buckets[i-1]
+	}
+	for i := 255; i > 0; i-- {
+		buckets[i] = buckets[i-1]
+	}
+	buckets[0] = 0
+
+	for i, b := range data {
+		buckets[b]++
+		sa[buckets[b]] = i
+	}
+	sa[0] = n
+	for i, b := range data {
+		rank[i] = buckets[b]
+	}
+	rank[n] = 0
+	for i := 1; i < 256; i++ {
+		if buckets[i] == buckets[i-1]+1 {
+			sa[buckets[i]] = -1
+		}
+	}
+	sa[0] = -1
+
+	for h := 1; sa[0] != -(n + 1); h += h {
+		var sortedLen int
+		i := 0
+		for i < n+1 {
+			if sa[i] < 0 {
+				// Skip an already sorted group
+				sortedLen -= sa[i]
+				i -= sa[i]
+				continue
+			}
+			if sortedLen != 0 {
+				sa[i-sortedLen] = -sortedLen
+			}
+			groupLen := rank[sa[i]] + 1 - i
+			splitGroup(sa, rank, i, groupLen, h)
+			i += groupLen
+			sortedLen = 0
+		}
+		if sortedLen != 0 {
+			sa[i-sortedLen] = -sortedLen
+		}
+	}
+
+	for i := 0; i < n+1; i++ {
+		sa[rank[i]] = i
+	}
+
+	return sa
+}
+
+// splitGroup sorts the group of suffixes sa[start:start+length] by the rank of their h-th following suffix
+// (ternary quicksort for large groups, selection sort for the small ones), and updates their ranks accordingly.
+func splitGroup(sa, rank []int, start, length, h int) {
+	if length < 16 {
+		for k, j := start, 0; k < start+length; k += j {
+			j = 1
+			x := rank[sa[k]+h]
+			for i := 1; k+i < start+length; i++ {
+				if rank[sa[k+i]+h] < x {
+					x = rank[sa[k+i]+h]
+					j = 0
+				}
+				if rank[sa[k+i]+h] == x {
+					sa[k+j], sa[k+i] = sa[k+i], sa[k+j]
+					j++
+				}
+			}
+			for i := 0; i < j; i++ {
+				rank[sa[k+i]] = k + j - 1
+			}
+			if j == 1 {
+				sa[k] = -1
+			}
+		}
+		return
+	}
+
+	x := rank[sa[start+length/2]+h]
+	var lt, eq int
+	for i := start; i < start+length; i++ {
+		if rank[sa[i]+h] < x {
+			lt++
+		}
+		if rank[sa[i]+h] == x {
+			eq++
+		}
+	}
+	lt += start
+	eq += lt
+
+	i, j, k := start, 0, 0
+	for i < lt {
+		switch {
+		case rank[sa[i]+h] < x:
+			i++
+		case rank[sa[i]+h] == x:
+			sa[i], sa[lt+j] = sa[lt+j], sa[i]
+			j++
+		default:
+			sa[i], sa[eq+k] = sa[eq+k], sa[i]
+			k++
+		}
+	}
+	for lt+j < eq {
+		if rank[sa[lt+j]+h] == x {
+			j++
+		} else {
+			sa[lt+j], sa[eq+k] = sa[eq+k], sa[lt+j]
+			k++
+		}
+	}
+
+	if lt > start {
+		splitGroup(sa, rank, start, lt-start, h)
+	}
+
+	for i := 0; i < eq-lt; i++ {
+		rank[sa[lt+i]] = eq - 1
+	}
+	if lt == eq-1 {
+		sa[lt] = -1
+	}
+
+	if start+length > eq {
+		splitGroup(sa, rank, eq, start+length-eq, h)
+	}
+}
+
+// searchSuffixArray finds the longest match of the given data prefix within the original data
+func searchSuffixArray(sa []int, original, data []byte) (pos, matchLen int) {
+	start, end := 0, len(sa)-1
+	for end-start >= 2 {
+		mid := start + (end-start)/2
+		if bytes.Compare(original[sa[mid]:], data) < 0 {
+			start = mid
+		} else {
+			end = mid
+		}
+	}
+
+	startLen := commonPrefixLen(original[sa[start]:], data)
+	endLen := commonPrefixLen(original[sa[end]:], data)
+	if startLen > endLen {
+		return sa[start], startLen
+	}
+	return sa[end], endLen
+}
+
+func commonPrefixLen(a, b []byte) int {
+	var i int
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,151 @@
+package godiff_test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"github.com/mihailozarinschi/godiff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestBinaryPatch(t *testing.T) {
+	tt := []struct {
+		name     string
+		original func(t *testing.T) []byte
+		updated  func(t *testing.T) []byte
+	}{
+		{
+			name:     "both empty",
+			original: func(_ *testing.T) []byte { return nil },
+			updated:  func(_ *testing.T) []byte { return nil },
+		},
+		{
+			name:     "empty original",
+			original: func(_ *testing.T) []byte { return nil },
+			updated:  func(_ *testing.T) []byte { return []byte("Lorem ipsum dolor sit amet") },
+		},
+		{
+			name:     "empty updated",
+			original: func(_ *testing.T) []byte { return []byte("Lorem ipsum dolor sit amet") },
+			updated:  func(_ *testing.T) []byte { return nil },
+		},
+		{
+			name:     "same data",
+			original: func(_ *testing.T) []byte { return []byte("Lorem ipsum dolor sit amet") },
+			updated:  func(_ *testing.T) []byte { return []byte("Lorem ipsum dolor sit amet") },
+		},
+		{
+			name: "shifted addresses",
+			original: func(_ *testing.T) []byte {
+				return []byte{0x10, 0x00, 0xaa, 0xbb, 0x14, 0x00, 0xaa, 0xbb, 0x18, 0x00, 0xaa, 0xbb, 0x1c, 0x00, 0xaa, 0xbb, 0x20, 0x00}
+			},
+			updated: func(_ *testing.T) []byte {
+				return []byte{0x12, 0x00, 0xaa, 0xbb, 0x16, 0x00, 0xaa, 0xbb, 0x1a, 0x00, 0xaa, 0xbb, 0x1e, 0x00, 0xaa, 0xbb, 0x22, 0x00}
+			},
+		},
+		{
+			name: "lorem ipsum (file)",
+			original: func(t *testing.T) []byte {
+				data, err := os.ReadFile("testdata/original.txt")
+				require.NoError(t, err)
+				return data
+			},
+			updated: func(t *testing.T) []byte {
+				data, err := os.ReadFile("testdata/updated.txt")
+				require.NoError(t, err)
+				return data
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			original := tc.original(t)
+			updated := tc.updated(t)
+
+			patch, err := godiff.CalcBinaryPatch(bytes.NewReader(original), bytes.NewReader(updated))
+			require.NoError(t, err)
+
+			var patched bytes.Buffer
+			err = godiff.ApplyBinaryPatch(bytes.NewReader(original), patch, &patched)
+			require.NoError(t, err)
+			assert.Equal(t, string(updated), patched.String())
+
+			for i, block := range patch.Blocks {
+				t.Logf("Block #%d diff=%d extra=%d seek=%d", i, len(block.Diff), len(block.Extra), block.Seek)
+			}
+		})
+	}
+}
+
+func TestApplyBinaryPatchOutOfBounds(t *testing.T) {
+	patch := &godiff.BinaryPatch{Blocks: []*godiff.BinaryBlock{{Diff: make([]byte, 10)}}}
+	err := godiff.ApplyBinaryPatch(bytes.NewReader([]byte("short")), patch, &bytes.Buffer{})
+	require.Error(t, err)
+}
+
+// buildTestBinaries compiles this package's tests twice, with and without -trimpath, which changes the length of all
+// the embedded paths and shifts most of the addresses, like any real recompilation would do.
+func buildTestBinaries(b *testing.B) (original, updated []byte) {
+	dir := b.TempDir()
+	originalPath := filepath.Join(dir, "original.test")
+	updatedPath := filepath.Join(dir, "updated.test")
+
+	if out, err := exec.Command("go", "test", "-c", "-trimpath", "-o", originalPath, ".").CombinedOutput(); err != nil {
+		b.Skipf("unable to build the original test binary: %s: %s", err, out)
+	}
+	if out, err := exec.Command("go", "test", "-c", "-o", updatedPath, ".").CombinedOutput(); err != nil {
+		b.Skipf("unable to build the updated test binary: %s: %s", err, out)
+	}
+
+	original, err := os.ReadFile(originalPath)
+	require.NoError(b, err)
+	updated, err = os.ReadFile(updatedPath)
+	require.NoError(b, err)
+
+	return original, updated
+}
+
+func BenchmarkBinaryEngines(b *testing.B) {
+	original, updated := buildTestBinaries(b)
+
+	b.Run("chunk", func(b *testing.B) {
+		var patchSize int64
+		for i := 0; i < b.N; i++ {
+			diffs, err := godiff.CalcDiffs(bytes.NewReader(original), bytes.NewReader(updated), sha1.New, 16, 512, 7)
+			require.NoError(b, err)
+
+			patchSize = 0
+			for _, diff := range diffs {
+				if diff.Type == godiff.DeltaTypeAdd {
+					patchSize += diff.DataLen
+				}
+			}
+		}
+		b.ReportMetric(float64(patchSize), "patch-bytes")
+	})
+
+	b.Run("bsdiff", func(b *testing.B) {
+		var patchSize int64
+		for i := 0; i < b.N; i++ {
+			patch, err := godiff.CalcBinaryPatch(bytes.NewReader(original), bytes.NewReader(updated))
+			require.NoError(b, err)
+
+			// Diff data is mostly made of zeroes, which compress very well, only the rest is accounted for
+			patchSize = 0
+			for _, block := range patch.Blocks {
+				patchSize += int64(len(block.Extra))
+				for _, d := range block.Diff {
+					if d != 0 {
+						patchSize++
+					}
+				}
+			}
+		}
+		b.ReportMetric(float64(patchSize), "patch-bytes")
+	})
+}
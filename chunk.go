@@ -1,7 +1,6 @@
 package godiff
 
 import (
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"hash"
@@ -13,6 +12,8 @@ type Chunk struct {
 	DataOffset int64
 	DataLen    int64
 	Hash       string
+	Weak       uint32 // Adler-32 of the data, only set with Config.WeakHash
+	HasWeak    bool   // Whether Weak is set, as it can be 0
 }
 
 // ChunkData will split any given data into chunks of hashes based on a rolling-hash algorithm,
@@ -20,12 +21,76 @@ type Chunk struct {
 func ChunkData(r io.Reader, h hash.Hash, minChunkSize, divisor, prime int64) ([]*Chunk, error) {
 	var chunks []*Chunk
 
+	err := ChunkDataFunc(r, h, minChunkSize, divisor, prime, func(chunk *Chunk) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return chunks, nil
+}
+
+// ChunkDataFunc works exactly like ChunkData, but instead of returning all the chunks at the end, it calls fn
+// with each chunk as soon as its breakpoint is found, so that the chunks don't need to be kept in memory.
+// If fn returns an error, chunking stops and the error is returned as it is.
+func ChunkDataFunc(r io.Reader, h hash.Hash, minChunkSize, divisor, prime int64, fn func(chunk *Chunk) error) error {
+	if h == nil {
+		return &ParamError{Name: "h", Value: h, Reason: "must not be nil"}
+	}
+	cfg, err := rabinConfig(func() hash.Hash { return h }, minChunkSize, divisor, prime)
+	if err != nil {
+		return err
+	}
+
+	return ChunkDataFuncWithConfig(r, cfg, fn)
+}
+
+// ChunkDataWithConfig works like ChunkData, using the given config
+func ChunkDataWithConfig(r io.Reader, cfg *Config) ([]*Chunk, error) {
+	var chunks []*Chunk
+
+	err := ChunkDataFuncWithConfig(r, cfg, func(chunk *Chunk) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return chunks, nil
+}
+
+// ChunkDataFuncWithConfig works like ChunkDataFunc, using the given config
+func ChunkDataFuncWithConfig(r io.Reader, cfg *Config, fn func(chunk *Chunk) error) error {
+	cfg, err := cfg.resolve()
+	if err != nil {
+		return err
+	}
+
+	h := cfg.newChunkHasher()
+	switch cfg.Algorithm {
+	case AlgorithmRabin:
+		return chunkRabin(r, h, cfg, fn)
+	default:
+		return chunkGear(r, h, cfg.gearTable(), cfg, fn)
+	}
+}
+
+// chunkRabin finds the breakpoints with the Rabin-like fingerprint, over a window sliding one byte at a time
+func chunkRabin(r io.Reader, h *chunkHasher, cfg *Config, fn func(chunk *Chunk) error) error {
+	var (
+		divisor = cfg.AvgChunkSize - cfg.MinChunkSize
+		prime   = cfg.Prime
+	)
+
 	// With the TeeReader, everything we read from the reader, will be written to the hash too
 	r = io.TeeReader(r, h)
 
 	var EOF bool
 	var currentOffset int64
-	var dataWindow = make([]byte, minChunkSize) // minChunkSize will also be our fingerprinting window size
+	var dataWindow = make([]byte, cfg.WindowSize)
 
 	for !EOF {
 		// Reset the hash before starting a new chunk
@@ -33,9 +98,9 @@ func ChunkData(r io.Reader, h hash.Hash, minChunkSize, divisor, prime int64) ([]
 
 		// Read initial data window
 		chunkLen, err := io.ReadFull(r, dataWindow)
-		EOF = errors.Is(err, io.EOF)
+		EOF = errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) // ErrUnexpectedEOF means a partial window
 		if err != nil && !EOF {
-			return nil, fmt.Errorf("error reading initial data window: %s", err)
+			return fmt.Errorf("error reading initial data window: %w", err)
 		}
 		if chunkLen == 0 {
 			// Nothing was read, we're done
@@ -50,14 +115,15 @@ func ChunkData(r io.Reader, h hash.Hash, minChunkSize, divisor, prime int64) ([]
 		// Calculate the initial data window fingerprint
 		dataWindowFingerprint := Fingerprint(dataWindow, prime)
 		for {
-			if EOF || foundBreakpoint(dataWindowFingerprint, divisor) {
+			atBreakpoint := int64(chunkLen) >= cfg.MinChunkSize && foundBreakpoint(dataWindowFingerprint, divisor)
+			atMaxSize := cfg.MaxChunkSize > 0 && int64(chunkLen) >= cfg.MaxChunkSize
+			if EOF || atBreakpoint || atMaxSize {
 				// We're either done reading, either got to a breakpoint.
 				// Get the current chunk's hash, and start the next chunk, if any
-				chunks = append(chunks, &Chunk{
-					DataOffset: currentOffset - int64(chunkLen),
-					DataLen:    int64(chunkLen),
-					Hash:       hex.EncodeToString(h.Sum(nil)),
-				})
+				err = fn(h.chunk(currentOffset-int64(chunkLen), int64(chunkLen)))
+				if err != nil {
+					return err
+				}
 				break
 			}
 
@@ -67,7 +133,7 @@ func ChunkData(r io.Reader, h hash.Hash, minChunkSize, divisor, prime int64) ([]
 			readLen, err := r.Read(dataWindow[len(dataWindow)-1:]) // Read 1 byte into the last dataWindow byte
 			EOF = errors.Is(err, io.EOF)
 			if err != nil && !EOF {
-				return nil, fmt.Errorf("error reading next byte: %s", err)
+				return fmt.Errorf("error reading next byte: %w", err)
 			}
 			if readLen == 0 {
 				// Nothing was read, we're done.
@@ -82,7 +148,7 @@ func ChunkData(r io.Reader, h hash.Hash, minChunkSize, divisor, prime int64) ([]
 		}
 	}
 
-	return chunks, nil
+	return nil
 }
 
 func foundBreakpoint(fingerprint, divisor int64) bool {
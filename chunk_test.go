@@ -1,12 +1,15 @@
 package godiff_test
 
 import (
+	"bytes"
 	"crypto/sha1"
+	"errors"
 	"github.com/mihailozarinschi/godiff"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"hash"
 	"io"
+	"os"
 	"strings"
 	"testing"
 )
@@ -72,6 +75,19 @@ func TestChunkData(t *testing.T) {
 				{DataOffset: 389, DataLen: 41, Hash: "310860931148f42e25c0be31ae27ed4e1a9f35c0"},
 			},
 		},
+		{
+			name: "shorter than the window",
+			data: func(_ *testing.T) io.ReadSeeker {
+				return strings.NewReader("abc")
+			},
+			hashFn:       sha1.New(),
+			minChunkSize: 4,
+			divisor:      16,
+			prime:        7,
+			chunks: []*godiff.Chunk{
+				{DataOffset: 0, DataLen: 3, Hash: "a9993e364706816aba3e25717850c26c9cd0d89d"},
+			},
+		},
 		// TODO: add more test cases, maybe with files, different hash function, etc
 	}
 
@@ -103,3 +119,48 @@ func TestChunkData(t *testing.T) {
 		})
 	}
 }
+
+func TestChunkDataFunc(t *testing.T) {
+	data, err := os.ReadFile("testdata/original.txt")
+	require.NoError(t, err)
+
+	expected, err := godiff.ChunkData(bytes.NewReader(data), sha1.New(), 4, 16, 7)
+	require.NoError(t, err)
+
+	// Chunks are provided while the data is still being read
+	r := &countingReader{r: bytes.NewReader(data)}
+	var chunks []*godiff.Chunk
+	var readWhenFound []int64
+	err = godiff.ChunkDataFunc(r, sha1.New(), 4, 16, 7, func(chunk *godiff.Chunk) error {
+		chunks = append(chunks, chunk)
+		readWhenFound = append(readWhenFound, r.n)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, expected, chunks)
+	for i, chunk := range chunks[:len(chunks)-1] {
+		assert.Equal(t, chunk.DataOffset+chunk.DataLen, readWhenFound[i])
+	}
+
+	// Errors returned by the callback stop the chunking
+	stop := errors.New("stop")
+	var calls int
+	err = godiff.ChunkDataFunc(bytes.NewReader(data), sha1.New(), 4, 16, 7, func(chunk *godiff.Chunk) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+}
+
+// countingReader counts the bytes read so far
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
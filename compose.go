@@ -0,0 +1,129 @@
+package godiff
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Compose squashes 2 consecutive sets of diffs, the first one going from A to B, and the second one from B to C,
+// into a single set of diffs going from A to C, without the need of B itself.
+// Both sets must have been calculated with the same chunking settings, so that the chunks of B are the same
+// for both of them. The chunks added by the first set and removed by the second one are simply dropped,
+// the rest of the positions and offsets are resolved from B to either A (removals) or C (additions).
+// Diffs refined with RefinementBytes don't cover whole chunks anymore, so they can't be composed.
+func Compose(first, second []*Diff) ([]*Diff, error) {
+	firstRemovals, firstAdditions, err := splitDiffs(first)
+	if err != nil {
+		return nil, fmt.Errorf("error reading first diffs: %w", err)
+	}
+
+	secondRemovals, secondAdditions, err := splitDiffs(second)
+	if err != nil {
+		return nil, fmt.Errorf("error reading second diffs: %w", err)
+	}
+
+	// Index B's chunks that were either added by the first diffs or removed by the second ones
+	addedInB := make(map[int]*Diff, len(firstAdditions))
+	for _, addition := range firstAdditions {
+		addedInB[addition.Position] = addition
+	}
+	removedFromB := make(map[int]*Diff, len(secondRemovals))
+	for _, removal := range secondRemovals {
+		removedFromB[removal.Position] = removal
+	}
+
+	composed := make([]*Diff, 0, len(first)+len(second))
+	composed = append(composed, firstRemovals...)
+
+	for _, removal := range secondRemovals {
+		if addition, ok := addedInB[removal.Position]; ok {
+			if addition.Hash != removal.Hash || addition.DataOffset != removal.DataOffset || addition.DataLen != removal.DataLen {
+				return nil, fmt.Errorf("chunk removed at %d is not the one that was added, diffs are not consecutive: %w", removal.Position, ErrInvalidDiffs)
+			}
+			// Added, then removed, it never existed as far as A and C are concerned
+			continue
+		}
+
+		// The chunk was kept from A, resolve its position and offset in A
+		position, offset := mapKeptChunk(removal.Position, removal.DataOffset, firstAdditions, firstRemovals)
+		composed = append(composed, &Diff{
+			ChunkDelta: &ChunkDelta{
+				Chunk:    &Chunk{DataOffset: offset, DataLen: removal.DataLen, Hash: removal.Hash},
+				Type:     DeltaTypeRemove,
+				Position: position,
+			},
+			Data: removal.Data,
+		})
+	}
+
+	for _, addition := range firstAdditions {
+		if _, ok := removedFromB[addition.Position]; ok {
+			continue
+		}
+
+		// The chunk was kept in C, resolve its position and offset in C
+		position, offset := mapKeptChunk(addition.Position, addition.DataOffset, secondRemovals, secondAdditions)
+		composed = append(composed, &Diff{
+			ChunkDelta: &ChunkDelta{
+				Chunk:    &Chunk{DataOffset: offset, DataLen: addition.DataLen, Hash: addition.Hash},
+				Type:     DeltaTypeAdd,
+				Position: position,
+			},
+			Data: addition.Data,
+		})
+	}
+
+	composed = append(composed, secondAdditions...)
+
+	// Set the order in which the composed diffs should be applied
+	sort.SliceStable(composed, func(i, j int) bool {
+		return deltaLess(composed[i].ChunkDelta, composed[j].ChunkDelta)
+	})
+
+	return composed, nil
+}
+
+// mapKeptChunk resolves the position and offset of a chunk kept between a source and a target,
+// given the chunks missing from the target (skipped) and the chunks missing from the source (inserted),
+// both sorted by position ASC.
+func mapKeptChunk(position int, offset int64, skipped, inserted []*Diff) (int, int64) {
+	// Count the source's kept chunks (and bytes) before this one
+	mapped, mappedOffset := position, offset
+	for _, s := range skipped {
+		if s.Position >= position {
+			break
+		}
+		mapped--
+		mappedOffset -= s.DataLen
+	}
+
+	// Find the position in the target, having the same number of kept chunks before it
+	for _, i := range inserted {
+		if i.Position > mapped {
+			break
+		}
+		mapped++
+		mappedOffset += i.DataLen
+	}
+
+	return mapped, mappedOffset
+}
+
+// splitDiffs splits the diffs into removals and additions, both sorted by position ASC
+func splitDiffs(diffs []*Diff) (removals, additions []*Diff, err error) {
+	for i, diff := range diffs {
+		switch diff.Type {
+		case DeltaTypeRemove:
+			removals = append(removals, diff)
+		case DeltaTypeAdd:
+			additions = append(additions, diff)
+		default:
+			return nil, nil, fmt.Errorf("diff #%d has an unknown type %d: %w", i, diff.Type, ErrInvalidDiffs)
+		}
+	}
+
+	sort.SliceStable(removals, func(i, j int) bool { return removals[i].Position < removals[j].Position })
+	sort.SliceStable(additions, func(i, j int) bool { return additions[i].Position < additions[j].Position })
+
+	return removals, additions, nil
+}
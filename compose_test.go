@@ -0,0 +1,115 @@
+package godiff_test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"github.com/mihailozarinschi/godiff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestCompose(t *testing.T) {
+	tt := []struct {
+		name    string
+		a, b, c string
+	}{
+		{
+			name: "no changes",
+			a:    loremIpsum,
+			b:    loremIpsum,
+			c:    loremIpsum,
+		},
+		{
+			name: "independent changes",
+			a:    loremIpsum,
+			b:    strings.Replace(loremIpsum, "consectetur", "xxxxxxxxxxx", 1),
+			c:    strings.Replace(strings.Replace(loremIpsum, "consectetur", "xxxxxxxxxxx", 1), "Excepteur", "yyyyyyyyy", 1),
+		},
+		{
+			name: "added then removed",
+			a:    loremIpsum,
+			b:    "Prepended data. " + loremIpsum + " Appended data.",
+			c:    loremIpsum,
+		},
+		{
+			name: "removed then added back",
+			a:    loremIpsum,
+			b:    loremIpsum[200:],
+			c:    loremIpsum,
+		},
+		{
+			name: "added then changed",
+			a:    loremIpsum,
+			b:    loremIpsum + " Appended data, which will be changed.",
+			c:    loremIpsum + " Appended data, that was changed.",
+		},
+		{
+			name: "added then shifted back",
+			a:    loremIpsum,
+			b:    loremIpsum + " Appended data.",
+			c:    loremIpsum[:300] + " Appended data.",
+		},
+		{
+			name: "from empty",
+			a:    "",
+			b:    loremIpsum[:100],
+			c:    loremIpsum,
+		},
+		{
+			name: "to empty",
+			a:    loremIpsum,
+			b:    loremIpsum[100:],
+			c:    "",
+		},
+		{
+			name: "moved around",
+			a:    loremIpsum,
+			b:    loremIpsum[len(loremIpsum)/2:] + loremIpsum[:len(loremIpsum)/2],
+			c:    loremIpsum[len(loremIpsum)/3:] + loremIpsum[:len(loremIpsum)/3],
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ab, err := godiff.CalcDiffs(strings.NewReader(tc.a), strings.NewReader(tc.b), sha1.New, 4, 16, 7)
+			require.NoError(t, err)
+			bc, err := godiff.CalcDiffs(strings.NewReader(tc.b), strings.NewReader(tc.c), sha1.New, 4, 16, 7)
+			require.NoError(t, err)
+
+			ac, err := godiff.Compose(ab, bc)
+			require.NoError(t, err)
+
+			// Apply the diffs sequentially
+			var b, c bytes.Buffer
+			require.NoError(t, godiff.Patch(strings.NewReader(tc.a), ab, &b))
+			require.NoError(t, godiff.Patch(bytes.NewReader(b.Bytes()), bc, &c))
+			require.Equal(t, tc.c, c.String())
+
+			// Apply the composed diffs
+			var composed bytes.Buffer
+			require.NoError(t, godiff.Patch(strings.NewReader(tc.a), ac, &composed))
+			assert.Equal(t, c.String(), composed.String())
+
+			// The composed diffs can be inverted too
+			ca, err := godiff.Invert(ac)
+			require.NoError(t, err)
+			var inverted bytes.Buffer
+			require.NoError(t, godiff.Patch(bytes.NewReader(composed.Bytes()), ca, &inverted))
+			assert.Equal(t, tc.a, inverted.String())
+		})
+	}
+}
+
+func TestComposeNotConsecutive(t *testing.T) {
+	first := []*godiff.Diff{
+		{ChunkDelta: &godiff.ChunkDelta{Chunk: &godiff.Chunk{DataOffset: 0, DataLen: 1, Hash: "A"}, Type: godiff.DeltaTypeAdd, Position: 0}, Data: []byte("a")},
+	}
+	second := []*godiff.Diff{
+		{ChunkDelta: &godiff.ChunkDelta{Chunk: &godiff.Chunk{DataOffset: 0, DataLen: 1, Hash: "B"}, Type: godiff.DeltaTypeRemove, Position: 0}, Data: []byte("b")},
+	}
+
+	_, err := godiff.Compose(first, second)
+	require.Error(t, err)
+}
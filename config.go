@@ -0,0 +1,244 @@
+package godiff
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+)
+
+// ChunkingAlgorithm is the rolling-hash algorithm used to find the chunks' breakpoints
+type ChunkingAlgorithm int
+
+const (
+	// AlgorithmGear is a FastCDC-like algorithm, based on a gear rolling hash and normalized chunk sizes
+	AlgorithmGear ChunkingAlgorithm = iota
+	// AlgorithmRabin is the Rabin-like fingerprint used by the positional API (ChunkData, CalcDiffs, etc.)
+	AlgorithmRabin
+)
+
+func (a ChunkingAlgorithm) String() string {
+	switch a {
+	case AlgorithmGear:
+		return "gear"
+	case AlgorithmRabin:
+		return "rabin"
+	default:
+		return fmt.Sprintf("ChunkingAlgorithm(%d)", int(a))
+	}
+}
+
+// RefinementMode tells how the diffs are refined, once the changed chunks are known
+type RefinementMode int
+
+const (
+	// RefinementNone keeps the diffs as whole chunks
+	RefinementNone RefinementMode = iota
+	// RefinementBytes trims the bytes common to the removed and the added chunks replacing them, so that only
+	// the bytes that really changed are kept in the diffs. Refined diffs can't be composed.
+	RefinementBytes
+)
+
+func (m RefinementMode) String() string {
+	switch m {
+	case RefinementNone:
+		return "none"
+	case RefinementBytes:
+		return "bytes"
+	default:
+		return fmt.Sprintf("RefinementMode(%d)", int(m))
+	}
+}
+
+// Names of the presets accepted by PresetConfig
+const (
+	PresetText       = "text"
+	PresetBinary     = "binary"
+	PresetLargeFiles = "large-files"
+)
+
+// Default values of the zero Config fields
+const (
+	defaultAvgChunkSize = 8 * 1024
+	defaultPrime        = 7
+	maxChunkSizeFactor  = 8 // Default MaxChunkSize, relative to AvgChunkSize
+)
+
+// minKeyLen is the minimum length of the key of the keyed chunking
+const minKeyLen = 16
+
+// Config contains all the chunking and diffing settings. Zero fields get a default value, see each field.
+type Config struct {
+	// HashFn provides the hash of the chunks, SHA-256 by default
+	HashFn func() hash.Hash
+
+	// Algorithm used to find the chunks' breakpoints, AlgorithmGear by default
+	Algorithm ChunkingAlgorithm
+
+	// WindowSize is the number of bytes the rolling hash is calculated on. Only used by AlgorithmRabin,
+	// where it defaults to MinChunkSize and can't exceed it. AlgorithmGear always uses 64 bytes.
+	WindowSize int64
+
+	// MinChunkSize defaults to AvgChunkSize/4
+	MinChunkSize int64
+	// AvgChunkSize is the expected size of the chunks, 8KiB by default
+	AvgChunkSize int64
+	// MaxChunkSize defaults to 8*AvgChunkSize. For AlgorithmRabin, the default is no limit.
+	MaxChunkSize int64
+
+	// Prime is the base of the AlgorithmRabin fingerprint, 7 by default
+	Prime int64
+
+	// Refinement of the diffs calculated by CalcDiffsWithConfig and CalcDiffsFuncWithConfig, none by default
+	Refinement RefinementMode
+
+	// Key enables the keyed chunking, only supported by AlgorithmGear: the gear table is derived from the key,
+	// and the chunks' hashes are HMACs (based on HashFn). Without the key, the chunks' sizes and hashes can't be
+	// used to tell whether some known data is present. Both sides of a diff need to use the same key.
+	Key []byte
+
+	// WeakHash adds the Adler-32 checksum of their data to the chunks (Chunk.Weak). It's cheap to calculate, so
+	// chunks are compared on it first, and on their hash only when it matches (see SignatureIndex).
+	WeakHash bool
+	// StrongHashLen truncates the chunks' hashes to their first bytes, to shrink the signatures of huge files at
+	// the cost of a higher collision probability (see CollisionProbability). 0 keeps the whole hash.
+	StrongHashLen int
+}
+
+// DefaultConfig provides the default settings, suitable for any kind of data
+func DefaultConfig() *Config {
+	return (&Config{}).withDefaults()
+}
+
+// PresetConfig provides the settings tuned for a kind of data:
+//   - PresetText, small chunks, so that small edits produce small diffs
+//   - PresetBinary, the default settings
+//   - PresetLargeFiles, big chunks, so that there are less chunks to keep track of
+func PresetConfig(preset string) (*Config, error) {
+	cfg := &Config{}
+	switch preset {
+	case PresetText:
+		cfg.AvgChunkSize = 256
+		cfg.MinChunkSize = 64
+		cfg.Refinement = RefinementBytes
+	case PresetBinary:
+	case PresetLargeFiles:
+		cfg.AvgChunkSize = 1024 * 1024
+	default:
+		return nil, &ParamError{Name: "preset", Value: preset, Reason: "unknown preset"}
+	}
+	return cfg.withDefaults(), nil
+}
+
+// withDefaults provides a copy of the config, where the zero fields are set to their default value
+func (c *Config) withDefaults() *Config {
+	cfg := *c
+	if cfg.HashFn == nil {
+		cfg.HashFn = sha256.New
+	}
+	if cfg.AvgChunkSize == 0 {
+		cfg.AvgChunkSize = defaultAvgChunkSize
+	}
+	if cfg.MinChunkSize == 0 {
+		cfg.MinChunkSize = cfg.AvgChunkSize / 4
+	}
+	if cfg.MaxChunkSize == 0 && cfg.Algorithm != AlgorithmRabin {
+		cfg.MaxChunkSize = cfg.AvgChunkSize * maxChunkSizeFactor
+	}
+	if cfg.Algorithm == AlgorithmRabin {
+		if cfg.WindowSize == 0 {
+			cfg.WindowSize = cfg.MinChunkSize
+		}
+		if cfg.Prime == 0 {
+			cfg.Prime = defaultPrime
+		}
+	}
+	return &cfg
+}
+
+// validate checks a config, once the defaults were set
+func (c *Config) validate() error {
+	switch {
+	case c.Algorithm != AlgorithmGear && c.Algorithm != AlgorithmRabin:
+		return &ParamError{Name: "Algorithm", Value: c.Algorithm, Reason: "unknown algorithm"}
+	case c.Refinement != RefinementNone && c.Refinement != RefinementBytes:
+		return &ParamError{Name: "Refinement", Value: c.Refinement, Reason: "unknown refinement mode"}
+	case c.MinChunkSize <= 0:
+		return &ParamError{Name: "MinChunkSize", Value: c.MinChunkSize, Reason: "must be positive"}
+	case c.AvgChunkSize <= c.MinChunkSize:
+		return &ParamError{Name: "AvgChunkSize", Value: c.AvgChunkSize, Reason: "must be greater than MinChunkSize"}
+	case c.MaxChunkSize != 0 && c.MaxChunkSize < c.AvgChunkSize:
+		return &ParamError{Name: "MaxChunkSize", Value: c.MaxChunkSize, Reason: "must be at least AvgChunkSize"}
+	}
+
+	if len(c.Key) > 0 {
+		switch {
+		case c.Algorithm != AlgorithmGear:
+			return &ParamError{Name: "Key", Value: c.Algorithm, Reason: "keyed chunking is only supported by AlgorithmGear"}
+		case len(c.Key) < minKeyLen:
+			return &ParamError{Name: "Key", Value: fmt.Sprintf("(%d bytes)", len(c.Key)), Reason: fmt.Sprintf("must be at least %d bytes", minKeyLen)}
+		}
+	}
+
+	if size := c.HashFn().Size(); c.StrongHashLen < 0 || c.StrongHashLen > size {
+		return &ParamError{Name: "StrongHashLen", Value: c.StrongHashLen, Reason: fmt.Sprintf("must be between 0 and the hash size (%d bytes)", size)}
+	}
+
+	if c.Algorithm == AlgorithmRabin {
+		switch {
+		case c.WindowSize <= 0 || c.WindowSize > c.MinChunkSize:
+			return &ParamError{Name: "WindowSize", Value: c.WindowSize, Reason: "must be positive and at most MinChunkSize"}
+		case c.Prime <= 1:
+			return &ParamError{Name: "Prime", Value: c.Prime, Reason: "must be greater than 1"}
+		}
+	}
+	return nil
+}
+
+// resolve provides the config to use, with the defaults set, or an error if it's invalid
+func (c *Config) resolve() (*Config, error) {
+	if c == nil {
+		return nil, &ParamError{Name: "cfg", Value: c, Reason: "must not be nil"}
+	}
+	cfg := c.withDefaults()
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// newHash provides the hash of the chunks, an HMAC with the keyed chunking
+func (c *Config) newHash() hash.Hash {
+	if len(c.Key) > 0 {
+		return hmac.New(c.HashFn, c.Key)
+	}
+	return c.HashFn()
+}
+
+// gearTable provides the gear table, derived from the key with the keyed chunking
+func (c *Config) gearTable() *gearTable {
+	if len(c.Key) > 0 {
+		return newKeyedGearTable(c.Key)
+	}
+	return defaultGearTable
+}
+
+// rabinConfig provides the config equivalent to the positional chunking parameters. The expected chunk size of
+// the Rabin fingerprint is minChunkSize+divisor, so that's the average chunk size.
+func rabinConfig(hashFn func() hash.Hash, minChunkSize, divisor, prime int64) (*Config, error) {
+	if hashFn == nil {
+		return nil, &ParamError{Name: "hashFn", Value: hashFn, Reason: "must not be nil"}
+	}
+	if err := validateChunkingParams(minChunkSize, divisor, prime); err != nil {
+		return nil, err
+	}
+
+	return &Config{
+		HashFn:       hashFn,
+		Algorithm:    AlgorithmRabin,
+		WindowSize:   minChunkSize,
+		MinChunkSize: minChunkSize,
+		AvgChunkSize: minChunkSize + divisor,
+		Prime:        prime,
+	}, nil
+}
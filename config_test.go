@@ -0,0 +1,293 @@
+package godiff_test
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/mihailozarinschi/godiff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// randomData provides reproducible random data
+func randomData(seed int64, size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func TestPresetConfig(t *testing.T) {
+	for _, preset := range []string{godiff.PresetText, godiff.PresetBinary, godiff.PresetLargeFiles} {
+		t.Run(preset, func(t *testing.T) {
+			cfg, err := godiff.PresetConfig(preset)
+			require.NoError(t, err)
+			assert.NotNil(t, cfg.HashFn)
+			assert.Less(t, cfg.MinChunkSize, cfg.AvgChunkSize)
+			assert.LessOrEqual(t, cfg.AvgChunkSize, cfg.MaxChunkSize)
+
+			_, err = godiff.ChunkDataWithConfig(bytes.NewReader(randomData(1, 1024)), cfg)
+			assert.NoError(t, err)
+		})
+	}
+
+	_, err := godiff.PresetConfig("unknown")
+	assert.ErrorIs(t, err, godiff.ErrInvalidParams)
+}
+
+func TestConfigInvalid(t *testing.T) {
+	tt := []struct {
+		name  string
+		cfg   *godiff.Config
+		param string
+	}{
+		{
+			name:  "nil config",
+			cfg:   nil,
+			param: "cfg",
+		},
+		{
+			name:  "unknown algorithm",
+			cfg:   &godiff.Config{Algorithm: 42},
+			param: "Algorithm",
+		},
+		{
+			name:  "unknown refinement mode",
+			cfg:   &godiff.Config{Refinement: 42},
+			param: "Refinement",
+		},
+		{
+			name:  "negative min chunk size",
+			cfg:   &godiff.Config{MinChunkSize: -1},
+			param: "MinChunkSize",
+		},
+		{
+			name:  "average chunk size smaller than the min",
+			cfg:   &godiff.Config{MinChunkSize: 1024, AvgChunkSize: 512},
+			param: "AvgChunkSize",
+		},
+		{
+			name:  "max chunk size smaller than the average",
+			cfg:   &godiff.Config{AvgChunkSize: 1024, MaxChunkSize: 512},
+			param: "MaxChunkSize",
+		},
+		{
+			name:  "strong hash longer than the hash",
+			cfg:   &godiff.Config{StrongHashLen: 33},
+			param: "StrongHashLen",
+		},
+		{
+			name:  "rabin window bigger than the min chunk size",
+			cfg:   &godiff.Config{Algorithm: godiff.AlgorithmRabin, WindowSize: 64, MinChunkSize: 16, AvgChunkSize: 32},
+			param: "WindowSize",
+		},
+		{
+			name:  "rabin prime of 1",
+			cfg:   &godiff.Config{Algorithm: godiff.AlgorithmRabin, Prime: 1},
+			param: "Prime",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := godiff.ChunkDataWithConfig(bytes.NewReader(nil), tc.cfg)
+			require.ErrorIs(t, err, godiff.ErrInvalidParams)
+
+			var paramErr *godiff.ParamError
+			require.ErrorAs(t, err, &paramErr)
+			assert.Equal(t, tc.param, paramErr.Name)
+		})
+	}
+}
+
+func TestChunkDataWithConfig(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "original.txt"))
+	require.NoError(t, err)
+
+	t.Run("rabin, same as the positional parameters", func(t *testing.T) {
+		expected, err := godiff.ChunkData(bytes.NewReader(data), sha1.New(), 4, 16, 7)
+		require.NoError(t, err)
+
+		chunks, err := godiff.ChunkDataWithConfig(bytes.NewReader(data), &godiff.Config{
+			HashFn:       sha1.New,
+			Algorithm:    godiff.AlgorithmRabin,
+			MinChunkSize: 4,
+			AvgChunkSize: 4 + 16,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, expected, chunks)
+	})
+
+	tt := []struct {
+		name string
+		cfg  *godiff.Config
+	}{
+		{
+			name: "rabin, with a max chunk size",
+			cfg:  &godiff.Config{Algorithm: godiff.AlgorithmRabin, WindowSize: 8, MinChunkSize: 16, AvgChunkSize: 64, MaxChunkSize: 96},
+		},
+		{
+			name: "gear",
+			cfg:  &godiff.Config{MinChunkSize: 64, AvgChunkSize: 256, MaxChunkSize: 1024},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			data := randomData(1, 64*1024)
+			chunks, err := godiff.ChunkDataWithConfig(bytes.NewReader(data), tc.cfg)
+			require.NoError(t, err)
+			require.NotEmpty(t, chunks)
+
+			// The chunks cover all the data, and their sizes are within the limits, except for the last one
+			var offset int64
+			for i, chunk := range chunks {
+				assert.Equal(t, offset, chunk.DataOffset)
+				assert.LessOrEqual(t, chunk.DataLen, tc.cfg.MaxChunkSize)
+				if i < len(chunks)-1 {
+					assert.GreaterOrEqual(t, chunk.DataLen, tc.cfg.MinChunkSize)
+				}
+				offset += chunk.DataLen
+			}
+			assert.Equal(t, int64(len(data)), offset)
+
+			// Breakpoints are content based, an insertion only changes the chunks around it
+			updated := append(append(append([]byte{}, data[:32*1024]...), "inserted"...), data[32*1024:]...)
+			updatedChunks, err := godiff.ChunkDataWithConfig(bytes.NewReader(updated), tc.cfg)
+			require.NoError(t, err)
+
+			deltas, err := godiff.GetChunksDeltas(chunks, updatedChunks)
+			require.NoError(t, err)
+			assert.LessOrEqual(t, len(deltas), 6)
+		})
+	}
+}
+
+func TestCalcDiffsWithConfig(t *testing.T) {
+	original := randomData(2, 256*1024)
+	updated := append([]byte{}, original...)
+	updated[1000] ^= 0xFF
+	updated = append(updated[:100*1024], append([]byte("inserted"), updated[100*1024:]...)...)
+	updated = append(updated[:200*1024], updated[210*1024:]...)
+
+	tt := []struct {
+		name string
+		cfg  *godiff.Config
+		// Max size of the data added by the diffs
+		maxAdded int64
+	}{
+		{
+			name:     "default",
+			cfg:      godiff.DefaultConfig(),
+			maxAdded: 3 * 64 * 1024,
+		},
+		{
+			name:     "text preset (refined)",
+			cfg:      mustPresetConfig(t, godiff.PresetText),
+			maxAdded: 1 + len64("inserted"),
+		},
+		{
+			name:     "refined rabin",
+			cfg:      &godiff.Config{Algorithm: godiff.AlgorithmRabin, MinChunkSize: 16, AvgChunkSize: 512, Refinement: godiff.RefinementBytes},
+			maxAdded: 1 + len64("inserted"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			diffs, err := godiff.CalcDiffsWithConfig(bytes.NewReader(original), bytes.NewReader(updated), tc.cfg)
+			require.NoError(t, err)
+
+			var added int64
+			for _, diff := range diffs {
+				if diff.Type == godiff.DeltaTypeAdd {
+					added += diff.DataLen
+				}
+			}
+			assert.LessOrEqual(t, added, tc.maxAdded)
+
+			var patched bytes.Buffer
+			require.NoError(t, godiff.Patch(bytes.NewReader(original), diffs, &patched))
+			assert.Equal(t, updated, patched.Bytes())
+
+			inverted, err := godiff.Invert(diffs)
+			require.NoError(t, err)
+			patched.Reset()
+			require.NoError(t, godiff.Patch(bytes.NewReader(updated), inverted, &patched))
+			assert.Equal(t, original, patched.Bytes())
+		})
+	}
+}
+
+func TestKeyedChunking(t *testing.T) {
+	original := randomData(4, 128*1024)
+	updated := append(append(append([]byte{}, original[:64*1024]...), "inserted"...), original[64*1024:]...)
+
+	key := []byte("0123456789abcdef")
+	cfg := &godiff.Config{MinChunkSize: 256, AvgChunkSize: 1024, Key: key}
+
+	chunks, err := godiff.ChunkDataWithConfig(bytes.NewReader(original), cfg)
+	require.NoError(t, err)
+
+	// The hashes are HMACs of the chunks' data
+	for _, chunk := range chunks {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(original[chunk.DataOffset : chunk.DataOffset+chunk.DataLen])
+		require.Equal(t, hex.EncodeToString(mac.Sum(nil)), chunk.Hash)
+	}
+
+	// Without the key, or with another one, neither the breakpoints nor the hashes match
+	for _, other := range []*godiff.Config{
+		{MinChunkSize: 256, AvgChunkSize: 1024},
+		{MinChunkSize: 256, AvgChunkSize: 1024, Key: []byte("fedcba9876543210")},
+	} {
+		otherChunks, err := godiff.ChunkDataWithConfig(bytes.NewReader(original), other)
+		require.NoError(t, err)
+
+		offsets := make(map[int64]bool)
+		for _, chunk := range chunks {
+			offsets[chunk.DataOffset+chunk.DataLen] = true
+		}
+		var sameBreakpoints int
+		for _, chunk := range otherChunks {
+			if offsets[chunk.DataOffset+chunk.DataLen] {
+				sameBreakpoints++
+			}
+		}
+		assert.Less(t, sameBreakpoints, len(otherChunks)/4)
+		assert.NotEqual(t, chunks[0].Hash, otherChunks[0].Hash)
+	}
+
+	// Diffs still work with the same key on both sides
+	diffs, err := godiff.CalcDiffsWithConfig(bytes.NewReader(original), bytes.NewReader(updated), cfg)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(diffs), 6)
+
+	var patched bytes.Buffer
+	require.NoError(t, godiff.Patch(bytes.NewReader(original), diffs, &patched))
+	assert.Equal(t, updated, patched.Bytes())
+
+	// Keys that are too short, or not supported by the algorithm
+	for _, invalid := range []*godiff.Config{
+		{Key: []byte("short")},
+		{Algorithm: godiff.AlgorithmRabin, Key: key},
+	} {
+		_, err = godiff.ChunkDataWithConfig(bytes.NewReader(original), invalid)
+		assert.ErrorIs(t, err, godiff.ErrInvalidParams)
+	}
+}
+
+func mustPresetConfig(t *testing.T, preset string) *godiff.Config {
+	cfg, err := godiff.PresetConfig(preset)
+	require.NoError(t, err)
+	return cfg
+}
+
+func len64(s string) int64 {
+	return int64(len(s))
+}
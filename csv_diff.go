@@ -0,0 +1,433 @@
+package godiff
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CSVChangeType tells whether a row was removed, added or modified
+type CSVChangeType int
+
+const (
+	CSVRowRemoved CSVChangeType = iota
+	CSVRowAdded
+	CSVRowModified
+)
+
+func (t CSVChangeType) String() string {
+	switch t {
+	case CSVRowRemoved:
+		return "Removed"
+	case CSVRowAdded:
+		return "Added"
+	case CSVRowModified:
+		return "Modified"
+	default:
+		return ""
+	}
+}
+
+// CSVOptions tells how to read the CSV files and identify their rows
+type CSVOptions struct {
+	KeyColumns []string // Names of the columns whose values identify a row, they must be unique
+	Comma      rune     // Field delimiter, ',' if zero
+}
+
+// CSVRowChange is a row removed from the original CSV file, added to the updated one, or modified
+type CSVRowChange struct {
+	Type     CSVChangeType
+	Key      []string         // Values of the key columns
+	Original []string         // Original row, nil if added
+	Updated  []string         // Updated row, nil if removed
+	Cells    []*CSVCellChange // Cells that changed, if modified
+}
+
+// CSVCellChange is a cell of a modified row that changed. A column missing from one of the files has empty cells.
+type CSVCellChange struct {
+	Column   string
+	Original string
+	Updated  string
+}
+
+// DiffCSV provides the rows removed, added and modified between 2 CSV files (with a header), whose rows are
+// identified by the values of their key columns
+func DiffCSV(original, updated io.ReaderAt, opts *CSVOptions, cfg *Config) ([]*CSVRowChange, error) {
+	var changes []*CSVRowChange
+	err := DiffCSVFunc(original, updated, opts, cfg, func(change *CSVRowChange) error {
+		changes = append(changes, change)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// DiffCSVFunc works like DiffCSV, calling fn with each change instead: the added and modified rows in the order of
+// the updated file, then the removed rows in the order of the original file. If fn returns an error, it's returned
+// as it is.
+//
+// The files are streamed, they don't need to fit in memory. When both have the same header, they're chunked with
+// cfg first, and the rows within the chunks found in both files (or within 2 chunks following each other in both)
+// are the same in both, as long as the chunks' first rows start at the same offset in both: they're skipped. The
+// memory used grows with the number of chunks and of rows not skipped, not with the size of the files: the other
+// original rows are kept until compared with the updated ones, along with the keys of the other updated rows.
+// The duplicate keys are only detected among these rows, the skipped ones are the same in both files anyway.
+func DiffCSVFunc(original, updated io.ReaderAt, opts *CSVOptions, cfg *Config, fn func(change *CSVRowChange) error) error {
+	cfg, err := cfg.resolve()
+	if err != nil {
+		return err
+	}
+	if opts == nil || len(opts.KeyColumns) == 0 {
+		return &ParamError{Name: "opts", Value: opts, Reason: "must have at least 1 key column"}
+	}
+
+	originalScanner, err := newCSVScanner(original, opts)
+	if err != nil {
+		return fmt.Errorf("error reading original CSV: %w", err)
+	}
+	updatedScanner, err := newCSVScanner(updated, opts)
+	if err != nil {
+		return fmt.Errorf("error reading updated CSV: %w", err)
+	}
+
+	// The same bytes are only the same rows if they're read the same way: with the same columns, from a row start
+	var originalChunks, updatedChunks []*Chunk
+	var updatedStarts []int64
+	prefilter := csvSameHeader(originalScanner.header, updatedScanner.header)
+	if prefilter {
+		if originalChunks, err = ChunkDataWithConfig(io.NewSectionReader(original, 0, 1<<62), cfg); err != nil {
+			return fmt.Errorf("error chunking original CSV: %w", err)
+		}
+		if updatedChunks, err = ChunkDataWithConfig(io.NewSectionReader(updated, 0, 1<<62), cfg); err != nil {
+			return fmt.Errorf("error chunking updated CSV: %w", err)
+		}
+		if updatedStarts, err = csvRowStarts(updated, opts, updatedChunks); err != nil {
+			return fmt.Errorf("error reading updated CSV: %w", err)
+		}
+		originalScanner.shared = newSharedChunks(originalChunks, updatedChunks, updatedStarts)
+		originalScanner.shared.rowStart(0) // The header
+	}
+
+	// The original rows that could have changed, by key
+	rows := make(map[string]*csvRow)
+	var order []string
+	err = originalScanner.scan(func(row *csvRow) error {
+		if row.shared {
+			return nil
+		}
+		if _, ok := rows[row.key]; ok {
+			return fmt.Errorf("duplicate key %s at line %d: %w", row.key, row.line, ErrInvalidFormat)
+		}
+		rows[row.key] = row
+		order = append(order, row.key)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error reading original CSV: %w", err)
+	}
+
+	if prefilter {
+		updatedScanner.shared = newSharedChunks(updatedChunks, originalChunks, originalScanner.shared.starts)
+		updatedScanner.shared.rowStart(0)
+	}
+	columns := csvColumns(originalScanner.header, updatedScanner.header)
+	seen := make(map[string]bool)
+
+	var fnErr error
+	err = updatedScanner.scan(func(row *csvRow) error {
+		if row.shared {
+			return nil
+		}
+		if seen[row.key] {
+			return fmt.Errorf("duplicate key %s at line %d: %w", row.key, row.line, ErrInvalidFormat)
+		}
+		seen[row.key] = true
+
+		change := &CSVRowChange{Type: CSVRowAdded, Key: row.keyValues, Updated: row.record}
+		if originalRow, ok := rows[row.key]; ok {
+			delete(rows, row.key)
+			change.Type, change.Original = CSVRowModified, originalRow.record
+			change.Cells = diffCSVCells(columns, originalRow.record, row.record)
+			if len(change.Cells) == 0 {
+				return nil
+			}
+		}
+		fnErr = fn(change)
+		return fnErr
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	if err != nil {
+		return fmt.Errorf("error reading updated CSV: %w", err)
+	}
+
+	for _, key := range order {
+		if row, ok := rows[key]; ok {
+			if err = fn(&CSVRowChange{Type: CSVRowRemoved, Key: row.keyValues, Original: row.record}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type csvRow struct {
+	key       string // Key values, quoted
+	keyValues []string
+	record    []string
+	line      int
+	shared    bool // Whether the row is within shared chunks, so the same row is in the other file
+}
+
+// csvScanner reads the rows of a CSV file, telling the ones also in the other file
+type csvScanner struct {
+	data       io.ReaderAt
+	r          *csv.Reader
+	shared     *sharedChunks // nil if the rows aren't compared to the other file's chunks
+	header     []string
+	keyIndexes []int
+}
+
+func newCSVReader(data io.ReaderAt, opts *CSVOptions) *csv.Reader {
+	r := csv.NewReader(io.NewSectionReader(data, 0, 1<<62))
+	if opts.Comma != 0 {
+		r.Comma = opts.Comma
+	}
+	return r
+}
+
+func newCSVScanner(data io.ReaderAt, opts *CSVOptions) (*csvScanner, error) {
+	r := newCSVReader(data, opts)
+	header, err := r.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("missing header: %w", ErrInvalidFormat)
+		}
+		return nil, fmt.Errorf("invalid header (%s): %w", err, ErrInvalidFormat)
+	}
+
+	s := &csvScanner{data: data, r: r, header: header}
+	for _, column := range opts.KeyColumns {
+		index := -1
+		for i, name := range header {
+			if name == column {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return nil, &ParamError{Name: "KeyColumns", Value: opts.KeyColumns, Reason: fmt.Sprintf("column %q isn't in the header", column)}
+		}
+		s.keyIndexes = append(s.keyIndexes, index)
+	}
+	return s, nil
+}
+
+// scan calls fn with all the rows, telling the ones within shared chunks
+func (s *csvScanner) scan(fn func(row *csvRow) error) error {
+	for {
+		start := s.r.InputOffset()
+		record, err := s.r.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid row (%s): %w", err, ErrInvalidFormat)
+		}
+
+		line, _ := s.r.FieldPos(0)
+		row := &csvRow{record: record, line: line}
+		if s.shared != nil {
+			s.shared.rowStart(start)
+			if row.shared, err = s.sharedRow(start, s.r.InputOffset()); err != nil {
+				return err
+			}
+		}
+		quoted := make([]string, len(s.keyIndexes))
+		for i, index := range s.keyIndexes {
+			row.keyValues = append(row.keyValues, record[index])
+			quoted[i] = strconv.Quote(record[index])
+		}
+		row.key = strings.Join(quoted, ",")
+
+		if err = fn(row); err != nil {
+			return err
+		}
+	}
+}
+
+// sharedRow tells whether the row [start, end) is within shared chunks. A row ending with the chunks must end with
+// a line break, or it goes on with whatever follows them in the other file.
+func (s *csvScanner) sharedRow(start, end int64) (bool, error) {
+	sharedEnd := s.shared.end(start)
+	if end != sharedEnd {
+		return end < sharedEnd, nil
+	}
+
+	var last [1]byte
+	if _, err := s.data.ReadAt(last[:], end-1); err != nil {
+		return false, fmt.Errorf("error reading row end: %w", err)
+	}
+	return last[0] == '\n', nil
+}
+
+// csvSameHeader tells whether both files have the same columns, in the same order
+func csvSameHeader(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// csvRowStarts provides the offset of the first row (or the header) starting within each chunk of the CSV file, -1
+// if none
+func csvRowStarts(data io.ReaderAt, opts *CSVOptions, chunks []*Chunk) ([]int64, error) {
+	s := newSharedChunks(chunks, nil, nil)
+	r := newCSVReader(data, opts)
+	for {
+		s.rowStart(r.InputOffset())
+		if _, err := r.Read(); err != nil {
+			if errors.Is(err, io.EOF) {
+				return s.starts, nil
+			}
+			return nil, fmt.Errorf("invalid row (%s): %w", err, ErrInvalidFormat)
+		}
+	}
+}
+
+// sharedChunks tells whether some bytes of a file are also in another file, as they're within a chunk also in the
+// other file, or within 2 chunks also following each other in it. The bytes are only read the same way in both if
+// they're read from a row start in both: the (first) chunk's first row must start at the same offset within it in
+// both files. The other file's row starts are known upfront, while this file's ones are provided as it's read.
+type sharedChunks struct {
+	chunks     []*Chunk
+	starts     []int64 // Offset of the first row starting within each chunk, -1 if none (so far)
+	others     map[sharedChunk]bool
+	otherPairs map[sharedChunkPair]bool
+	next       int // Index of the chunk looked up last, as the lookups are in order
+	nextStart  int // Index of the chunk of the row start provided last
+}
+
+// sharedChunk is a chunk, with the offset of its first row start
+type sharedChunk struct {
+	key   chunkKey
+	start int64
+}
+
+// sharedChunkPair is a chunk followed by another one, with the offset of the first one's first row start
+type sharedChunkPair struct {
+	first, second chunkKey
+	start         int64
+}
+
+func newSharedChunks(chunks, other []*Chunk, otherStarts []int64) *sharedChunks {
+	s := &sharedChunks{
+		chunks:     chunks,
+		starts:     make([]int64, len(chunks)),
+		others:     make(map[sharedChunk]bool, len(other)),
+		otherPairs: make(map[sharedChunkPair]bool, len(other)),
+	}
+	for i, chunk := range other {
+		if otherStarts[i] < 0 {
+			continue
+		}
+		s.others[sharedChunk{key: keyOf(chunk), start: otherStarts[i]}] = true
+		if i+1 < len(other) {
+			s.otherPairs[sharedChunkPair{first: keyOf(chunk), second: keyOf(other[i+1]), start: otherStarts[i]}] = true
+		}
+	}
+
+	for i := range s.starts {
+		s.starts[i] = -1
+	}
+	return s
+}
+
+// rowStart records that a row starts at offset. The calls must be in order.
+func (s *sharedChunks) rowStart(offset int64) {
+	for s.nextStart < len(s.chunks) && s.chunks[s.nextStart].DataOffset+s.chunks[s.nextStart].DataLen <= offset {
+		s.nextStart++
+	}
+	if s.nextStart < len(s.chunks) && s.starts[s.nextStart] < 0 {
+		s.starts[s.nextStart] = offset - s.chunks[s.nextStart].DataOffset
+	}
+}
+
+// end provides the end of the bytes from the row start that are also in the other file, start if none. The lookups
+// must be in order, after the row start was recorded.
+func (s *sharedChunks) end(start int64) int64 {
+	for s.next < len(s.chunks) && s.chunks[s.next].DataOffset+s.chunks[s.next].DataLen <= start {
+		s.next++
+	}
+	i := s.next
+	if i == len(s.chunks) || !s.others[sharedChunk{key: keyOf(s.chunks[i]), start: s.starts[i]}] {
+		return start
+	}
+	if i+1 < len(s.chunks) && s.otherPairs[sharedChunkPair{first: keyOf(s.chunks[i]), second: keyOf(s.chunks[i+1]), start: s.starts[i]}] {
+		return s.chunks[i+1].DataOffset + s.chunks[i+1].DataLen
+	}
+	return s.chunks[i].DataOffset + s.chunks[i].DataLen
+}
+
+// csvColumn is a column of the original and/or updated file, with its index in each (-1 if missing)
+type csvColumn struct {
+	name              string
+	original, updated int
+}
+
+// csvColumns provides the columns of both files: the original ones, then the new ones
+func csvColumns(originalHeader, updatedHeader []string) []csvColumn {
+	var columns []csvColumn
+	updatedIndexes := make(map[string]int, len(updatedHeader))
+	for i := len(updatedHeader) - 1; i >= 0; i-- {
+		updatedIndexes[updatedHeader[i]] = i
+	}
+	originalNames := make(map[string]bool, len(originalHeader))
+
+	for i, name := range originalHeader {
+		if originalNames[name] {
+			continue
+		}
+		originalNames[name] = true
+		column := csvColumn{name: name, original: i, updated: -1}
+		if j, ok := updatedIndexes[name]; ok {
+			column.updated = j
+		}
+		columns = append(columns, column)
+	}
+	for j, name := range updatedHeader {
+		if !originalNames[name] {
+			originalNames[name] = true
+			columns = append(columns, csvColumn{name: name, original: -1, updated: j})
+		}
+	}
+	return columns
+}
+
+func diffCSVCells(columns []csvColumn, original, updated []string) []*CSVCellChange {
+	var cells []*CSVCellChange
+	for _, column := range columns {
+		var o, u string
+		if column.original >= 0 {
+			o = original[column.original]
+		}
+		if column.updated >= 0 {
+			u = updated[column.updated]
+		}
+		if o != u {
+			cells = append(cells, &CSVCellChange{Column: column.name, Original: o, Updated: u})
+		}
+	}
+	return cells
+}
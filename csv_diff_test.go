@@ -0,0 +1,244 @@
+package godiff_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/mihailozarinschi/godiff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestDiffCSV(t *testing.T) {
+	cfg := &godiff.Config{AvgChunkSize: 1024}
+	opts := &godiff.CSVOptions{KeyColumns: []string{"id"}}
+
+	tt := []struct {
+		name     string
+		original string
+		updated  string
+		opts     *godiff.CSVOptions
+		changes  []*godiff.CSVRowChange
+	}{
+		{
+			name:     "rows",
+			original: "id,name,qty\n1,apple,3\n2,pear,5\n3,plum,7\n",
+			updated:  "id,name,qty\n1,apple,3\n3,plum,8\n4,fig,1\n",
+			changes: []*godiff.CSVRowChange{
+				{
+					Type: godiff.CSVRowModified, Key: []string{"3"},
+					Original: []string{"3", "plum", "7"}, Updated: []string{"3", "plum", "8"},
+					Cells: []*godiff.CSVCellChange{{Column: "qty", Original: "7", Updated: "8"}},
+				},
+				{Type: godiff.CSVRowAdded, Key: []string{"4"}, Updated: []string{"4", "fig", "1"}},
+				{Type: godiff.CSVRowRemoved, Key: []string{"2"}, Original: []string{"2", "pear", "5"}},
+			},
+		},
+		{
+			name:     "reordered and requoted rows",
+			original: "id,name\n1,apple\n2,\"pear\"\n",
+			updated:  "id,name\n2,pear\n1,apple\n",
+		},
+		{
+			name:     "columns",
+			original: "id,name,qty\n1,apple,3\n",
+			updated:  "qty,id,color\n3,1,red\n",
+			changes: []*godiff.CSVRowChange{
+				{
+					Type: godiff.CSVRowModified, Key: []string{"1"},
+					Original: []string{"1", "apple", "3"}, Updated: []string{"3", "1", "red"},
+					Cells: []*godiff.CSVCellChange{
+						{Column: "name", Original: "apple"},
+						{Column: "color", Updated: "red"},
+					},
+				},
+			},
+		},
+		{
+			name:     "composite key and quoted fields",
+			original: "region;id;note\neu;1;\"multi\nline\"\nus;1;a\n",
+			updated:  "region;id;note\neu;1;\"multi\nline; changed\"\nus;1;a\n",
+			opts:     &godiff.CSVOptions{KeyColumns: []string{"region", "id"}, Comma: ';'},
+			changes: []*godiff.CSVRowChange{
+				{
+					Type: godiff.CSVRowModified, Key: []string{"eu", "1"},
+					Original: []string{"eu", "1", "multi\nline"}, Updated: []string{"eu", "1", "multi\nline; changed"},
+					Cells: []*godiff.CSVCellChange{{Column: "note", Original: "multi\nline", Updated: "multi\nline; changed"}},
+				},
+			},
+		},
+		{
+			name:     "empty files",
+			original: "id\n",
+			updated:  "id\n",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			o := opts
+			if tc.opts != nil {
+				o = tc.opts
+			}
+			changes, err := godiff.DiffCSV(strings.NewReader(tc.original), strings.NewReader(tc.updated), o, cfg)
+			require.NoError(t, err)
+			assert.Equal(t, tc.changes, changes)
+		})
+	}
+}
+
+func TestDiffCSVLarge(t *testing.T) {
+	cfg := &godiff.Config{AvgChunkSize: 4 * 1024}
+	opts := &godiff.CSVOptions{KeyColumns: []string{"id"}}
+
+	var original, updated bytes.Buffer
+	original.WriteString("id,name,value\n")
+	updated.WriteString("id,name,value\n")
+	for i := 0; i < 20000; i++ {
+		row := fmt.Sprintf("%d,name-%d,%d\n", i, i, i*7%1000)
+		original.WriteString(row)
+		switch {
+		case i%5000 == 100:
+			// Removed
+		case i%5000 == 200:
+			updated.WriteString(fmt.Sprintf("%d,name-%d,changed\n", i, i))
+		default:
+			updated.WriteString(row)
+		}
+	}
+	updated.WriteString("20000,new,0\n")
+
+	// Only the changed rows are reported, the other rows are skipped without being compared
+	var changes []*godiff.CSVRowChange
+	err := godiff.DiffCSVFunc(bytes.NewReader(original.Bytes()), bytes.NewReader(updated.Bytes()), opts, cfg, func(change *godiff.CSVRowChange) error {
+		changes = append(changes, change)
+		return nil
+	})
+	require.NoError(t, err)
+
+	var modified, added, removed []string
+	for _, change := range changes {
+		switch change.Type {
+		case godiff.CSVRowModified:
+			modified = append(modified, change.Key[0])
+		case godiff.CSVRowAdded:
+			added = append(added, change.Key[0])
+		case godiff.CSVRowRemoved:
+			removed = append(removed, change.Key[0])
+		}
+	}
+	assert.Equal(t, []string{"200", "5200", "10200", "15200"}, modified)
+	assert.Equal(t, []string{"20000"}, added)
+	assert.Equal(t, []string{"100", "5100", "10100", "15100"}, removed)
+
+	// Errors of fn are returned as they are
+	errStop := errors.New("stop")
+	err = godiff.DiffCSVFunc(bytes.NewReader(original.Bytes()), bytes.NewReader(updated.Bytes()), opts, cfg, func(*godiff.CSVRowChange) error {
+		return errStop
+	})
+	assert.Equal(t, errStop, err)
+}
+
+func TestDiffCSVLargeColumns(t *testing.T) {
+	cfg := &godiff.Config{AvgChunkSize: 4 * 1024}
+	opts := &godiff.CSVOptions{KeyColumns: []string{"id"}}
+
+	var rows bytes.Buffer
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&rows, "%d,%d,%d\n", i, i%7, i%11)
+	}
+
+	tt := []struct {
+		name          string
+		updatedHeader string
+		cells         []string
+	}{
+		{name: "reordered columns", updatedHeader: "id,y,x\n", cells: []string{"x", "y"}},
+		{name: "renamed column", updatedHeader: "id,x,z\n", cells: []string{"y", "z"}},
+	}
+
+	// The same bytes hold different cells, all the rows are compared
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			original := "id,x,y\n" + rows.String()
+			updated := tc.updatedHeader + rows.String()
+			changes, err := godiff.DiffCSV(strings.NewReader(original), strings.NewReader(updated), opts, cfg)
+			require.NoError(t, err)
+
+			var modified int
+			for _, change := range changes {
+				var cells []string
+				for _, cell := range change.Cells {
+					cells = append(cells, cell.Column)
+				}
+				if change.Type == godiff.CSVRowModified && assert.Equal(t, tc.cells, cells) {
+					modified++
+				}
+			}
+			// The rows whose cells are the same in both columns haven't changed
+			assert.Greater(t, modified, 15000)
+			assert.Equal(t, len(changes), modified)
+		})
+	}
+}
+
+func TestDiffCSVLargeQuoted(t *testing.T) {
+	cfg := &godiff.Config{AvgChunkSize: 1024}
+	opts := &godiff.CSVOptions{KeyColumns: []string{"id"}}
+
+	var lines bytes.Buffer
+	for i := 1; i <= 2000; i++ {
+		fmt.Fprintf(&lines, "%d,line-%d\n", i, i)
+	}
+
+	// The same bytes are a single quoted cell of the original, and rows of the updated file
+	original := "id,note\n0,\"" + lines.String() + "\"\n"
+	updated := "id,note\n" + lines.String()
+	changes, err := godiff.DiffCSV(strings.NewReader(original), strings.NewReader(updated), opts, cfg)
+	require.NoError(t, err)
+	require.Len(t, changes, 2001)
+	for i, change := range changes[:2000] {
+		assert.Equal(t, godiff.CSVRowAdded, change.Type)
+		assert.Equal(t, []string{fmt.Sprint(i + 1)}, change.Key)
+	}
+	assert.Equal(t, godiff.CSVRowRemoved, changes[2000].Type)
+	assert.Equal(t, []string{"0"}, changes[2000].Key)
+
+	// Duplicate keys are found among the rows not skipped
+	duplicated := "id,note\n" + strings.Replace(lines.String(), "1,line-1\n", "1,changed\n", 1) + "1,again\n"
+	_, err = godiff.DiffCSV(strings.NewReader(updated), strings.NewReader(duplicated), opts, cfg)
+	assert.ErrorIs(t, err, godiff.ErrInvalidFormat)
+}
+
+func TestDiffCSVInvalid(t *testing.T) {
+	cfg := &godiff.Config{AvgChunkSize: 1024}
+	opts := &godiff.CSVOptions{KeyColumns: []string{"id"}}
+
+	tt := []struct {
+		name     string
+		original string
+		updated  string
+		opts     *godiff.CSVOptions
+		expected error
+	}{
+		{name: "no key column", original: "id\n1\n", updated: "id\n1\n", opts: &godiff.CSVOptions{}, expected: godiff.ErrInvalidParams},
+		{name: "missing key column", original: "id\n1\n", updated: "name\na\n", expected: godiff.ErrInvalidParams},
+		{name: "missing header", original: "", updated: "id\n1\n", expected: godiff.ErrInvalidFormat},
+		{name: "duplicate original key", original: "id\n1\n1\n", updated: "id\n2\n", expected: godiff.ErrInvalidFormat},
+		{name: "duplicate updated key", original: "id\n1\n", updated: "id\n2\n2\n", expected: godiff.ErrInvalidFormat},
+		{name: "invalid row", original: "id,name\n1,a\n", updated: "id,name\n1,a,b\n", expected: godiff.ErrInvalidFormat},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			o := opts
+			if tc.opts != nil {
+				o = tc.opts
+			}
+			_, err := godiff.DiffCSV(strings.NewReader(tc.original), strings.NewReader(tc.updated), o, cfg)
+			assert.ErrorIs(t, err, tc.expected)
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package godiff
 
 import (
+	"fmt"
 	"sort"
 )
 
@@ -30,16 +31,42 @@ type ChunkDelta struct {
 	Position int
 }
 
-// GetChunksDeltas tries to provide the minimum amount of deltas between any 2 given slices of chunks.
-// It navigates through both slices at the same time, when chunks start to diverge, it keeps track of
+// SliceDelta is the removal of an element of the original slice, or the addition of an element of the updated
+// slice, at its position in that slice
+type SliceDelta[T any] struct {
+	Value    T
+	Type     DeltaType
+	Position int
+}
+
+// GetChunksDeltas tries to provide the minimum amount of deltas between any 2 given slices of chunks,
+// comparing them by their hashes (see DiffSlicesFunc).
+func GetChunksDeltas(original, updated []*Chunk) ([]*ChunkDelta, error) {
+	sliceDeltas := DiffSlicesFunc(original, updated, keyOf)
+
+	deltas := make([]*ChunkDelta, len(sliceDeltas))
+	for i, d := range sliceDeltas {
+		deltas[i] = &ChunkDelta{Chunk: d.Value, Type: d.Type, Position: d.Position}
+	}
+	return deltas, nil
+}
+
+// DiffSlices works like DiffSlicesFunc, comparing the elements themselves (e.g. lines, tokens)
+func DiffSlices[T comparable](original, updated []T) []*SliceDelta[T] {
+	return DiffSlicesFunc(original, updated, func(v T) T { return v })
+}
+
+// DiffSlicesFunc tries to provide the minimum amount of deltas between any 2 given slices, comparing their
+// elements by the key provided by key (e.g. a record's ID and version).
+// It navigates through both slices at the same time, when elements start to diverge, it keeps track of
 // possible ("temporary") removals and/or additions, with each new step forward it checks within the
 // temporary changes for forward and/or backward shifts that happened, and re-positions the cursors accordingly.
-// Finally, it re-orders the deltas in the proper order to be applied/patched on the original data.
+// Finally, it re-orders the deltas in the proper order to be applied/patched on the original slice.
 // The order presumes all removals first, DESC (from end to start), then all additions ASC (from start to end),
-func GetChunksDeltas(original, updated []*Chunk) ([]*ChunkDelta, error) {
+func DiffSlicesFunc[T any, K comparable](original, updated []T, key func(T) K) []*SliceDelta[T] {
 
 	type deltaIndex struct {
-		delta *ChunkDelta
+		delta *SliceDelta[T]
 		index int
 	}
 
@@ -48,83 +75,83 @@ func GetChunksDeltas(original, updated []*Chunk) ([]*ChunkDelta, error) {
 		oc, uc int
 
 		// Temp deltas
-		removals       []*ChunkDelta
-		removalsIndex  = make(map[string]*deltaIndex) // to speedup lookups
-		additions      []*ChunkDelta
-		additionsIndex = make(map[string]*deltaIndex) // to speedup lookups
+		removals       []*SliceDelta[T]
+		removalsIndex  = make(map[K]*deltaIndex) // to speedup lookups
+		additions      []*SliceDelta[T]
+		additionsIndex = make(map[K]*deltaIndex) // to speedup lookups
 
 		// Final deltas
-		deltas []*ChunkDelta
+		deltas []*SliceDelta[T]
 	)
 
+	originalKeys := make([]K, len(original))
+	for i, v := range original {
+		originalKeys[i] = key(v)
+	}
+	updatedKeys := make([]K, len(updated))
+	for i, v := range updated {
+		updatedKeys[i] = key(v)
+	}
+
 	// Loop until both slices are exhausted
 	for oc < len(original) || uc < len(updated) {
+		hasO, hasU := oc < len(original), uc < len(updated)
 
-		var o *Chunk
-		if oc < len(original) {
-			o = original[oc]
-		}
-
-		var u *Chunk
-		if uc < len(updated) {
-			u = updated[uc]
-		}
-
-		// Chunks' hashes are the same
-		if o != nil && u != nil && o.Hash == u.Hash {
+		// Elements' keys are the same
+		if hasO && hasU && originalKeys[oc] == updatedKeys[uc] {
 			// We got to a converging point, all temp changes so far need to be persisted
 			deltas = append(deltas, removals...) // persist removals
 			removals = removals[:0]              // clear temp removals
-			removalsIndex = make(map[string]*deltaIndex)
+			removalsIndex = make(map[K]*deltaIndex)
 
 			deltas = append(deltas, additions...) // persist additions
 			additions = additions[:0]             // clear temp additions
-			additionsIndex = make(map[string]*deltaIndex)
+			additionsIndex = make(map[K]*deltaIndex)
 
 			goto moveCursors
 		}
 
-		// Chunks' hashes differ.
-		// Lookup new chunk in the list of temporarily removed chunks, maybe it was shifted forward
-		if u != nil {
-			rem, ok := removalsIndex[u.Hash]
+		// Elements' keys differ.
+		// Lookup new element in the list of temporarily removed elements, maybe it was shifted forward
+		if hasU {
+			rem, ok := removalsIndex[updatedKeys[uc]]
 			if ok {
-				// New chunk was simply shifted forward by a chunk addition, found it in the list of temp removals.
+				// New element was simply shifted forward by an addition, found it in the list of temp removals.
 				deltas = append(deltas, removals[:rem.index]...) // persist temp removals until this point
 				removals = removals[:0]                          // clear temp removals cache
-				removalsIndex = make(map[string]*deltaIndex)
+				removalsIndex = make(map[K]*deltaIndex)
 				oc = rem.delta.Position // Reset original slice cursor to the found one
 				continue
 			}
 		}
-		// Lookup original chunk in the list of temporarily added chunks, maybe it was shifted backwards
-		if o != nil {
-			add, ok := additionsIndex[o.Hash]
+		// Lookup original element in the list of temporarily added elements, maybe it was shifted backwards
+		if hasO {
+			add, ok := additionsIndex[originalKeys[oc]]
 			if ok {
-				// Original chunk was simply shifted backward by a chunk removal
+				// Original element was simply shifted backward by a removal
 				deltas = append(deltas, additions[:add.index]...) // persist temp additions until this point
 				additions = additions[:0]                         // clear temp additions cache
-				additionsIndex = make(map[string]*deltaIndex)
+				additionsIndex = make(map[K]*deltaIndex)
 				uc = add.delta.Position
 				continue
 			}
 		}
 
 		// No reoccurrence found in the existing temp deltas, add these too.
-		if o != nil {
-			chunkDelta := &ChunkDelta{o, DeltaTypeRemove, oc}
-			removals = append(removals, chunkDelta)
+		if hasO {
+			delta := &SliceDelta[T]{Value: original[oc], Type: DeltaTypeRemove, Position: oc}
+			removals = append(removals, delta)
 			// index only first occurrence
-			if _, ok := removalsIndex[o.Hash]; !ok {
-				removalsIndex[o.Hash] = &deltaIndex{delta: chunkDelta, index: len(removals) - 1}
+			if _, ok := removalsIndex[originalKeys[oc]]; !ok {
+				removalsIndex[originalKeys[oc]] = &deltaIndex{delta: delta, index: len(removals) - 1}
 			}
 		}
-		if u != nil {
-			chunkDelta := &ChunkDelta{u, DeltaTypeAdd, uc}
-			additions = append(additions, chunkDelta)
+		if hasU {
+			delta := &SliceDelta[T]{Value: updated[uc], Type: DeltaTypeAdd, Position: uc}
+			additions = append(additions, delta)
 			// index only first occurrence
-			if _, ok := additionsIndex[u.Hash]; !ok {
-				additionsIndex[u.Hash] = &deltaIndex{delta: chunkDelta, index: len(additions) - 1}
+			if _, ok := additionsIndex[updatedKeys[uc]]; !ok {
+				additionsIndex[updatedKeys[uc]] = &deltaIndex{delta: delta, index: len(additions) - 1}
 			}
 		}
 
@@ -142,12 +169,45 @@ func GetChunksDeltas(original, updated []*Chunk) ([]*ChunkDelta, error) {
 
 	// Set the order in which the deltas should be applied
 	sort.SliceStable(deltas, func(i, j int) bool {
-		di := deltas[i]
-		dj := deltas[j]
-		return di.Type < dj.Type || // Remove (1) < Add (2). Removals before additions
-			(di.Type == DeltaTypeRemove && di.Type == dj.Type && di.Position > dj.Position) || // Sort removals DESC
-			(di.Type == DeltaTypeAdd && di.Type == dj.Type && di.Position < dj.Position) // Sort additions ASC
+		return deltaOrderLess(deltas[i].Type, deltas[i].Position, deltas[j].Type, deltas[j].Position)
 	})
 
-	return deltas, nil
+	return deltas
+}
+
+// ApplySliceDeltas rebuilds the updated slice from the original one and the deltas (as provided by DiffSlices)
+func ApplySliceDeltas[T any](original []T, deltas []*SliceDelta[T]) ([]T, error) {
+	result := append([]T(nil), original...)
+	for _, delta := range deltas {
+		switch delta.Type {
+		case DeltaTypeRemove:
+			if delta.Position < 0 || delta.Position >= len(result) {
+				return nil, fmt.Errorf("removal at %d is out of the %d elements: %w", delta.Position, len(result), ErrInvalidDiffs)
+			}
+			result = append(result[:delta.Position], result[delta.Position+1:]...)
+		case DeltaTypeAdd:
+			if delta.Position < 0 || delta.Position > len(result) {
+				return nil, fmt.Errorf("addition at %d is out of the %d elements: %w", delta.Position, len(result), ErrInvalidDiffs)
+			}
+			var zero T
+			result = append(result, zero)
+			copy(result[delta.Position+1:], result[delta.Position:])
+			result[delta.Position] = delta.Value
+		default:
+			return nil, fmt.Errorf("unknown delta type %d: %w", delta.Type, ErrInvalidDiffs)
+		}
+	}
+	return result, nil
+}
+
+// deltaLess defines the order in which the deltas should be applied
+func deltaLess(di, dj *ChunkDelta) bool {
+	return deltaOrderLess(di.Type, di.Position, dj.Type, dj.Position)
+}
+
+// deltaOrderLess defines the order in which the deltas of any kind should be applied
+func deltaOrderLess(ti DeltaType, pi int, tj DeltaType, pj int) bool {
+	return ti < tj || // Remove (1) < Add (2). Removals before additions
+		(ti == DeltaTypeRemove && ti == tj && pi > pj) || // Sort removals DESC
+		(ti == DeltaTypeAdd && ti == tj && pi < pj) // Sort additions ASC
 }
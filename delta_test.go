@@ -159,3 +159,86 @@ func TestGetChunksDeltas(t *testing.T) {
 		})
 	}
 }
+
+func TestDiffSlices(t *testing.T) {
+	tt := []struct {
+		name     string
+		original string
+		updated  string
+		deltas   []*godiff.SliceDelta[rune]
+	}{
+		{
+			name:     "ABCB-BABC",
+			original: "ABCB",
+			updated:  "BABC",
+			deltas: []*godiff.SliceDelta[rune]{
+				{Value: 'B', Type: godiff.DeltaTypeRemove, Position: 3},
+				{Value: 'B', Type: godiff.DeltaTypeAdd, Position: 0},
+			},
+		},
+		{
+			name:     "BABC-ABCB",
+			original: "BABC",
+			updated:  "ABCB",
+			deltas: []*godiff.SliceDelta[rune]{
+				{Value: 'C', Type: godiff.DeltaTypeRemove, Position: 3},
+				{Value: 'A', Type: godiff.DeltaTypeRemove, Position: 1},
+				{Value: 'A', Type: godiff.DeltaTypeAdd, Position: 0},
+				{Value: 'C', Type: godiff.DeltaTypeAdd, Position: 2},
+			},
+		},
+		{
+			name:     "empty original",
+			original: "",
+			updated:  "AB",
+			deltas: []*godiff.SliceDelta[rune]{
+				{Value: 'A', Type: godiff.DeltaTypeAdd, Position: 0},
+				{Value: 'B', Type: godiff.DeltaTypeAdd, Position: 1},
+			},
+		},
+		{
+			name:     "same",
+			original: "ABC",
+			updated:  "ABC",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			original, updated := []rune(tc.original), []rune(tc.updated)
+			deltas := godiff.DiffSlices(original, updated)
+			assert.Equal(t, tc.deltas, deltas)
+
+			patched, err := godiff.ApplySliceDeltas(original, deltas)
+			require.NoError(t, err)
+			assert.Equal(t, tc.updated, string(patched))
+		})
+	}
+}
+
+func TestDiffSlicesFunc(t *testing.T) {
+	type record struct {
+		ID      int
+		Version int
+		Name    string
+	}
+	original := []record{{1, 1, "a"}, {2, 1, "b"}, {3, 1, "c"}, {4, 1, "d"}}
+	updated := []record{{1, 1, "a"}, {3, 2, "C"}, {4, 1, "d"}, {5, 1, "e"}}
+
+	// Records are compared by ID and version, the other fields don't matter
+	deltas := godiff.DiffSlicesFunc(original, updated, func(r record) [2]int { return [2]int{r.ID, r.Version} })
+	assert.Equal(t, []*godiff.SliceDelta[record]{
+		{Value: record{3, 1, "c"}, Type: godiff.DeltaTypeRemove, Position: 2},
+		{Value: record{2, 1, "b"}, Type: godiff.DeltaTypeRemove, Position: 1},
+		{Value: record{3, 2, "C"}, Type: godiff.DeltaTypeAdd, Position: 1},
+		{Value: record{5, 1, "e"}, Type: godiff.DeltaTypeAdd, Position: 3},
+	}, deltas)
+
+	patched, err := godiff.ApplySliceDeltas(original, deltas)
+	require.NoError(t, err)
+	assert.Equal(t, updated, patched)
+
+	// Deltas not matching the original slice
+	_, err = godiff.ApplySliceDeltas(original[:1], deltas)
+	assert.ErrorIs(t, err, godiff.ErrInvalidDiffs)
+}
@@ -1,8 +1,11 @@
 package godiff
 
 import (
+	"errors"
 	"fmt"
 	"hash"
+	"io"
+	"sort"
 )
 
 // Diff contains everything to know about a specific change between any 2 given inputs of data
@@ -11,49 +14,152 @@ type Diff struct {
 	Data []byte
 }
 
+// LazyDiff is a Diff whose data isn't loaded yet, it's read from the original/updated data only when needed
+type LazyDiff struct {
+	*ChunkDelta
+	data io.ReaderAt
+}
+
+// DataReader provides a reader of the diff's data, straight from the original/updated data
+func (d *LazyDiff) DataReader() io.Reader {
+	return io.NewSectionReader(d.data, d.DataOffset, d.DataLen)
+}
+
+// Load reads the diff's data in memory
+func (d *LazyDiff) Load() (*Diff, error) {
+	diff := &Diff{ChunkDelta: d.ChunkDelta, Data: make([]byte, d.DataLen)}
+	n, err := d.data.ReadAt(diff.Data, d.DataOffset)
+	if n == len(diff.Data) {
+		err = nil // The data was fully read, even if the end of the input was reached too
+	} else if err == nil || errors.Is(err, io.EOF) {
+		err = ErrShortRead
+	}
+	if err != nil {
+		switch d.Type {
+		case DeltaTypeRemove:
+			return nil, fmt.Errorf("error reading original data diff at %d (len=%d): %w", d.DataOffset, d.DataLen, err)
+		default:
+			return nil, fmt.Errorf("error reading updated data diff at %d (len=%d): %w", d.DataOffset, d.DataLen, err)
+		}
+	}
+	return diff, nil
+}
+
 // CalcDiffs provides the differences between any 2 given inputs of data, based on the hashing settings
 func CalcDiffs(originalData, updatedData ReaderAt, hashFn func() hash.Hash, minChunkSize, divisor, prime int64) ([]*Diff, error) {
+	cfg, err := rabinConfig(hashFn, minChunkSize, divisor, prime)
+	if err != nil {
+		return nil, err
+	}
+
+	return CalcDiffsWithConfig(originalData, updatedData, cfg)
+}
 
-	originalChunks, err := ChunkData(originalData, hashFn(), minChunkSize, divisor, prime)
+// CalcDiffsFunc works exactly like CalcDiffs, but instead of loading all the diffs' data in memory and returning
+// them at the end, it calls fn with each diff, in order, leaving it to fn to read the diff's data, if needed
+// (e.g. DiffEncoder.EncodeLazy streams it straight to the output). If fn returns an error, it's returned as it is.
+func CalcDiffsFunc(originalData, updatedData ReaderAt, hashFn func() hash.Hash, minChunkSize, divisor, prime int64, fn func(diff *LazyDiff) error) error {
+	cfg, err := rabinConfig(hashFn, minChunkSize, divisor, prime)
 	if err != nil {
-		return nil, fmt.Errorf("error chunking original data: %s", err)
+		return err
 	}
 
-	updatedChunks, err := ChunkData(updatedData, hashFn(), minChunkSize, divisor, prime)
+	return CalcDiffsFuncWithConfig(originalData, updatedData, cfg, fn)
+}
+
+// CalcDiffsWithConfig works like CalcDiffs, using the given config
+func CalcDiffsWithConfig(originalData, updatedData ReaderAt, cfg *Config) ([]*Diff, error) {
+	var diffs []*Diff
+
+	err := CalcDiffsFuncWithConfig(originalData, updatedData, cfg, func(lazy *LazyDiff) error {
+		// NOTE: There's no real need to know the deleted data for deleting it,
+		// the position and the length should be enough, but it's needed to Invert the diffs.
+		diff, err := lazy.Load()
+		if err != nil {
+			return err
+		}
+		diffs = append(diffs, diff)
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error chunking updated data: %s", err)
+		return nil, err
+	}
+
+	return diffs, nil
+}
+
+// CalcDiffsFuncWithConfig works like CalcDiffsFunc, using the given config
+func CalcDiffsFuncWithConfig(originalData, updatedData ReaderAt, cfg *Config, fn func(diff *LazyDiff) error) error {
+	cfg, err := cfg.resolve()
+	if err != nil {
+		return err
+	}
+
+	originalChunks, err := ChunkDataWithConfig(originalData, cfg)
+	if err != nil {
+		return fmt.Errorf("error chunking original data: %w", err)
+	}
+
+	updatedChunks, err := ChunkDataWithConfig(updatedData, cfg)
+	if err != nil {
+		return fmt.Errorf("error chunking updated data: %w", err)
 	}
 
 	chunksDeltas, err := GetChunksDeltas(originalChunks, updatedChunks)
 	if err != nil {
-		return nil, fmt.Errorf("error getting original vs updated chunks deltas: %s", err)
+		return fmt.Errorf("error getting original vs updated chunks deltas: %w", err)
 	}
 
-	// Load data target of each diff
-	diffs := make([]*Diff, len(chunksDeltas))
-	for i, chunkDelta := range chunksDeltas {
-		diff := &Diff{ChunkDelta: chunkDelta}
-		diffs[i] = diff
+	if cfg.Refinement == RefinementBytes {
+		chunksDeltas, err = refineDeltas(originalData, updatedData, originalChunks, updatedChunks, chunksDeltas, cfg)
+		if err != nil {
+			return fmt.Errorf("error refining deltas: %w", err)
+		}
+	}
 
-		switch chunkDelta.Type {
-		case DeltaTypeRemove:
-			// NOTE: There's no real need to know the deleted data for deleting it,
-			// the position and the length should be enough, this is just for testing purposes.
-			diff.Data = make([]byte, chunkDelta.DataLen)
-			_, err = originalData.ReadAt(diffs[i].Data, chunkDelta.DataOffset)
-			if err != nil {
-				return nil, fmt.Errorf("error reading original data diff at %d (len=%d): %s", chunkDelta.DataOffset, chunkDelta.DataLen, err)
-			}
+	for _, chunkDelta := range chunksDeltas {
+		diff := &LazyDiff{ChunkDelta: chunkDelta, data: updatedData}
+		if chunkDelta.Type == DeltaTypeRemove {
+			diff.data = originalData
+		}
 
-		case DeltaTypeAdd:
-			diff.Data = make([]byte, chunkDelta.DataLen)
-			_, err = updatedData.ReadAt(diffs[i].Data, chunkDelta.DataOffset)
-			if err != nil {
-				return nil, fmt.Errorf("error reading updated data diff at %d (len=%d): %s", chunkDelta.DataOffset, chunkDelta.DataLen, err)
-			}
+		if err = fn(diff); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Invert provides the diffs going from the updated data back to the original data, given the diffs going from the
+// original data to the updated data (as provided by CalcDiffs). Removals become additions and vice versa,
+// that's why the data of the removed chunks is needed too.
+func Invert(diffs []*Diff) ([]*Diff, error) {
+	inverted := make([]*Diff, len(diffs))
+	for i, diff := range diffs {
+		if int64(len(diff.Data)) != diff.DataLen {
+			return nil, fmt.Errorf("diff #%d has %d bytes of data, expected %d: %w", i, len(diff.Data), diff.DataLen, ErrInvalidDiffs)
+		}
 
+		inverted[i] = &Diff{
+			ChunkDelta: &ChunkDelta{Chunk: diff.Chunk, Position: diff.Position},
+			Data:       diff.Data,
+		}
+
+		switch diff.Type {
+		case DeltaTypeRemove:
+			inverted[i].Type = DeltaTypeAdd
+		case DeltaTypeAdd:
+			inverted[i].Type = DeltaTypeRemove
+		default:
+			return nil, fmt.Errorf("diff #%d has an unknown type %d: %w", i, diff.Type, ErrInvalidDiffs)
 		}
 	}
 
-	return diffs, nil
+	// Set the order in which the inverted diffs should be applied
+	sort.SliceStable(inverted, func(i, j int) bool {
+		return deltaLess(inverted[i].ChunkDelta, inverted[j].ChunkDelta)
+	})
+
+	return inverted, nil
 }
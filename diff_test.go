@@ -1,6 +1,7 @@
 package godiff_test
 
 import (
+	"bytes"
 	"crypto/sha1"
 	"github.com/mihailozarinschi/godiff"
 	"github.com/stretchr/testify/assert"
@@ -143,3 +144,97 @@ func TestCalcDiffs(t *testing.T) {
 		})
 	}
 }
+
+func TestInvert(t *testing.T) {
+	original, err := os.ReadFile("testdata/original.txt")
+	require.NoError(t, err)
+	updated, err := os.ReadFile("testdata/updated.txt")
+	require.NoError(t, err)
+
+	diffs, err := godiff.CalcDiffs(bytes.NewReader(original), bytes.NewReader(updated), sha1.New, 4, 16, 7)
+	require.NoError(t, err)
+
+	inverted, err := godiff.Invert(diffs)
+	require.NoError(t, err)
+	require.Equal(t, len(diffs), len(inverted))
+
+	// Removals first DESC, then additions ASC
+	for i := 1; i < len(inverted); i++ {
+		prev, curr := inverted[i-1], inverted[i]
+		if prev.Type == curr.Type && prev.Type == godiff.DeltaTypeRemove {
+			assert.Greater(t, prev.Position, curr.Position)
+		}
+		if prev.Type == curr.Type && prev.Type == godiff.DeltaTypeAdd {
+			assert.Less(t, prev.Position, curr.Position)
+		}
+		assert.LessOrEqual(t, prev.Type, curr.Type)
+	}
+
+	// Going forward, then backward, gives back the original data
+	var patched bytes.Buffer
+	require.NoError(t, godiff.Patch(bytes.NewReader(original), diffs, &patched))
+	require.Equal(t, string(updated), patched.String())
+
+	var unpatched bytes.Buffer
+	require.NoError(t, godiff.Patch(bytes.NewReader(patched.Bytes()), inverted, &unpatched))
+	assert.Equal(t, string(original), unpatched.String())
+
+	// Inverting twice gives back the same diffs
+	reinverted, err := godiff.Invert(inverted)
+	require.NoError(t, err)
+	assert.Equal(t, diffs, reinverted)
+}
+
+func TestInvertMissingData(t *testing.T) {
+	_, err := godiff.Invert([]*godiff.Diff{
+		{ChunkDelta: &godiff.ChunkDelta{Chunk: &godiff.Chunk{DataOffset: 0, DataLen: 5}, Type: godiff.DeltaTypeRemove}},
+	})
+	require.Error(t, err)
+}
+
+func TestCalcDiffsFunc(t *testing.T) {
+	updated := strings.Replace(loremIpsum, "consectetur", "xxxxxxxxxxx", 1) + " Appended data."
+
+	expected, err := godiff.CalcDiffs(strings.NewReader(loremIpsum), strings.NewReader(updated), sha1.New, 4, 16, 7)
+	require.NoError(t, err)
+
+	// The diffs' data is not read, unless asked for
+	original := &countingReaderAt{ReaderAt: strings.NewReader(loremIpsum)}
+	var diffs []*godiff.Diff
+	err = godiff.CalcDiffsFunc(original, strings.NewReader(updated), sha1.New, 4, 16, 7, func(lazy *godiff.LazyDiff) error {
+		require.Equal(t, 0, original.readAtCalls)
+
+		if lazy.Type == godiff.DeltaTypeRemove {
+			diffs = append(diffs, &godiff.Diff{ChunkDelta: lazy.ChunkDelta})
+			return nil
+		}
+
+		data, err := io.ReadAll(lazy.DataReader())
+		require.NoError(t, err)
+		diffs = append(diffs, &godiff.Diff{ChunkDelta: lazy.ChunkDelta, Data: data})
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, len(expected), len(diffs))
+
+	for i := range expected {
+		assert.Equal(t, expected[i].ChunkDelta, diffs[i].ChunkDelta)
+		if expected[i].Type == godiff.DeltaTypeAdd {
+			assert.Equal(t, expected[i].Data, diffs[i].Data)
+		}
+	}
+}
+
+// countingReaderAt counts the calls to ReadAt, and the bytes read
+type countingReaderAt struct {
+	godiff.ReaderAt
+	readAtCalls int
+	readLen     int64
+}
+
+func (c *countingReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	c.readAtCalls++
+	n, err := c.ReaderAt.ReadAt(b, off)
+	c.readLen += int64(n)
+	return n, err
+}
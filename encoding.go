@@ -0,0 +1,471 @@
+package godiff
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The diffs binary format is made of a header (magic + version), followed by any number of diff records,
+// followed by an end marker. Since version 2, the header also contains the digests of the original (source)
+// and updated (target) data, each as: presence (1 byte), size (8 bytes) and SHA-256 (32 bytes).
+// Version 1 is still written when there are no digests. Each record is:
+//   - the delta type (1 byte)
+//   - the position, data offset and data length (uvarints)
+//   - the hash (uvarint length + bytes)
+//   - the data (uvarint length + bytes), which can be empty, e.g. for removals
+const (
+	diffsMagic              = "GDIF"
+	diffsVersion            = 1
+	diffsVersionWithDigests = 2
+
+	diffsEndMarker = 0xFF
+
+	maxEncodedHashLen = 1024 // Way more than any known hash function's hex digest
+)
+
+// DiffEncoder writes diffs to an output stream, in the diffs binary format
+type DiffEncoder struct {
+	w              *bufio.Writer
+	headerWritten  bool
+	closed         bool
+	buf            [binary.MaxVarintLen64]byte
+	source, target *FileDigest
+}
+
+// NewDiffEncoder returns a new encoder writing to w. Close must be called once all the diffs were encoded.
+func NewDiffEncoder(w io.Writer) *DiffEncoder {
+	return &DiffEncoder{w: bufio.NewWriter(w)}
+}
+
+// SetDigests sets the digests of the original (source) and updated (target) data to be written, either can be nil.
+// It must be called before anything else is encoded.
+func (e *DiffEncoder) SetDigests(source, target *FileDigest) error {
+	if e.headerWritten {
+		return fmt.Errorf("digests must be set before encoding diffs: %w", ErrInvalidParams)
+	}
+	e.source, e.target = source, target
+	return nil
+}
+
+// Encode writes the diff to the output stream
+func (e *DiffEncoder) Encode(diff *Diff) error {
+	if err := e.writeChunkDelta(diff.ChunkDelta); err != nil {
+		return err
+	}
+	if err := e.writeBytes(diff.Data); err != nil {
+		return fmt.Errorf("error writing data: %w", err)
+	}
+	return nil
+}
+
+// EncodeLazy writes the diff to the output stream, copying its data straight from the original/updated data,
+// without loading it in memory. It can be used as CalcDiffsFunc's callback.
+func (e *DiffEncoder) EncodeLazy(diff *LazyDiff) error {
+	if err := e.writeChunkDelta(diff.ChunkDelta); err != nil {
+		return err
+	}
+	if err := e.writeUvarint(uint64(diff.DataLen)); err != nil {
+		return fmt.Errorf("error writing data: %w", err)
+	}
+	if _, err := io.CopyN(e.w, diff.DataReader(), diff.DataLen); err != nil {
+		return fmt.Errorf("error writing data at %d (len=%d): %w", diff.DataOffset, diff.DataLen, err)
+	}
+	return nil
+}
+
+// writeChunkDelta writes everything but the data of a diff
+func (e *DiffEncoder) writeChunkDelta(delta *ChunkDelta) error {
+	if e.closed {
+		return fmt.Errorf("encoder is closed: %w", ErrInvalidParams)
+	}
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+
+	switch {
+	case delta.Type != DeltaTypeRemove && delta.Type != DeltaTypeAdd:
+		return fmt.Errorf("unknown delta type %d: %w", delta.Type, ErrInvalidDiffs)
+	case delta.Position < 0 || delta.DataOffset < 0 || delta.DataLen < 0:
+		return fmt.Errorf("negative position/offset/length %d/%d/%d: %w", delta.Position, delta.DataOffset, delta.DataLen, ErrInvalidDiffs)
+	case len(delta.Hash) > maxEncodedHashLen:
+		return fmt.Errorf("hash is too long (%d bytes): %w", len(delta.Hash), ErrInvalidDiffs)
+	}
+
+	if err := e.w.WriteByte(byte(delta.Type)); err != nil {
+		return fmt.Errorf("error writing delta type: %w", err)
+	}
+	for _, v := range []uint64{uint64(delta.Position), uint64(delta.DataOffset), uint64(delta.DataLen)} {
+		if err := e.writeUvarint(v); err != nil {
+			return fmt.Errorf("error writing position/offset/length: %w", err)
+		}
+	}
+	if err := e.writeBytes([]byte(delta.Hash)); err != nil {
+		return fmt.Errorf("error writing hash: %w", err)
+	}
+
+	return nil
+}
+
+// Close writes the end marker and flushes the output stream. It doesn't close the underlying writer.
+func (e *DiffEncoder) Close() error {
+	if e.closed {
+		return nil
+	}
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.closed = true
+
+	if err := e.w.WriteByte(diffsEndMarker); err != nil {
+		return fmt.Errorf("error writing end marker: %w", err)
+	}
+	if err := e.w.Flush(); err != nil {
+		return fmt.Errorf("error flushing diffs: %w", err)
+	}
+	return nil
+}
+
+func (e *DiffEncoder) writeHeader() error {
+	if e.headerWritten {
+		return nil
+	}
+	e.headerWritten = true
+
+	header := []byte(diffsMagic)
+	if e.source == nil && e.target == nil {
+		header = append(header, diffsVersion)
+	} else {
+		header = append(header, diffsVersionWithDigests)
+		for _, digest := range []*FileDigest{e.source, e.target} {
+			var err error
+			if header, err = appendFileDigest(header, digest); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := e.w.Write(header); err != nil {
+		return fmt.Errorf("error writing header: %w", err)
+	}
+	return nil
+}
+
+func (e *DiffEncoder) writeUvarint(v uint64) error {
+	n := binary.PutUvarint(e.buf[:], v)
+	_, err := e.w.Write(e.buf[:n])
+	return err
+}
+
+func (e *DiffEncoder) writeBytes(b []byte) error {
+	if err := e.writeUvarint(uint64(len(b))); err != nil {
+		return err
+	}
+	_, err := e.w.Write(b)
+	return err
+}
+
+// DiffDecoder reads diffs from an input stream, in the diffs binary format
+type DiffDecoder struct {
+	r              *bufio.Reader
+	headerRead     bool
+	done           bool
+	source, target *FileDigest
+}
+
+// NewDiffDecoder returns a new decoder reading from r
+func NewDiffDecoder(r io.Reader) *DiffDecoder {
+	return &DiffDecoder{r: bufio.NewReader(r)}
+}
+
+// Decode reads the next diff from the input stream. It returns io.EOF once the end marker was reached.
+func (d *DiffDecoder) Decode() (*Diff, error) {
+	if d.done {
+		return nil, io.EOF
+	}
+	if err := d.readHeader(); err != nil {
+		return nil, err
+	}
+
+	deltaType, err := d.r.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("error reading delta type: %w", unexpectedEOF(err))
+	}
+	if deltaType == diffsEndMarker {
+		d.done = true
+		return nil, io.EOF
+	}
+	if DeltaType(deltaType) != DeltaTypeRemove && DeltaType(deltaType) != DeltaTypeAdd {
+		return nil, fmt.Errorf("unknown delta type %d: %w", deltaType, ErrInvalidFormat)
+	}
+
+	var values [3]uint64
+	for i := range values {
+		values[i], err = binary.ReadUvarint(d.r)
+		if err != nil {
+			return nil, fmt.Errorf("error reading position/offset/length: %w", unexpectedEOF(err))
+		}
+		if values[i] > 1<<62 {
+			return nil, fmt.Errorf("position/offset/length %d is too big: %w", values[i], ErrInvalidFormat)
+		}
+	}
+
+	hash, err := d.readBytes(maxEncodedHashLen)
+	if err != nil {
+		return nil, fmt.Errorf("error reading hash: %w", err)
+	}
+
+	data, err := d.readBytes(values[2])
+	if err != nil {
+		return nil, fmt.Errorf("error reading data: %w", err)
+	}
+
+	return &Diff{
+		ChunkDelta: &ChunkDelta{
+			Chunk:    &Chunk{DataOffset: int64(values[1]), DataLen: int64(values[2]), Hash: string(hash)},
+			Type:     DeltaType(deltaType),
+			Position: int(values[0]),
+		},
+		Data: data,
+	}, nil
+}
+
+// Digests provides the digests of the original (source) and updated (target) data, if the stream contains them
+func (d *DiffDecoder) Digests() (source, target *FileDigest, err error) {
+	if err = d.readHeader(); err != nil {
+		return nil, nil, err
+	}
+	return d.source, d.target, nil
+}
+
+func (d *DiffDecoder) readHeader() error {
+	if d.headerRead {
+		return nil
+	}
+	d.headerRead = true
+
+	header := make([]byte, len(diffsMagic)+1)
+	if _, err := io.ReadFull(d.r, header); err != nil {
+		return fmt.Errorf("error reading header: %w", unexpectedEOF(err))
+	}
+	if string(header[:len(diffsMagic)]) != diffsMagic {
+		return fmt.Errorf("invalid header, not a diffs stream: %w", ErrInvalidFormat)
+	}
+
+	switch header[len(diffsMagic)] {
+	case diffsVersion:
+	case diffsVersionWithDigests:
+		digests := make([]byte, 2*fileDigestLen)
+		if _, err := io.ReadFull(d.r, digests); err != nil {
+			return fmt.Errorf("error reading header digests: %w", unexpectedEOF(err))
+		}
+		d.source, digests = readFileDigest(digests)
+		d.target, _ = readFileDigest(digests)
+	default:
+		return fmt.Errorf("unsupported diffs format version %d: %w", header[len(diffsMagic)], ErrInvalidFormat)
+	}
+	return nil
+}
+
+// readBytes reads a length-prefixed slice of bytes, which can't be longer than maxLen
+func (d *DiffDecoder) readBytes(maxLen uint64) ([]byte, error) {
+	return readBytes(d.r, maxLen)
+}
+
+func readBytes(r *bufio.Reader, maxLen uint64) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if n > maxLen {
+		return nil, fmt.Errorf("length %d exceeds the maximum of %d: %w", n, maxLen, ErrInvalidFormat)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+
+	// Don't trust the length to allocate everything upfront, the buffer grows as the data is actually read
+	var buf bytes.Buffer
+	if _, err = io.CopyN(&buf, r, int64(n)); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteDiffs writes all the diffs to w, in the diffs binary format
+func WriteDiffs(w io.Writer, diffs []*Diff) error {
+	e := NewDiffEncoder(w)
+	for i, diff := range diffs {
+		if err := e.Encode(diff); err != nil {
+			return fmt.Errorf("error encoding diff #%d: %w", i, err)
+		}
+	}
+	return e.Close()
+}
+
+// WriteDiffsWithDigests works like WriteDiffs, also writing the digests of the original (source)
+// and updated (target) data, so that they can be verified when patching (see PatchVerified)
+func WriteDiffsWithDigests(w io.Writer, diffs []*Diff, source, target *FileDigest) error {
+	e := NewDiffEncoder(w)
+	if err := e.SetDigests(source, target); err != nil {
+		return err
+	}
+	for i, diff := range diffs {
+		if err := e.Encode(diff); err != nil {
+			return fmt.Errorf("error encoding diff #%d: %w", i, err)
+		}
+	}
+	return e.Close()
+}
+
+// ReadDiffs reads all the diffs from r, until the end marker
+func ReadDiffs(r io.Reader) ([]*Diff, error) {
+	diffs, _, _, err := ReadDiffsWithDigests(r)
+	return diffs, err
+}
+
+// ReadDiffsWithDigests works like ReadDiffs, also providing the digests of the original (source)
+// and updated (target) data, if the stream contains them
+func ReadDiffsWithDigests(r io.Reader) (diffs []*Diff, source, target *FileDigest, err error) {
+	d := NewDiffDecoder(r)
+	for {
+		diff, err := d.Decode()
+		if errors.Is(err, io.EOF) {
+			return diffs, d.source, d.target, nil
+		}
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error decoding diff #%d: %w", len(diffs), err)
+		}
+		diffs = append(diffs, diff)
+	}
+}
+
+// unexpectedEOF converts an io.EOF (or io.ErrUnexpectedEOF) into ErrShortRead, for when the stream ended before
+// the end marker
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("stream ended unexpectedly: %w", ErrShortRead)
+	}
+	return err
+}
+
+// The signature binary format (the chunks of some data, see ChunkData) is made of a header (magic + version),
+// followed by any number of chunk records, followed by an end marker. Each record is:
+//   - the record marker (1 byte)
+//   - the data offset and data length (uvarints)
+//   - the weak checksum (4 bytes), only for the chunks having one (see Config.WeakHash)
+//   - the hash (uvarint length + bytes)
+const (
+	signatureMagic   = "GSIG"
+	signatureVersion = 1
+
+	signatureChunkMarker     = 0x01
+	signatureWeakChunkMarker = 0x02 // Chunk record with a weak checksum
+	signatureEndMarker       = 0xFF
+)
+
+// WriteSignature writes all the chunks to w, in the signature binary format
+func WriteSignature(w io.Writer, chunks []*Chunk) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(signatureMagic); err != nil {
+		return fmt.Errorf("error writing header: %w", err)
+	}
+	if err := bw.WriteByte(signatureVersion); err != nil {
+		return fmt.Errorf("error writing header: %w", err)
+	}
+
+	var buf [binary.MaxVarintLen64]byte
+	for i, chunk := range chunks {
+		switch {
+		case chunk.DataOffset < 0 || chunk.DataLen < 0:
+			return fmt.Errorf("chunk #%d has a negative offset/length %d/%d: %w", i, chunk.DataOffset, chunk.DataLen, ErrInvalidParams)
+		case len(chunk.Hash) > maxEncodedHashLen:
+			return fmt.Errorf("chunk #%d hash is too long (%d bytes): %w", i, len(chunk.Hash), ErrInvalidParams)
+		}
+
+		marker := byte(signatureChunkMarker)
+		if chunk.HasWeak {
+			marker = signatureWeakChunkMarker
+		}
+		record := append(buf[:0:0], marker)
+		record = binary.AppendUvarint(record, uint64(chunk.DataOffset))
+		record = binary.AppendUvarint(record, uint64(chunk.DataLen))
+		if chunk.HasWeak {
+			record = binary.BigEndian.AppendUint32(record, chunk.Weak)
+		}
+		record = binary.AppendUvarint(record, uint64(len(chunk.Hash)))
+		record = append(record, chunk.Hash...)
+		if _, err := bw.Write(record); err != nil {
+			return fmt.Errorf("error writing chunk #%d: %w", i, err)
+		}
+	}
+
+	if err := bw.WriteByte(signatureEndMarker); err != nil {
+		return fmt.Errorf("error writing end marker: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("error flushing signature: %w", err)
+	}
+	return nil
+}
+
+// ReadSignature reads all the chunks from r, until the end marker
+func ReadSignature(r io.Reader) ([]*Chunk, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, len(signatureMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("error reading header: %w", unexpectedEOF(err))
+	}
+	if string(header[:len(signatureMagic)]) != signatureMagic {
+		return nil, fmt.Errorf("invalid header, not a signature stream: %w", ErrInvalidFormat)
+	}
+	if header[len(signatureMagic)] != signatureVersion {
+		return nil, fmt.Errorf("unsupported signature format version %d: %w", header[len(signatureMagic)], ErrInvalidFormat)
+	}
+
+	var chunks []*Chunk
+	for {
+		marker, err := br.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("error reading chunk #%d: %w", len(chunks), unexpectedEOF(err))
+		}
+		if marker == signatureEndMarker {
+			return chunks, nil
+		}
+		if marker != signatureChunkMarker && marker != signatureWeakChunkMarker {
+			return nil, fmt.Errorf("unknown record marker %d: %w", marker, ErrInvalidFormat)
+		}
+
+		var values [2]uint64
+		for i := range values {
+			values[i], err = binary.ReadUvarint(br)
+			if err != nil {
+				return nil, fmt.Errorf("error reading chunk #%d offset/length: %w", len(chunks), unexpectedEOF(err))
+			}
+			if values[i] > 1<<62 {
+				return nil, fmt.Errorf("chunk #%d offset/length %d is too big: %w", len(chunks), values[i], ErrInvalidFormat)
+			}
+		}
+
+		chunk := &Chunk{DataOffset: int64(values[0]), DataLen: int64(values[1]), HasWeak: marker == signatureWeakChunkMarker}
+		if chunk.HasWeak {
+			var b [4]byte
+			if _, err = io.ReadFull(br, b[:]); err != nil {
+				return nil, fmt.Errorf("error reading chunk #%d weak checksum: %w", len(chunks), unexpectedEOF(err))
+			}
+			chunk.Weak = binary.BigEndian.Uint32(b[:])
+		}
+
+		hash, err := readBytes(br, maxEncodedHashLen)
+		if err != nil {
+			return nil, fmt.Errorf("error reading chunk #%d hash: %w", len(chunks), err)
+		}
+
+		chunk.Hash = string(hash)
+		chunks = append(chunks, chunk)
+	}
+}
@@ -0,0 +1,205 @@
+package godiff_test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"github.com/mihailozarinschi/godiff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWriteReadDiffs(t *testing.T) {
+	tt := []struct {
+		name  string
+		diffs func(t *testing.T) []*godiff.Diff
+	}{
+		{
+			name:  "no diffs",
+			diffs: func(_ *testing.T) []*godiff.Diff { return nil },
+		},
+		{
+			name: "lorem ipsum",
+			diffs: func(t *testing.T) []*godiff.Diff {
+				updated := strings.Replace(loremIpsum, "consectetur", "xxxxxxxxxxx", 1) + " Appended data."
+				diffs, err := godiff.CalcDiffs(strings.NewReader(loremIpsum), strings.NewReader(updated), sha1.New, 4, 16, 7)
+				require.NoError(t, err)
+				return diffs
+			},
+		},
+		{
+			name: "removal without data",
+			diffs: func(_ *testing.T) []*godiff.Diff {
+				return []*godiff.Diff{
+					{ChunkDelta: &godiff.ChunkDelta{Chunk: &godiff.Chunk{DataOffset: 10, DataLen: 5, Hash: "A"}, Type: godiff.DeltaTypeRemove, Position: 1}},
+				}
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			diffs := tc.diffs(t)
+
+			var buf bytes.Buffer
+			require.NoError(t, godiff.WriteDiffs(&buf, diffs))
+
+			decoded, err := godiff.ReadDiffs(&buf)
+			require.NoError(t, err)
+			assert.Equal(t, diffs, decoded)
+		})
+	}
+}
+
+func TestDiffDecoderStream(t *testing.T) {
+	diffs := []*godiff.Diff{
+		{ChunkDelta: &godiff.ChunkDelta{Chunk: &godiff.Chunk{DataOffset: 0, DataLen: 3, Hash: "A"}, Type: godiff.DeltaTypeAdd, Position: 0}, Data: []byte("abc")},
+		{ChunkDelta: &godiff.ChunkDelta{Chunk: &godiff.Chunk{DataOffset: 3, DataLen: 3, Hash: "B"}, Type: godiff.DeltaTypeAdd, Position: 1}, Data: []byte("def")},
+	}
+
+	var buf bytes.Buffer
+	e := godiff.NewDiffEncoder(&buf)
+	for _, diff := range diffs {
+		require.NoError(t, e.Encode(diff))
+	}
+	require.NoError(t, e.Close())
+	require.Error(t, e.Encode(diffs[0]))
+
+	d := godiff.NewDiffDecoder(&buf)
+	for _, diff := range diffs {
+		decoded, err := d.Decode()
+		require.NoError(t, err)
+		assert.Equal(t, diff, decoded)
+	}
+	_, err := d.Decode()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestReadDiffsInvalid(t *testing.T) {
+	var valid bytes.Buffer
+	require.NoError(t, godiff.WriteDiffs(&valid, []*godiff.Diff{
+		{ChunkDelta: &godiff.ChunkDelta{Chunk: &godiff.Chunk{DataOffset: 0, DataLen: 3, Hash: "A"}, Type: godiff.DeltaTypeAdd, Position: 0}, Data: []byte("abc")},
+	}))
+
+	tt := []struct {
+		name string
+		data []byte
+	}{
+		{
+			name: "empty",
+			data: nil,
+		},
+		{
+			name: "invalid magic",
+			data: []byte("XXXX\x01\xff"),
+		},
+		{
+			name: "unsupported version",
+			data: []byte("GDIF\x09\xff"),
+		},
+		{
+			name: "unknown delta type",
+			data: []byte("GDIF\x01\x07"),
+		},
+		{
+			name: "truncated",
+			data: valid.Bytes()[:valid.Len()-3],
+		},
+		{
+			name: "missing end marker",
+			data: valid.Bytes()[:valid.Len()-1],
+		},
+		{
+			name: "data longer than the stream",
+			data: []byte("GDIF\x01\x01\x00\x00\xff\xff\xff\x0f\x00\xff\xff\xff\x0f"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := godiff.ReadDiffs(bytes.NewReader(tc.data))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestDiffEncoderEncodeLazy(t *testing.T) {
+	updated := strings.Replace(loremIpsum, "consectetur", "xxxxxxxxxxx", 1) + " Appended data."
+
+	expected, err := godiff.CalcDiffs(strings.NewReader(loremIpsum), strings.NewReader(updated), sha1.New, 4, 16, 7)
+	require.NoError(t, err)
+
+	// Diffs are streamed straight into the encoder
+	var buf bytes.Buffer
+	e := godiff.NewDiffEncoder(&buf)
+	err = godiff.CalcDiffsFunc(strings.NewReader(loremIpsum), strings.NewReader(updated), sha1.New, 4, 16, 7, e.EncodeLazy)
+	require.NoError(t, err)
+	require.NoError(t, e.Close())
+
+	diffs, err := godiff.ReadDiffs(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, expected, diffs)
+}
+
+func TestWriteReadSignature(t *testing.T) {
+	chunks, err := godiff.ChunkData(strings.NewReader(loremIpsum), sha1.New(), 4, 16, 7)
+	require.NoError(t, err)
+	weakChunks, err := godiff.ChunkDataWithConfig(strings.NewReader(loremIpsum), &godiff.Config{AvgChunkSize: 64, WeakHash: true, StrongHashLen: 8})
+	require.NoError(t, err)
+
+	for _, chunks := range [][]*godiff.Chunk{nil, chunks, weakChunks} {
+		var buf bytes.Buffer
+		require.NoError(t, godiff.WriteSignature(&buf, chunks))
+
+		decoded, err := godiff.ReadSignature(&buf)
+		require.NoError(t, err)
+		assert.Equal(t, chunks, decoded)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, godiff.WriteSignature(&buf, chunks))
+	_, err = godiff.ReadSignature(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	assert.ErrorIs(t, err, godiff.ErrShortRead)
+
+	_, err = godiff.ReadSignature(strings.NewReader("GDIF\x01\xFF"))
+	assert.ErrorIs(t, err, godiff.ErrInvalidFormat)
+}
+
+func TestWriteReadDiffsWithDigests(t *testing.T) {
+	diffs := []*godiff.Diff{
+		{ChunkDelta: &godiff.ChunkDelta{Chunk: &godiff.Chunk{DataOffset: 0, DataLen: 3, Hash: "A"}, Type: godiff.DeltaTypeAdd, Position: 0}, Data: []byte("abc")},
+	}
+	source, err := godiff.DigestData(strings.NewReader("source"))
+	require.NoError(t, err)
+	target, err := godiff.DigestData(strings.NewReader("target"))
+	require.NoError(t, err)
+
+	for _, digests := range [][2]*godiff.FileDigest{{source, target}, {nil, target}, {nil, nil}} {
+		var buf bytes.Buffer
+		require.NoError(t, godiff.WriteDiffsWithDigests(&buf, diffs, digests[0], digests[1]))
+
+		decoded, decodedSource, decodedTarget, err := godiff.ReadDiffsWithDigests(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, diffs, decoded)
+		assert.Equal(t, digests[0], decodedSource)
+		assert.Equal(t, digests[1], decodedTarget)
+
+		// The digests are simply ignored by ReadDiffs
+		decoded, err = godiff.ReadDiffs(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, diffs, decoded)
+	}
+
+	// Without digests, the stream is still written in the first version of the format
+	var withDigests, withoutDigests bytes.Buffer
+	require.NoError(t, godiff.WriteDiffs(&withoutDigests, diffs))
+	require.NoError(t, godiff.WriteDiffsWithDigests(&withDigests, diffs, nil, nil))
+	assert.Equal(t, withoutDigests.Bytes(), withDigests.Bytes())
+	assert.Equal(t, "GDIF\x01", withoutDigests.String()[:5])
+
+	e := godiff.NewDiffEncoder(&bytes.Buffer{})
+	require.NoError(t, e.Encode(diffs[0]))
+	assert.ErrorIs(t, e.SetDigests(source, target), godiff.ErrInvalidParams)
+}
@@ -0,0 +1,236 @@
+package godiff
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+// The encrypted blobs are made of:
+//   - the version (1 byte)
+//   - the ID of the key used (4 bytes)
+//   - the AES-GCM nonce (12 bytes)
+//   - the encrypted data, followed by the AES-GCM tag
+//
+// The lookup key is used as additional data, so that a blob can't be passed off as another chunk's.
+const (
+	encryptedBlobVersion   = 1
+	encryptedBlobHeaderLen = 1 + 4 + 12
+
+	lookupKeyLabel  = "godiff lookup key"
+	convergentLabel = "godiff convergent nonce"
+)
+
+// EncryptionConfig contains the keys of an EncryptedStore
+type EncryptionConfig struct {
+	// LookupKey derives the keys the chunks are stored with from their hashes, so that the store can't tell
+	// which chunks it contains. It can't change, or the chunks already stored couldn't be found anymore.
+	LookupKey []byte
+
+	// Keys are the AES keys (16, 24 or 32 bytes) by ID. The keys of the chunks already stored must be kept,
+	// until the chunks are re-encrypted with RotateKeys.
+	Keys map[uint32][]byte
+	// CurrentKeyID is the ID of the key used to encrypt new chunks
+	CurrentKeyID uint32
+
+	// Convergent encryption encrypts identical chunks into identical blobs (for the same key), so that they can
+	// still be deduplicated by the underlying store, at the cost of telling which blobs have the same content
+	Convergent bool
+}
+
+// EncryptedStore stores chunks' data encrypted with AES-GCM in a ChunkStore. The chunks' hashes are calculated
+// on their plain data, but the store only sees keys derived from them.
+type EncryptedStore struct {
+	store      ChunkStore
+	lookupKey  []byte
+	aeads      map[uint32]cipher.AEAD
+	keys       map[uint32][]byte
+	currentID  uint32
+	convergent bool
+}
+
+// NewEncryptedStore provides an EncryptedStore on top of store
+func NewEncryptedStore(store ChunkStore, cfg *EncryptionConfig) (*EncryptedStore, error) {
+	switch {
+	case store == nil:
+		return nil, &ParamError{Name: "store", Value: store, Reason: "must not be nil"}
+	case cfg == nil:
+		return nil, &ParamError{Name: "cfg", Value: cfg, Reason: "must not be nil"}
+	case len(cfg.LookupKey) < minKeyLen:
+		return nil, &ParamError{Name: "LookupKey", Value: fmt.Sprintf("(%d bytes)", len(cfg.LookupKey)), Reason: fmt.Sprintf("must be at least %d bytes", minKeyLen)}
+	}
+	if _, ok := cfg.Keys[cfg.CurrentKeyID]; !ok {
+		return nil, &ParamError{Name: "CurrentKeyID", Value: cfg.CurrentKeyID, Reason: "must be one of the Keys"}
+	}
+
+	s := &EncryptedStore{
+		store:      store,
+		lookupKey:  append([]byte(nil), cfg.LookupKey...),
+		aeads:      make(map[uint32]cipher.AEAD),
+		keys:       make(map[uint32][]byte),
+		currentID:  cfg.CurrentKeyID,
+		convergent: cfg.Convergent,
+	}
+	for id, key := range cfg.Keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, &ParamError{Name: "Keys", Value: id, Reason: err.Error()}
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("error creating AES-GCM for key %d: %w", id, err)
+		}
+		s.aeads[id] = aead
+		s.keys[id] = append([]byte(nil), key...)
+	}
+
+	return s, nil
+}
+
+// LookupKey provides the key the chunk is stored with in the underlying store
+func (s *EncryptedStore) LookupKey(chunk *Chunk) string {
+	mac := hmac.New(sha256.New, s.lookupKey)
+	mac.Write([]byte(lookupKeyLabel))
+	mac.Write([]byte(chunk.Hash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Put stores the chunk's data, unless it's already stored
+func (s *EncryptedStore) Put(chunk *Chunk, data []byte) error {
+	if int64(len(data)) != chunk.DataLen {
+		return fmt.Errorf("chunk %s has %d bytes of data, expected %d: %w", chunk.Hash, len(data), chunk.DataLen, ErrInvalidParams)
+	}
+
+	key := s.LookupKey(chunk)
+	stored, err := s.store.Has(key)
+	if err != nil {
+		return fmt.Errorf("error looking up chunk %s: %w", chunk.Hash, err)
+	}
+	if stored {
+		return nil
+	}
+
+	blob, err := s.encrypt(key, data)
+	if err != nil {
+		return fmt.Errorf("error encrypting chunk %s: %w", chunk.Hash, err)
+	}
+	if err = s.store.Put(key, blob); err != nil {
+		return fmt.Errorf("error storing chunk %s: %w", chunk.Hash, err)
+	}
+	return nil
+}
+
+// PutDiffs stores the data of all the diffs having it (e.g. the additions calculated by CalcDiffs)
+func (s *EncryptedStore) PutDiffs(diffs []*Diff) error {
+	for _, diff := range diffs {
+		if diff.Data == nil && diff.DataLen > 0 {
+			continue
+		}
+		if err := s.Put(diff.Chunk, diff.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get provides the chunk's data, or ErrNotFound
+func (s *EncryptedStore) Get(chunk *Chunk) ([]byte, error) {
+	key := s.LookupKey(chunk)
+	blob, err := s.store.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("error loading chunk %s: %w", chunk.Hash, err)
+	}
+
+	data, _, err := s.decrypt(key, blob)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting chunk %s: %w", chunk.Hash, err)
+	}
+	if int64(len(data)) != chunk.DataLen {
+		return nil, fmt.Errorf("chunk %s has %d bytes of data, expected %d: %w", chunk.Hash, len(data), chunk.DataLen, ErrChecksumMismatch)
+	}
+	return data, nil
+}
+
+// Has tells whether the chunk is stored
+func (s *EncryptedStore) Has(chunk *Chunk) (bool, error) {
+	return s.store.Has(s.LookupKey(chunk))
+}
+
+// RotateKeys re-encrypts with the current key all the chunks encrypted with another key, and returns how many
+// chunks were re-encrypted. Once done, the other keys aren't needed anymore.
+func (s *EncryptedStore) RotateKeys() (int, error) {
+	keys, err := s.store.Keys()
+	if err != nil {
+		return 0, fmt.Errorf("error listing chunks: %w", err)
+	}
+
+	var rotated int
+	for _, key := range keys {
+		blob, err := s.store.Get(key)
+		if err != nil {
+			return rotated, fmt.Errorf("error loading blob %s: %w", key, err)
+		}
+
+		data, id, err := s.decrypt(key, blob)
+		if err != nil {
+			return rotated, fmt.Errorf("error decrypting blob %s: %w", key, err)
+		}
+		if id == s.currentID {
+			continue
+		}
+
+		if blob, err = s.encrypt(key, data); err != nil {
+			return rotated, fmt.Errorf("error encrypting blob %s: %w", key, err)
+		}
+		if err = s.store.Put(key, blob); err != nil {
+			return rotated, fmt.Errorf("error storing blob %s: %w", key, err)
+		}
+		rotated++
+	}
+
+	return rotated, nil
+}
+
+func (s *EncryptedStore) encrypt(lookupKey string, data []byte) ([]byte, error) {
+	aead := s.aeads[s.currentID]
+
+	blob := make([]byte, encryptedBlobHeaderLen, encryptedBlobHeaderLen+len(data)+aead.Overhead())
+	blob[0] = encryptedBlobVersion
+	binary.BigEndian.PutUint32(blob[1:], s.currentID)
+	nonce := blob[5:encryptedBlobHeaderLen]
+
+	if s.convergent {
+		// Deterministic, yet unique per content, the nonce is only reused to encrypt the very same data
+		mac := hmac.New(sha256.New, s.keys[s.currentID])
+		mac.Write([]byte(convergentLabel))
+		mac.Write(data)
+		copy(nonce, mac.Sum(nil))
+	} else if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+
+	return aead.Seal(blob, nonce, data, []byte(lookupKey)), nil
+}
+
+func (s *EncryptedStore) decrypt(lookupKey string, blob []byte) ([]byte, uint32, error) {
+	if len(blob) < encryptedBlobHeaderLen || blob[0] != encryptedBlobVersion {
+		return nil, 0, fmt.Errorf("invalid encrypted blob: %w", ErrInvalidFormat)
+	}
+
+	id := binary.BigEndian.Uint32(blob[1:])
+	aead, ok := s.aeads[id]
+	if !ok {
+		return nil, id, fmt.Errorf("key %d: %w", id, ErrNotFound)
+	}
+
+	data, err := aead.Open(nil, blob[5:encryptedBlobHeaderLen], blob[encryptedBlobHeaderLen:], []byte(lookupKey))
+	if err != nil {
+		return nil, id, fmt.Errorf("blob doesn't match its authentication tag: %w", ErrChecksumMismatch)
+	}
+	return data, id, nil
+}
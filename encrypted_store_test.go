@@ -0,0 +1,175 @@
+package godiff_test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"github.com/mihailozarinschi/godiff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+var (
+	testLookupKey = []byte("lookup key, 16+ bytes")
+	testKey1      = bytes.Repeat([]byte{1}, 32)
+	testKey2      = bytes.Repeat([]byte{2}, 32)
+)
+
+func TestEncryptedStore(t *testing.T) {
+	chunks, err := godiff.ChunkData(strings.NewReader(loremIpsum), sha1.New(), 4, 16, 7)
+	require.NoError(t, err)
+
+	for _, convergent := range []bool{false, true} {
+		t.Run(map[bool]string{false: "random nonces", true: "convergent"}[convergent], func(t *testing.T) {
+			backend := godiff.NewMemoryStore()
+			store, err := godiff.NewEncryptedStore(backend, &godiff.EncryptionConfig{
+				LookupKey:    testLookupKey,
+				Keys:         map[uint32][]byte{1: testKey1},
+				CurrentKeyID: 1,
+				Convergent:   convergent,
+			})
+			require.NoError(t, err)
+
+			for _, chunk := range chunks {
+				require.NoError(t, store.Put(chunk, []byte(loremIpsum[chunk.DataOffset:chunk.DataOffset+chunk.DataLen])))
+			}
+
+			for _, chunk := range chunks {
+				data, err := store.Get(chunk)
+				require.NoError(t, err)
+				assert.Equal(t, loremIpsum[chunk.DataOffset:chunk.DataOffset+chunk.DataLen], string(data))
+			}
+
+			// The backend only sees derived keys and encrypted data
+			keys, err := backend.Keys()
+			require.NoError(t, err)
+			for _, key := range keys {
+				blob, err := backend.Get(key)
+				require.NoError(t, err)
+				for _, chunk := range chunks {
+					assert.NotEqual(t, chunk.Hash, key)
+					if chunk.DataLen >= 8 {
+						assert.NotContains(t, string(blob), loremIpsum[chunk.DataOffset:chunk.DataOffset+chunk.DataLen])
+					}
+				}
+			}
+
+			// Identical chunks are stored once
+			deduped := make(map[string]bool)
+			for _, chunk := range chunks {
+				deduped[chunk.Hash] = true
+			}
+			assert.Len(t, keys, len(deduped))
+
+			// Convergent encryption produces the same blob for the same data
+			other := godiff.NewMemoryStore()
+			otherStore, err := godiff.NewEncryptedStore(other, &godiff.EncryptionConfig{
+				LookupKey:    testLookupKey,
+				Keys:         map[uint32][]byte{1: testKey1},
+				CurrentKeyID: 1,
+				Convergent:   convergent,
+			})
+			require.NoError(t, err)
+			require.NoError(t, otherStore.Put(chunks[0], []byte(loremIpsum[:chunks[0].DataLen])))
+
+			blob, err := backend.Get(store.LookupKey(chunks[0]))
+			require.NoError(t, err)
+			otherBlob, err := other.Get(store.LookupKey(chunks[0]))
+			require.NoError(t, err)
+			assert.Equal(t, convergent, bytes.Equal(blob, otherBlob))
+		})
+	}
+}
+
+func TestEncryptedStoreTampered(t *testing.T) {
+	backend := godiff.NewMemoryStore()
+	store, err := godiff.NewEncryptedStore(backend, &godiff.EncryptionConfig{
+		LookupKey:    testLookupKey,
+		Keys:         map[uint32][]byte{1: testKey1},
+		CurrentKeyID: 1,
+	})
+	require.NoError(t, err)
+
+	a := &godiff.Chunk{DataLen: 5, Hash: "a"}
+	b := &godiff.Chunk{DataLen: 5, Hash: "b"}
+	require.NoError(t, store.Put(a, []byte("aaaaa")))
+	require.NoError(t, store.Put(b, []byte("bbbbb")))
+
+	// A blob can't be passed off as another chunk's
+	blobA, err := backend.Get(store.LookupKey(a))
+	require.NoError(t, err)
+	require.NoError(t, backend.Put(store.LookupKey(b), blobA))
+	_, err = store.Get(b)
+	assert.ErrorIs(t, err, godiff.ErrChecksumMismatch)
+
+	blobA[len(blobA)-1] ^= 0x01
+	require.NoError(t, backend.Put(store.LookupKey(a), blobA))
+	_, err = store.Get(a)
+	assert.ErrorIs(t, err, godiff.ErrChecksumMismatch)
+
+	_, err = store.Get(&godiff.Chunk{Hash: "missing"})
+	assert.ErrorIs(t, err, godiff.ErrNotFound)
+}
+
+func TestEncryptedStoreRotateKeys(t *testing.T) {
+	backend := godiff.NewMemoryStore()
+	store, err := godiff.NewEncryptedStore(backend, &godiff.EncryptionConfig{
+		LookupKey:    testLookupKey,
+		Keys:         map[uint32][]byte{1: testKey1},
+		CurrentKeyID: 1,
+	})
+	require.NoError(t, err)
+
+	updated := strings.Replace(loremIpsum, "consectetur", "xxxxxxxxxxx", 1)
+	diffs, err := godiff.CalcDiffs(strings.NewReader(loremIpsum), strings.NewReader(updated), sha1.New, 4, 16, 7)
+	require.NoError(t, err)
+	require.NoError(t, store.PutDiffs(diffs))
+
+	// New chunks are encrypted with the new key, the old ones are still readable with the old key
+	rotatedStore, err := godiff.NewEncryptedStore(backend, &godiff.EncryptionConfig{
+		LookupKey:    testLookupKey,
+		Keys:         map[uint32][]byte{1: testKey1, 2: testKey2},
+		CurrentKeyID: 2,
+	})
+	require.NoError(t, err)
+	newChunk := &godiff.Chunk{DataLen: 3, Hash: "new"}
+	require.NoError(t, rotatedStore.Put(newChunk, []byte("new")))
+
+	rotated, err := rotatedStore.RotateKeys()
+	require.NoError(t, err)
+	assert.Equal(t, len(diffs), rotated)
+
+	rotated, err = rotatedStore.RotateKeys()
+	require.NoError(t, err)
+	assert.Zero(t, rotated)
+
+	// The old key isn't needed anymore
+	newStore, err := godiff.NewEncryptedStore(backend, &godiff.EncryptionConfig{
+		LookupKey:    testLookupKey,
+		Keys:         map[uint32][]byte{2: testKey2},
+		CurrentKeyID: 2,
+	})
+	require.NoError(t, err)
+	for _, diff := range diffs {
+		data, err := newStore.Get(diff.Chunk)
+		require.NoError(t, err)
+		assert.Equal(t, diff.Data, data)
+	}
+
+	// While the old key alone can't read anything anymore
+	_, err = store.Get(newChunk)
+	assert.ErrorIs(t, err, godiff.ErrNotFound)
+}
+
+func TestEncryptedStoreInvalidConfig(t *testing.T) {
+	for name, cfg := range map[string]*godiff.EncryptionConfig{
+		"nil config":          nil,
+		"short lookup key":    {LookupKey: []byte("short"), Keys: map[uint32][]byte{1: testKey1}, CurrentKeyID: 1},
+		"missing current key": {LookupKey: testLookupKey, Keys: map[uint32][]byte{1: testKey1}, CurrentKeyID: 2},
+		"invalid key size":    {LookupKey: testLookupKey, Keys: map[uint32][]byte{1: []byte("short")}, CurrentKeyID: 1},
+	} {
+		_, err := godiff.NewEncryptedStore(godiff.NewMemoryStore(), cfg)
+		assert.ErrorIs(t, err, godiff.ErrInvalidParams, name)
+	}
+}
@@ -0,0 +1,63 @@
+package godiff
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInvalidParams is returned when any of the given parameters is invalid, see ParamError for the details
+	ErrInvalidParams = errors.New("invalid parameters")
+
+	// ErrShortRead is returned when some input ends before all the expected data could be read from it
+	ErrShortRead = errors.New("short read")
+
+	// ErrChecksumMismatch is returned when some data doesn't match its expected size or digest
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+
+	// ErrInvalidFormat is returned when some encoded data can't be decoded
+	ErrInvalidFormat = errors.New("invalid format")
+
+	// ErrInvalidDiffs is returned when diffs (or patches) are inconsistent, or can't be applied to the given data
+	ErrInvalidDiffs = errors.New("invalid diffs")
+
+	// ErrConflict is returned when merged data can't be written because of conflicts
+	ErrConflict = errors.New("conflict")
+
+	// ErrNotFound is returned when something (e.g. a version) doesn't exist
+	ErrNotFound = errors.New("not found")
+
+	// ErrInvalidSignature is returned when signed data doesn't match its ed25519 signature
+	ErrInvalidSignature = errors.New("invalid signature")
+
+	// ErrTooManyDifferences is returned when an IBLT is too small to tell all the differences between 2 sets
+	ErrTooManyDifferences = errors.New("too many differences")
+)
+
+// ParamError describes an invalid parameter. It matches ErrInvalidParams with errors.Is.
+type ParamError struct {
+	Name   string
+	Value  interface{}
+	Reason string
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("invalid %s %v: %s", e.Name, e.Value, e.Reason)
+}
+
+func (e *ParamError) Unwrap() error {
+	return ErrInvalidParams
+}
+
+// validateChunkingParams checks the parameters common to all the functions chunking data
+func validateChunkingParams(minChunkSize, divisor, prime int64) error {
+	switch {
+	case minChunkSize <= 0:
+		return &ParamError{Name: "minChunkSize", Value: minChunkSize, Reason: "must be positive"}
+	case divisor <= 0:
+		return &ParamError{Name: "divisor", Value: divisor, Reason: "must be positive"}
+	case prime <= 1:
+		return &ParamError{Name: "prime", Value: prime, Reason: "must be greater than 1"}
+	}
+	return nil
+}
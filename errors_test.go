@@ -0,0 +1,148 @@
+package godiff_test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"github.com/mihailozarinschi/godiff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"hash"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInvalidParams(t *testing.T) {
+	tt := []struct {
+		name         string
+		hashFn       func() hash.Hash
+		minChunkSize int64
+		divisor      int64
+		prime        int64
+		param        string
+	}{
+		{
+			name:         "nil hash function",
+			hashFn:       nil,
+			minChunkSize: 4,
+			divisor:      16,
+			prime:        7,
+			param:        "hashFn",
+		},
+		{
+			name:         "zero min chunk size",
+			hashFn:       sha1.New,
+			minChunkSize: 0,
+			divisor:      16,
+			prime:        7,
+			param:        "minChunkSize",
+		},
+		{
+			name:         "negative min chunk size",
+			hashFn:       sha1.New,
+			minChunkSize: -4,
+			divisor:      16,
+			prime:        7,
+			param:        "minChunkSize",
+		},
+		{
+			name:         "zero divisor",
+			hashFn:       sha1.New,
+			minChunkSize: 4,
+			divisor:      0,
+			prime:        7,
+			param:        "divisor",
+		},
+		{
+			name:         "prime of 1",
+			hashFn:       sha1.New,
+			minChunkSize: 4,
+			divisor:      16,
+			prime:        1,
+			param:        "prime",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := map[string]func() error{
+				"CalcDiffs": func() error {
+					_, err := godiff.CalcDiffs(strings.NewReader(loremIpsum), strings.NewReader(loremIpsum), tc.hashFn, tc.minChunkSize, tc.divisor, tc.prime)
+					return err
+				},
+				"Merge3": func() error {
+					_, err := godiff.Merge3(strings.NewReader(loremIpsum), strings.NewReader(loremIpsum), strings.NewReader(loremIpsum), tc.hashFn, tc.minChunkSize, tc.divisor, tc.prime)
+					return err
+				},
+				"OpenHistory": func() error {
+					_, err := godiff.OpenHistory(t.TempDir(), 10, tc.hashFn, tc.minChunkSize, tc.divisor, tc.prime)
+					return err
+				},
+			}
+			if tc.hashFn != nil {
+				calls["ChunkData"] = func() error {
+					_, err := godiff.ChunkData(strings.NewReader(loremIpsum), tc.hashFn(), tc.minChunkSize, tc.divisor, tc.prime)
+					return err
+				}
+			}
+
+			for name, call := range calls {
+				err := call()
+				require.ErrorIs(t, err, godiff.ErrInvalidParams, name)
+
+				var paramErr *godiff.ParamError
+				require.True(t, errors.As(err, &paramErr), name)
+				assert.Equal(t, tc.param, paramErr.Name, name)
+			}
+		})
+	}
+}
+
+func TestSentinelErrors(t *testing.T) {
+	t.Run("short read", func(t *testing.T) {
+		diffs := []*godiff.Diff{
+			{ChunkDelta: &godiff.ChunkDelta{Chunk: &godiff.Chunk{DataOffset: 100, DataLen: 1}, Type: godiff.DeltaTypeAdd}, Data: []byte("x")},
+		}
+		err := godiff.Patch(strings.NewReader("short"), diffs, &bytes.Buffer{})
+		assert.ErrorIs(t, err, godiff.ErrShortRead)
+
+		var buf bytes.Buffer
+		require.NoError(t, godiff.WriteDiffs(&buf, diffs))
+		_, err = godiff.ReadDiffs(bytes.NewReader(buf.Bytes()[:buf.Len()-2]))
+		assert.ErrorIs(t, err, godiff.ErrShortRead)
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		_, err := godiff.ReadDiffs(strings.NewReader("not diffs"))
+		assert.ErrorIs(t, err, godiff.ErrInvalidFormat)
+	})
+
+	t.Run("invalid diffs", func(t *testing.T) {
+		diffs := []*godiff.Diff{
+			{ChunkDelta: &godiff.ChunkDelta{Chunk: &godiff.Chunk{DataOffset: 0, DataLen: 5}, Type: godiff.DeltaTypeRemove}},
+		}
+		_, err := godiff.Invert(diffs)
+		assert.ErrorIs(t, err, godiff.ErrInvalidDiffs)
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		result, err := godiff.Merge3(strings.NewReader(loremIpsum), strings.NewReader("ours"), strings.NewReader("theirs"), sha1.New, 4, 16, 7)
+		require.NoError(t, err)
+		assert.ErrorIs(t, result.WriteMerged(&bytes.Buffer{}), godiff.ErrConflict)
+	})
+
+	t.Run("checksum mismatch and not found", func(t *testing.T) {
+		dir := t.TempDir()
+		h, err := godiff.OpenHistory(dir, 10, sha1.New, 4, 16, 7)
+		require.NoError(t, err)
+		_, err = h.Commit(strings.NewReader(loremIpsum))
+		require.NoError(t, err)
+
+		assert.ErrorIs(t, h.Checkout(1, &bytes.Buffer{}), godiff.ErrNotFound)
+
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "00000000.snapshot"), []byte("tampered"), 0o644))
+		assert.ErrorIs(t, h.Checkout(0, &bytes.Buffer{}), godiff.ErrChecksumMismatch)
+	})
+}
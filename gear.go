@@ -0,0 +1,125 @@
+package godiff
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// gearTable maps each byte to a random value, mixed into the gear rolling hash
+type gearTable [256]uint64
+
+// defaultGearTable is the table of the unkeyed gear hash, it must never change, or all the chunks would too
+var defaultGearTable = newGearTable(0x676f64696666) // "godiff"
+
+// keyedGearTableLabel separates the keyed gear table derivation from any other use of the same key
+const keyedGearTableLabel = "godiff gear table"
+
+// newGearTable generates a table from a seed, with splitmix64
+func newGearTable(seed uint64) *gearTable {
+	var table gearTable
+	for i := range table {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return &table
+}
+
+// newKeyedGearTable derives a table from a secret key, with HMAC-SHA256 in counter mode
+func newKeyedGearTable(key []byte) *gearTable {
+	var (
+		table   gearTable
+		counter [4]byte
+		block   []byte
+	)
+	mac := hmac.New(sha256.New, key)
+	for i := range table {
+		if len(block) == 0 {
+			binary.BigEndian.PutUint32(counter[:], uint32(i))
+			mac.Reset()
+			mac.Write([]byte(keyedGearTableLabel))
+			mac.Write(counter[:])
+			block = mac.Sum(nil)
+		}
+		table[i] = binary.BigEndian.Uint64(block)
+		block = block[8:]
+	}
+	return &table
+}
+
+// chunkGear finds the breakpoints with a gear rolling hash, as FastCDC does: the first MinChunkSize bytes of
+// each chunk are skipped, then a breakpoint is harder to find before AvgChunkSize and easier after it
+// (normalized chunking), so that the chunk sizes are closer to the average
+func chunkGear(r io.Reader, h *chunkHasher, table *gearTable, cfg *Config, fn func(chunk *Chunk) error) error {
+	var (
+		bits        = int(math.Round(math.Log2(float64(cfg.AvgChunkSize - cfg.MinChunkSize))))
+		maskSmall   = gearMask(bits + 1)
+		maskLarge   = gearMask(bits - 1)
+		br          = bufio.NewReader(r)
+		chunk       = make([]byte, 0, cfg.MinChunkSize)
+		chunkOffset int64
+		fingerprint uint64
+	)
+
+	emitChunk := func() error {
+		h.Reset()
+		h.Write(chunk)
+		err := fn(h.chunk(chunkOffset, int64(len(chunk))))
+		chunkOffset += int64(len(chunk))
+		chunk = chunk[:0]
+		fingerprint = 0
+		return err
+	}
+
+	for {
+		b, err := br.ReadByte()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading next byte: %w", err)
+		}
+
+		chunk = append(chunk, b)
+		chunkLen := int64(len(chunk))
+		if chunkLen <= cfg.MinChunkSize {
+			continue
+		}
+
+		// The top bits of the fingerprint depend on the last 64 bytes, that's the window of the gear hash
+		fingerprint = fingerprint<<1 + table[b]
+		mask := maskSmall
+		if chunkLen > cfg.AvgChunkSize {
+			mask = maskLarge
+		}
+		if fingerprint&mask == 0 || chunkLen >= cfg.MaxChunkSize {
+			if err = emitChunk(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(chunk) > 0 {
+		return emitChunk()
+	}
+	return nil
+}
+
+// gearMask provides a mask of the given number of top bits, at least 1
+func gearMask(bits int) uint64 {
+	if bits < 1 {
+		bits = 1
+	}
+	if bits > 63 {
+		bits = 63
+	}
+	return ^uint64(0) << (64 - bits)
+}
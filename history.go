@@ -0,0 +1,338 @@
+package godiff
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const historyIndexFile = "history.json"
+
+// HistoryVersion contains the information about a single version stored in a History
+type HistoryVersion struct {
+	Number   int    `json:"number"`
+	Snapshot bool   `json:"snapshot"` // Stored in full, otherwise stored as diffs from the previous version
+	Size     int64  `json:"size"`
+	Digest   string `json:"digest"` // SHA-256 of the version's data
+}
+
+// History stores all the versions of a file in a directory. The first version is stored in full (snapshot),
+// the next ones as diffs from their previous version. Every snapshotInterval versions, a new snapshot is stored,
+// so that retrieving any version never needs to apply more than snapshotInterval-1 sets of diffs.
+type History struct {
+	dir              string
+	snapshotInterval int
+	cfg              *Config
+
+	versions []*HistoryVersion
+}
+
+// OpenHistory opens the history stored in dir, or creates a new empty one if there's none.
+// The hashing settings are used to calculate the diffs of the new versions.
+func OpenHistory(dir string, snapshotInterval int, hashFn func() hash.Hash, minChunkSize, divisor, prime int64) (*History, error) {
+	cfg, err := rabinConfig(hashFn, minChunkSize, divisor, prime)
+	if err != nil {
+		return nil, err
+	}
+
+	return OpenHistoryWithConfig(dir, snapshotInterval, cfg)
+}
+
+// OpenHistoryWithConfig works like OpenHistory, using the given config to calculate the diffs of the new versions
+func OpenHistoryWithConfig(dir string, snapshotInterval int, cfg *Config) (*History, error) {
+	if snapshotInterval < 1 {
+		return nil, &ParamError{Name: "snapshotInterval", Value: snapshotInterval, Reason: "must be at least 1"}
+	}
+	cfg, err := cfg.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating history directory: %w", err)
+	}
+
+	h := &History{
+		dir:              dir,
+		snapshotInterval: snapshotInterval,
+		cfg:              cfg,
+	}
+
+	index, err := os.ReadFile(filepath.Join(dir, historyIndexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading history index: %w", err)
+	}
+	if err = json.Unmarshal(index, &h.versions); err != nil {
+		return nil, fmt.Errorf("error decoding history index: %w", err)
+	}
+
+	return h, nil
+}
+
+// Versions returns all the versions available, from the oldest to the newest
+func (h *History) Versions() []*HistoryVersion {
+	return h.versions
+}
+
+// Commit stores the data as a new version, following the latest one
+func (h *History) Commit(data io.Reader) (*HistoryVersion, error) {
+	updated, err := io.ReadAll(data)
+	if err != nil {
+		return nil, fmt.Errorf("error reading data: %w", err)
+	}
+
+	digest := sha256.Sum256(updated)
+	version := &HistoryVersion{
+		Size:   int64(len(updated)),
+		Digest: hex.EncodeToString(digest[:]),
+	}
+
+	var content []byte
+	if len(h.versions) == 0 {
+		version.Snapshot = true
+		content = updated
+	} else {
+		latest := h.versions[len(h.versions)-1]
+		version.Number = latest.Number + 1
+		snapshot := h.latestSnapshot()
+		version.Snapshot = snapshot == nil || version.Number-snapshot.Number >= h.snapshotInterval
+
+		if version.Snapshot {
+			content = updated
+		} else {
+			original, err := h.checkout(latest.Number)
+			if err != nil {
+				return nil, fmt.Errorf("error loading latest version %d: %w", latest.Number, err)
+			}
+
+			var buf bytes.Buffer
+			e := NewDiffEncoder(&buf)
+			err = CalcDiffsFuncWithConfig(bytes.NewReader(original), bytes.NewReader(updated), h.cfg, e.EncodeLazy)
+			if err != nil {
+				return nil, fmt.Errorf("error calculating diffs from version %d: %w", latest.Number, err)
+			}
+			if err = e.Close(); err != nil {
+				return nil, fmt.Errorf("error encoding diffs from version %d: %w", latest.Number, err)
+			}
+			content = buf.Bytes()
+		}
+	}
+
+	if err = writeFileAtomic(h.versionPath(version), content); err != nil {
+		return nil, fmt.Errorf("error writing version %d: %w", version.Number, err)
+	}
+
+	h.versions = append(h.versions, version)
+	if err = h.writeIndex(); err != nil {
+		h.versions = h.versions[:len(h.versions)-1]
+		return nil, err
+	}
+
+	return version, nil
+}
+
+// Checkout writes the data of the given version to w. The version is rebuilt starting from the nearest snapshot,
+// verifying the integrity of each version along the way.
+func (h *History) Checkout(number int, w io.Writer) error {
+	data, err := h.checkout(number)
+	if err != nil {
+		return err
+	}
+
+	if _, err = w.Write(data); err != nil {
+		return fmt.Errorf("error writing version %d: %w", number, err)
+	}
+	return nil
+}
+
+// Verify checks the integrity of all the versions
+func (h *History) Verify() error {
+	var data []byte
+	for i, version := range h.versions {
+		var err error
+		if version.Snapshot {
+			data, err = h.loadSnapshot(version)
+		} else if i == 0 {
+			err = fmt.Errorf("version %d is stored as diffs, but there's no previous version: %w", version.Number, ErrNotFound)
+		} else {
+			data, err = h.applyDiffs(data, version)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prune removes all the versions older than the given one. If the given version isn't a snapshot,
+// it's stored in full first, so that it can still be rebuilt.
+func (h *History) Prune(oldest int) error {
+	i := h.versionIndex(oldest)
+	if i < 0 {
+		return fmt.Errorf("version %d: %w", oldest, ErrNotFound)
+	}
+
+	version := h.versions[i]
+	if !version.Snapshot {
+		data, err := h.checkout(oldest)
+		if err != nil {
+			return fmt.Errorf("error loading version %d: %w", oldest, err)
+		}
+
+		snapshot := *version
+		snapshot.Snapshot = true
+		if err = writeFileAtomic(h.versionPath(&snapshot), data); err != nil {
+			return fmt.Errorf("error writing version %d snapshot: %w", oldest, err)
+		}
+		h.versions[i] = &snapshot
+		if err = h.writeIndex(); err != nil {
+			return err
+		}
+		if err = os.Remove(h.versionPath(version)); err != nil {
+			return fmt.Errorf("error removing version %d diffs: %w", oldest, err)
+		}
+	}
+
+	pruned := h.versions[:i]
+	h.versions = h.versions[i:]
+	if err := h.writeIndex(); err != nil {
+		return err
+	}
+
+	for _, version := range pruned {
+		if err := os.Remove(h.versionPath(version)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error removing version %d: %w", version.Number, err)
+		}
+	}
+
+	return nil
+}
+
+func (h *History) checkout(number int) ([]byte, error) {
+	i := h.versionIndex(number)
+	if i < 0 {
+		return nil, fmt.Errorf("version %d: %w", number, ErrNotFound)
+	}
+
+	// Find the nearest snapshot
+	start := i
+	for start >= 0 && !h.versions[start].Snapshot {
+		start--
+	}
+	if start < 0 {
+		return nil, fmt.Errorf("snapshot for version %d: %w", number, ErrNotFound)
+	}
+
+	data, err := h.loadSnapshot(h.versions[start])
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply all the diffs until the requested version
+	for _, version := range h.versions[start+1 : i+1] {
+		if data, err = h.applyDiffs(data, version); err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+func (h *History) loadSnapshot(version *HistoryVersion) ([]byte, error) {
+	data, err := os.ReadFile(h.versionPath(version))
+	if err != nil {
+		return nil, fmt.Errorf("error reading version %d snapshot: %w", version.Number, err)
+	}
+	if err = verifyVersion(version, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (h *History) applyDiffs(previous []byte, version *HistoryVersion) ([]byte, error) {
+	f, err := os.Open(h.versionPath(version))
+	if err != nil {
+		return nil, fmt.Errorf("error opening version %d diffs: %w", version.Number, err)
+	}
+	defer f.Close()
+
+	diffs, err := ReadDiffs(f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading version %d diffs: %w", version.Number, err)
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(int(version.Size))
+	if err = Patch(bytes.NewReader(previous), diffs, &buf); err != nil {
+		return nil, fmt.Errorf("error patching version %d: %w", version.Number, err)
+	}
+
+	if err = verifyVersion(version, buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func verifyVersion(version *HistoryVersion, data []byte) error {
+	digest := sha256.Sum256(data)
+	if int64(len(data)) != version.Size || hex.EncodeToString(digest[:]) != version.Digest {
+		return fmt.Errorf("version %d integrity check failed, expected size=%d digest=%s, got size=%d digest=%s: %w",
+			version.Number, version.Size, version.Digest, len(data), hex.EncodeToString(digest[:]), ErrChecksumMismatch)
+	}
+	return nil
+}
+
+func (h *History) latestSnapshot() *HistoryVersion {
+	for i := len(h.versions) - 1; i >= 0; i-- {
+		if h.versions[i].Snapshot {
+			return h.versions[i]
+		}
+	}
+	return nil
+}
+
+func (h *History) versionIndex(number int) int {
+	for i, version := range h.versions {
+		if version.Number == number {
+			return i
+		}
+	}
+	return -1
+}
+
+func (h *History) versionPath(version *HistoryVersion) string {
+	if version.Snapshot {
+		return filepath.Join(h.dir, fmt.Sprintf("%08d.snapshot", version.Number))
+	}
+	return filepath.Join(h.dir, fmt.Sprintf("%08d.diffs", version.Number))
+}
+
+func (h *History) writeIndex() error {
+	index, err := json.MarshalIndent(h.versions, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding history index: %w", err)
+	}
+	if err = writeFileAtomic(filepath.Join(h.dir, historyIndexFile), index); err != nil {
+		return fmt.Errorf("error writing history index: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes the data to a temporary file first, then renames it, so that the file is never partially written
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,147 @@
+package godiff_test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"github.com/mihailozarinschi/godiff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// historyVersions are consecutive versions of the same text
+var historyVersions = []string{
+	loremIpsum,
+	strings.Replace(loremIpsum, "consectetur", "xxxxxxxxxxx", 1),
+	strings.Replace(loremIpsum, "consectetur", "xxxxxxxxxxx", 1) + " Appended data.",
+	"Prepended data. " + strings.Replace(loremIpsum, "consectetur", "xxxxxxxxxxx", 1) + " Appended data.",
+	"Prepended data. " + loremIpsum[100:] + " Appended data.",
+	"",
+	loremIpsum,
+}
+
+func commitHistoryVersions(t *testing.T, h *godiff.History) {
+	for i, data := range historyVersions {
+		version, err := h.Commit(strings.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, i, version.Number)
+		require.Equal(t, int64(len(data)), version.Size)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	tt := []struct {
+		name             string
+		snapshotInterval int
+		snapshots        []int
+	}{
+		{
+			name:             "only snapshots",
+			snapshotInterval: 1,
+			snapshots:        []int{0, 1, 2, 3, 4, 5, 6},
+		},
+		{
+			name:             "snapshot every 3 versions",
+			snapshotInterval: 3,
+			snapshots:        []int{0, 3, 6},
+		},
+		{
+			name:             "single snapshot",
+			snapshotInterval: 100,
+			snapshots:        []int{0},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			h, err := godiff.OpenHistory(dir, tc.snapshotInterval, sha1.New, 4, 16, 7)
+			require.NoError(t, err)
+			commitHistoryVersions(t, h)
+
+			var snapshots []int
+			for _, version := range h.Versions() {
+				if version.Snapshot {
+					snapshots = append(snapshots, version.Number)
+				}
+			}
+			assert.Equal(t, tc.snapshots, snapshots)
+
+			// Reopen the history from disk, everything must be there
+			h, err = godiff.OpenHistory(dir, tc.snapshotInterval, sha1.New, 4, 16, 7)
+			require.NoError(t, err)
+			require.Equal(t, len(historyVersions), len(h.Versions()))
+			require.NoError(t, h.Verify())
+
+			for i, data := range historyVersions {
+				var buf bytes.Buffer
+				require.NoError(t, h.Checkout(i, &buf))
+				assert.Equal(t, data, buf.String())
+			}
+
+			require.Error(t, h.Checkout(len(historyVersions), &bytes.Buffer{}))
+		})
+	}
+}
+
+func TestHistoryPrune(t *testing.T) {
+	dir := t.TempDir()
+
+	h, err := godiff.OpenHistory(dir, 100, sha1.New, 4, 16, 7)
+	require.NoError(t, err)
+	commitHistoryVersions(t, h)
+
+	require.NoError(t, h.Prune(3))
+	require.Equal(t, 4, len(h.Versions()))
+	assert.Equal(t, 3, h.Versions()[0].Number)
+	assert.True(t, h.Versions()[0].Snapshot)
+	require.NoError(t, h.Verify())
+
+	// Pruned versions are gone, the others are still there
+	for i, data := range historyVersions {
+		var buf bytes.Buffer
+		err = h.Checkout(i, &buf)
+		if i < 3 {
+			require.Error(t, err)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, data, buf.String())
+	}
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	assert.Equal(t, []string{"00000003.snapshot", "00000004.diffs", "00000005.diffs", "00000006.diffs", "history.json"}, names)
+
+	// New versions still follow the remaining ones
+	version, err := h.Commit(strings.NewReader("new version"))
+	require.NoError(t, err)
+	assert.Equal(t, 7, version.Number)
+}
+
+func TestHistoryCorrupted(t *testing.T) {
+	dir := t.TempDir()
+
+	h, err := godiff.OpenHistory(dir, 100, sha1.New, 4, 16, 7)
+	require.NoError(t, err)
+	commitHistoryVersions(t, h)
+
+	// Tamper with one of the versions' diffs, replacing the added data
+	path := filepath.Join(dir, "00000003.diffs")
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, bytes.Replace(data, []byte("Prepended"), []byte("Tampered!"), 1), 0o644))
+
+	require.Error(t, h.Verify())
+	require.NoError(t, h.Checkout(2, &bytes.Buffer{}))
+	require.Error(t, h.Checkout(3, &bytes.Buffer{}))
+	require.Error(t, h.Checkout(4, &bytes.Buffer{}))
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package godiff
+
+import (
+	"os"
+)
+
+// fileInode provides 0, there are no inodes on this platform
+func fileInode(info os.FileInfo) uint64 {
+	return 0
+}
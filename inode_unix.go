@@ -0,0 +1,16 @@
+//go:build unix
+
+package godiff
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileInode provides the inode of the file, so that a file replaced by another one is told apart
+func fileInode(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
@@ -0,0 +1,606 @@
+package godiff
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Operations of a JSON Patch (RFC 6902)
+const (
+	JSONPatchAdd     = "add"
+	JSONPatchRemove  = "remove"
+	JSONPatchReplace = "replace"
+	JSONPatchMove    = "move"
+	JSONPatchCopy    = "copy"
+	JSONPatchTest    = "test"
+)
+
+// JSONPatchOperation is an operation of a JSON Patch (RFC 6902), a JSON Patch being a list of them. Paths are JSON
+// Pointers (RFC 6901).
+type JSONPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// DiffJSON provides the JSON Patch going from the original JSON document to the updated one, comparing their
+// structures instead of their bytes. Objects are diffed member by member, and arrays element by element with the
+// engine of DiffSlices. Unchanged values found elsewhere are moved or copied instead of being added again.
+func DiffJSON(original, updated []byte) ([]*JSONPatchOperation, error) {
+	o, err := decodeJSON(original)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding original JSON: %w", err)
+	}
+	u, err := decodeJSON(updated)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding updated JSON: %w", err)
+	}
+
+	d := jsonDiffer{patch: []*JSONPatchOperation{}} // An empty patch is encoded as [], not null
+	d.diff("", o, u)
+	return d.patch, nil
+}
+
+// ApplyJSONPatch applies the JSON Patch to the JSON document, and provides the patched document. The document is
+// encoded again: the members of its objects are sorted, and the insignificant spaces removed.
+func ApplyJSONPatch(document []byte, patch []*JSONPatchOperation) ([]byte, error) {
+	doc, err := decodeJSON(document)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding JSON document: %w", err)
+	}
+
+	for i, op := range patch {
+		if doc, err = applyJSONOperation(doc, op); err != nil {
+			return nil, fmt.Errorf("error applying operation #%d (%s %q): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return encodeJSON(doc), nil
+}
+
+type jsonDiffer struct {
+	patch []*JSONPatchOperation
+}
+
+func (d *jsonDiffer) add(op, path, from string, value interface{}) {
+	operation := &JSONPatchOperation{Op: op, Path: path, From: from}
+	if op == JSONPatchAdd || op == JSONPatchReplace {
+		operation.Value = encodeJSON(value)
+	}
+	d.patch = append(d.patch, operation)
+}
+
+func (d *jsonDiffer) diff(path string, original, updated interface{}) {
+	switch o := original.(type) {
+	case map[string]interface{}:
+		if u, ok := updated.(map[string]interface{}); ok {
+			d.diffObjects(path, o, u)
+			return
+		}
+	case []interface{}:
+		if u, ok := updated.([]interface{}); ok {
+			d.diffArrays(path, o, u)
+			return
+		}
+	}
+	if !jsonEqual(original, updated) {
+		d.add(JSONPatchReplace, path, "", updated)
+	}
+}
+
+// diffObjects removes the members missing from the updated object, diffs the common ones, then adds the new ones,
+// moving the removed members with the same value, or copying the common members with the same value
+func (d *jsonDiffer) diffObjects(path string, original, updated map[string]interface{}) {
+	var removed, common, added []string
+	for _, key := range sortedKeys(original) {
+		if _, ok := updated[key]; ok {
+			common = append(common, key)
+		} else {
+			removed = append(removed, key)
+		}
+	}
+	for _, key := range sortedKeys(updated) {
+		if _, ok := original[key]; !ok {
+			added = append(added, key)
+		}
+	}
+
+	movedFrom := make(map[string]string) // Removed key by added key
+	moved := make(map[string]bool)
+	for _, a := range added {
+		for _, r := range removed {
+			if !moved[r] && jsonEqual(original[r], updated[a]) {
+				movedFrom[a] = r
+				moved[r] = true
+				break
+			}
+		}
+	}
+
+	for _, key := range removed {
+		if !moved[key] {
+			d.add(JSONPatchRemove, path+"/"+escapeJSONPointer(key), "", nil)
+		}
+	}
+	commonValues := make([]interface{}, len(common))
+	for i, key := range common {
+		d.diff(path+"/"+escapeJSONPointer(key), original[key], updated[key])
+		commonValues[i] = updated[key]
+	}
+	for _, key := range added {
+		if r, ok := movedFrom[key]; ok {
+			d.add(JSONPatchMove, path+"/"+escapeJSONPointer(key), path+"/"+escapeJSONPointer(r), nil)
+			continue
+		}
+		if c, ok := findJSONCopy(updated[key], commonValues); ok {
+			d.add(JSONPatchCopy, path+"/"+escapeJSONPointer(key), path+"/"+escapeJSONPointer(common[c]), nil)
+			continue
+		}
+		d.add(JSONPatchAdd, path+"/"+escapeJSONPointer(key), "", updated[key])
+	}
+}
+
+// diffArrays builds the updated array element by element, from the start: the original elements kept, moved or
+// changed into it are moved in place if needed (and diffed), the removed ones are removed when reached, and the
+// new ones added or copied
+func (d *jsonDiffer) diffArrays(path string, original, updated []interface{}) {
+	originalKeys, updatedKeys := make([]string, len(original)), make([]string, len(updated))
+	for i, value := range original {
+		originalKeys[i] = string(encodeJSON(value))
+	}
+	for i, value := range updated {
+		updatedKeys[i] = string(encodeJSON(value))
+	}
+
+	removed, added := make([]bool, len(original)), make([]bool, len(updated))
+	for _, delta := range DiffSlices(originalKeys, updatedKeys) {
+		if delta.Type == DeltaTypeRemove {
+			removed[delta.Position] = true
+		} else {
+			added[delta.Position] = true
+		}
+	}
+
+	// Source of each updated element in the original array, or -1 for the new ones. The removed elements are
+	// indexed by key, in order, to be moved where the same ones are added.
+	source := make([]int, len(updated))
+	used := make([]bool, len(original))
+	removedByKey := make(map[string][]int)
+	for o := range original {
+		if removed[o] {
+			removedByKey[originalKeys[o]] = append(removedByKey[originalKeys[o]], o)
+		}
+	}
+	for u := range updated {
+		source[u] = -1
+		if candidates := removedByKey[updatedKeys[u]]; added[u] && len(candidates) > 0 {
+			source[u], used[candidates[0]] = candidates[0], true
+			removedByKey[updatedKeys[u]] = candidates[1:]
+		}
+	}
+
+	// Kept elements are in the same order in both, the changes in between them are paired in order
+	var o, u int
+	var changedOriginal, changedUpdated []int
+	pairChanges := func() {
+		for i := 0; i < len(changedOriginal) && i < len(changedUpdated); i++ {
+			source[changedUpdated[i]], used[changedOriginal[i]] = changedOriginal[i], true
+		}
+		changedOriginal, changedUpdated = changedOriginal[:0], changedUpdated[:0]
+	}
+	for o < len(original) || u < len(updated) {
+		switch {
+		case o < len(original) && removed[o]:
+			if !used[o] {
+				changedOriginal = append(changedOriginal, o)
+			}
+			o++
+		case u < len(updated) && added[u]:
+			if source[u] < 0 {
+				changedUpdated = append(changedUpdated, u)
+			}
+			u++
+		default:
+			pairChanges()
+			source[u], used[o] = o, true
+			o++
+			u++
+		}
+	}
+	pairChanges()
+
+	// The array is made of the updated elements done, followed by the original elements left, in order: their
+	// positions are counted in a Fenwick tree
+	left := newFenwickTree(len(original))
+	for o := range original {
+		left.add(o, 1)
+	}
+	moved := make([]bool, len(original))
+	next := 0                      // First original element left
+	copies := make(map[string]int) // First updated element done, by key
+	for i := range updated {
+		for ; next < len(original) && (!used[next] || moved[next]); next++ {
+			if !used[next] {
+				d.add(JSONPatchRemove, path+"/"+strconv.Itoa(i), "", nil)
+				left.add(next, -1)
+			}
+		}
+
+		if source[i] < 0 {
+			// The elements before are the updated ones already
+			if c, ok := copies[updatedKeys[i]]; ok && isJSONContainer(updated[i]) {
+				d.add(JSONPatchCopy, path+"/"+strconv.Itoa(i), path+"/"+strconv.Itoa(c), nil)
+			} else {
+				d.add(JSONPatchAdd, path+"/"+strconv.Itoa(i), "", updated[i])
+			}
+		} else {
+			if at := i + left.sum(source[i]); at != i {
+				d.add(JSONPatchMove, path+"/"+strconv.Itoa(i), path+"/"+strconv.Itoa(at), nil)
+			}
+			left.add(source[i], -1)
+			moved[source[i]] = true
+			d.diff(path+"/"+strconv.Itoa(i), original[source[i]], updated[i])
+		}
+		if _, ok := copies[updatedKeys[i]]; !ok {
+			copies[updatedKeys[i]] = i
+		}
+	}
+	for i := len(updated) + left.sum(len(original)) - 1; i >= len(updated); i-- {
+		d.add(JSONPatchRemove, path+"/"+strconv.Itoa(i), "", nil)
+	}
+}
+
+// isJSONContainer tells whether the value is an object or an array
+func isJSONContainer(value interface{}) bool {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// fenwickTree counts values by index, providing the sum of the ones before an index in O(log n)
+type fenwickTree []int
+
+func newFenwickTree(n int) fenwickTree {
+	return make(fenwickTree, n+1)
+}
+
+func (t fenwickTree) add(i, delta int) {
+	for i++; i < len(t); i += i & -i {
+		t[i] += delta
+	}
+}
+
+// sum provides the sum of the values before i
+func (t fenwickTree) sum(i int) int {
+	var sum int
+	for ; i > 0; i -= i & -i {
+		sum += t[i]
+	}
+	return sum
+}
+
+// findJSONCopy provides the index of the first candidate which is the same object or array as the value, if any.
+// Scalars are cheaper to add than to copy.
+func findJSONCopy(value interface{}, candidates []interface{}) (int, bool) {
+	if !isJSONContainer(value) {
+		return 0, false
+	}
+	for i, candidate := range candidates {
+		if jsonEqual(candidate, value) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func applyJSONOperation(doc interface{}, op *JSONPatchOperation) (interface{}, error) {
+	path, err := parseJSONPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case JSONPatchAdd, JSONPatchReplace, JSONPatchTest:
+		if len(op.Value) == 0 {
+			return nil, fmt.Errorf("missing value: %w", ErrInvalidDiffs)
+		}
+		value, err := decodeJSON(op.Value)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding value: %w", err)
+		}
+
+		switch op.Op {
+		case JSONPatchAdd:
+			return jsonAdd(doc, path, value)
+		case JSONPatchReplace:
+			if len(path) == 0 {
+				return value, nil
+			}
+			if doc, _, err = jsonRemove(doc, path); err != nil {
+				return nil, err
+			}
+			return jsonAdd(doc, path, value)
+		default:
+			actual, err := jsonGet(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !jsonEqual(actual, value) {
+				return nil, fmt.Errorf("value is %s: %w", encodeJSON(actual), ErrInvalidDiffs)
+			}
+			return doc, nil
+		}
+
+	case JSONPatchRemove:
+		doc, _, err = jsonRemove(doc, path)
+		return doc, err
+
+	case JSONPatchMove, JSONPatchCopy:
+		from, err := parseJSONPointer(op.From)
+		if err != nil {
+			return nil, fmt.Errorf("invalid from: %w", err)
+		}
+
+		var value interface{}
+		if op.Op == JSONPatchMove {
+			if strings.HasPrefix(op.Path, op.From+"/") {
+				return nil, fmt.Errorf("can't move %q into itself: %w", op.From, ErrInvalidDiffs)
+			}
+			doc, value, err = jsonRemove(doc, from)
+		} else {
+			value, err = jsonGet(doc, from)
+			value = copyJSON(value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return jsonAdd(doc, path, value)
+
+	default:
+		return nil, fmt.Errorf("unknown operation: %w", ErrInvalidDiffs)
+	}
+}
+
+// jsonAdd adds the value at the path: a member is set, and an element inserted
+func jsonAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return jsonUpdate(doc, path, func(container interface{}, token string) (interface{}, error) {
+		switch c := container.(type) {
+		case map[string]interface{}:
+			c[token] = value
+			return c, nil
+		case []interface{}:
+			i := len(c)
+			if token != "-" {
+				var err error
+				if i, err = jsonIndex(token, len(c)+1); err != nil {
+					return nil, err
+				}
+			}
+			// In place, as the objects are
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = value
+			return c, nil
+		default:
+			return nil, fmt.Errorf("parent of %q isn't an object or an array: %w", token, ErrInvalidDiffs)
+		}
+	})
+}
+
+// jsonRemove removes the value at the path, and provides it
+func jsonRemove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("can't remove the whole document: %w", ErrInvalidDiffs)
+	}
+
+	var removed interface{}
+	doc, err := jsonUpdate(doc, path, func(container interface{}, token string) (interface{}, error) {
+		child, err := jsonChild(container, token)
+		if err != nil {
+			return nil, err
+		}
+		removed = child
+
+		if m, ok := container.(map[string]interface{}); ok {
+			delete(m, token)
+			return m, nil
+		}
+		c := container.([]interface{})
+		i, _ := jsonIndex(token, len(c))
+		copy(c[i:], c[i+1:])
+		c[len(c)-1] = nil
+		return c[:len(c)-1], nil
+	})
+	return doc, removed, err
+}
+
+func jsonGet(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		var err error
+		if doc, err = jsonChild(doc, token); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// jsonUpdate replaces the container holding the value at the path by the one provided by fn
+func jsonUpdate(doc interface{}, path []string, fn func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	child, err := jsonChild(doc, path[0])
+	if err != nil {
+		return nil, err
+	}
+	if child, err = jsonUpdate(child, path[1:], fn); err != nil {
+		return nil, err
+	}
+
+	switch c := doc.(type) {
+	case map[string]interface{}:
+		c[path[0]] = child
+	case []interface{}:
+		i, _ := jsonIndex(path[0], len(c))
+		c[i] = child
+	}
+	return doc, nil
+}
+
+func jsonChild(doc interface{}, token string) (interface{}, error) {
+	switch d := doc.(type) {
+	case map[string]interface{}:
+		child, ok := d[token]
+		if !ok {
+			return nil, fmt.Errorf("member %q not found: %w", token, ErrInvalidDiffs)
+		}
+		return child, nil
+	case []interface{}:
+		i, err := jsonIndex(token, len(d))
+		if err != nil {
+			return nil, err
+		}
+		return d[i], nil
+	default:
+		return nil, fmt.Errorf("parent of %q isn't an object or an array: %w", token, ErrInvalidDiffs)
+	}
+}
+
+// jsonIndex parses the index of an array element, which must be less than n
+func jsonIndex(token string, n int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || strconv.Itoa(i) != token {
+		return 0, fmt.Errorf("invalid array index %q: %w", token, ErrInvalidDiffs)
+	}
+	if i >= n {
+		return 0, fmt.Errorf("array index %d is out of range: %w", i, ErrInvalidDiffs)
+	}
+	return i, nil
+}
+
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("invalid JSON pointer %q: %w", pointer, ErrInvalidDiffs)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func escapeJSONPointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+// jsonEqual tells whether 2 decoded JSON values are the same, numbers being compared by value
+func jsonEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			other, ok := b[key]
+			if !ok || !jsonEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, okX := new(big.Rat).SetString(string(a))
+		y, okY := new(big.Rat).SetString(string(b))
+		if !okX || !okY {
+			return a == b
+		}
+		return x.Cmp(y) == 0
+	default:
+		return a == b
+	}
+}
+
+func copyJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			c[key] = copyJSON(child)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, child := range v {
+			c[i] = copyJSON(child)
+		}
+		return c
+	default:
+		return value
+	}
+}
+
+// decodeJSON decodes a single JSON value, keeping the numbers as they're written
+func decodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, fmt.Errorf("invalid JSON (%s): %w", err, ErrInvalidFormat)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid JSON, data after the value: %w", ErrInvalidFormat)
+	}
+	return value, nil
+}
+
+// encodeJSON encodes a decoded JSON value, which can't fail
+func encodeJSON(value interface{}) []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(value)
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,323 @@
+package godiff_test
+
+import (
+	"encoding/json"
+	"github.com/mihailozarinschi/godiff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"testing"
+)
+
+func TestDiffJSON(t *testing.T) {
+	tt := []struct {
+		name     string
+		original string
+		updated  string
+		patch    string
+	}{
+		{
+			name:     "same",
+			original: `{"a": 1, "b": [1, 2]}`,
+			updated:  `{"b": [1, 2], "a": 1.0}`,
+			patch:    `[]`,
+		},
+		{
+			name:     "members",
+			original: `{"name": "app", "port": 80, "debug": true, "tls": {"cert": "a.pem", "key": "a.key"}}`,
+			updated:  `{"name": "app", "port": 8080, "verbose": true, "tls": {"cert": "b.pem", "key": "a.key"}}`,
+			patch: `[
+				{"op": "replace", "path": "/port", "value": 8080},
+				{"op": "replace", "path": "/tls/cert", "value": "b.pem"},
+				{"op": "move", "path": "/verbose", "from": "/debug"}
+			]`,
+		},
+		{
+			name:     "removed and added members",
+			original: `{"a": 1, "b": 2}`,
+			updated:  `{"a": 1, "c": {"d": null}}`,
+			patch: `[
+				{"op": "remove", "path": "/b"},
+				{"op": "add", "path": "/c", "value": {"d": null}}
+			]`,
+		},
+		{
+			name:     "copied member",
+			original: `{"default": {"retries": 3}}`,
+			updated:  `{"default": {"retries": 3}, "custom": {"retries": 3}}`,
+			patch:    `[{"op": "copy", "path": "/custom", "from": "/default"}]`,
+		},
+		{
+			name:     "escaped keys",
+			original: `{"a/b": 1, "c~d": 2}`,
+			updated:  `{"a/b": 2, "c~d": 2}`,
+			patch:    `[{"op": "replace", "path": "/a~1b", "value": 2}]`,
+		},
+		{
+			name:     "array elements",
+			original: `{"list": [1, 2, 3, 4]}`,
+			updated:  `{"list": [1, 3, 4, 5]}`,
+			patch: `[
+				{"op": "remove", "path": "/list/1"},
+				{"op": "add", "path": "/list/3", "value": 5}
+			]`,
+		},
+		{
+			name:     "changed array element",
+			original: `[{"id": 1, "v": "a"}, {"id": 2, "v": "b"}]`,
+			updated:  `[{"id": 1, "v": "a"}, {"id": 2, "v": "c"}]`,
+			patch:    `[{"op": "replace", "path": "/1/v", "value": "c"}]`,
+		},
+		{
+			name:     "moved array element",
+			original: `["a", "b", "c", "d"]`,
+			updated:  `["d", "a", "b", "c"]`,
+			patch:    `[{"op": "move", "path": "/0", "from": "/3"}]`,
+		},
+		{
+			name:     "copied array element",
+			original: `[[1, 2]]`,
+			updated:  `[[1, 2], [1, 2]]`,
+			patch:    `[{"op": "copy", "path": "/1", "from": "/0"}]`,
+		},
+		{
+			name:     "shorter array",
+			original: `[1, 2, 3]`,
+			updated:  `[]`,
+			patch: `[
+				{"op": "remove", "path": "/2"},
+				{"op": "remove", "path": "/1"},
+				{"op": "remove", "path": "/0"}
+			]`,
+		},
+		{
+			name:     "other type",
+			original: `{"a": [1]}`,
+			updated:  `{"a": {"0": 1}}`,
+			patch:    `[{"op": "replace", "path": "/a", "value": {"0": 1}}]`,
+		},
+		{
+			name:     "whole document",
+			original: `"text"`,
+			updated:  `42`,
+			patch:    `[{"op": "replace", "path": "", "value": 42}]`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			patch, err := godiff.DiffJSON([]byte(tc.original), []byte(tc.updated))
+			require.NoError(t, err)
+			actual, err := json.Marshal(patch)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.patch, string(actual))
+
+			patched, err := godiff.ApplyJSONPatch([]byte(tc.original), patch)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.updated, string(patched))
+		})
+	}
+
+	_, err := godiff.DiffJSON([]byte(`{"a": }`), []byte(`{}`))
+	assert.ErrorIs(t, err, godiff.ErrInvalidFormat)
+	_, err = godiff.DiffJSON([]byte(`{}`), []byte(`{} {}`))
+	assert.ErrorIs(t, err, godiff.ErrInvalidFormat)
+}
+
+func TestDiffJSONArrays(t *testing.T) {
+	// Any changes of arrays are patched back
+	tt := []struct {
+		original string
+		updated  string
+	}{
+		{original: `[1, 2, 3, 4, 5]`, updated: `[5, 4, 3, 2, 1]`},
+		{original: `[1, 2, 3]`, updated: `[3, 1, 2, 3, 1]`},
+		{original: `["a", "b", "a", "b"]`, updated: `["b", "a", "c"]`},
+		{original: `[{"a": 1}, {"a": 2}, [3]]`, updated: `[[3], {"a": 2}, {"a": 1, "b": 2}, {"a": 2}]`},
+		{original: `[]`, updated: `[1, [1], [1]]`},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.original+"-"+tc.updated, func(t *testing.T) {
+			patch, err := godiff.DiffJSON([]byte(tc.original), []byte(tc.updated))
+			require.NoError(t, err)
+			patched, err := godiff.ApplyJSONPatch([]byte(tc.original), patch)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.updated, string(patched))
+		})
+	}
+}
+
+func TestDiffJSONLargeArrays(t *testing.T) {
+	rnd := rand.New(rand.NewSource(48))
+	original := make([]interface{}, 20000)
+	for i := range original {
+		original[i] = map[string]int{"id": i % 5000}
+	}
+
+	// Moved, removed, added, copied and changed elements
+	updated := make([]interface{}, 0, len(original))
+	for _, i := range rnd.Perm(len(original)) {
+		switch i % 10 {
+		case 0:
+		case 1:
+			updated = append(updated, map[string]int{"id": i, "new": 1})
+		case 2:
+			updated = append(updated, map[string]int{"id": i % 5000, "changed": 1})
+		default:
+			updated = append(updated, original[i])
+		}
+	}
+
+	originalJSON, err := json.Marshal(original)
+	require.NoError(t, err)
+	updatedJSON, err := json.Marshal(updated)
+	require.NoError(t, err)
+
+	patch, err := godiff.DiffJSON(originalJSON, updatedJSON)
+	require.NoError(t, err)
+	patched, err := godiff.ApplyJSONPatch(originalJSON, patch)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(updatedJSON), string(patched))
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	// Examples of RFC 6902, appendix A
+	tt := []struct {
+		name     string
+		document string
+		patch    string
+		expected string
+		err      error
+	}{
+		{
+			name:     "add a member",
+			document: `{"foo": "bar"}`,
+			patch:    `[{"op": "add", "path": "/baz", "value": "qux"}]`,
+			expected: `{"baz": "qux", "foo": "bar"}`,
+		},
+		{
+			name:     "add an element",
+			document: `{"foo": ["bar", "baz"]}`,
+			patch:    `[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+			expected: `{"foo": ["bar", "qux", "baz"]}`,
+		},
+		{
+			name:     "append an element",
+			document: `{"foo": ["bar"]}`,
+			patch:    `[{"op": "add", "path": "/foo/-", "value": ["abc", "def"]}]`,
+			expected: `{"foo": ["bar", ["abc", "def"]]}`,
+		},
+		{
+			name:     "remove an element",
+			document: `{"foo": ["bar", "qux", "baz"]}`,
+			patch:    `[{"op": "remove", "path": "/foo/1"}]`,
+			expected: `{"foo": ["bar", "baz"]}`,
+		},
+		{
+			name:     "replace a value",
+			document: `{"baz": "qux", "foo": "bar"}`,
+			patch:    `[{"op": "replace", "path": "/baz", "value": "boo"}]`,
+			expected: `{"baz": "boo", "foo": "bar"}`,
+		},
+		{
+			name:     "move a value",
+			document: `{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+			patch:    `[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+			expected: `{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`,
+		},
+		{
+			name:     "move an element",
+			document: `{"foo": ["all", "grass", "cows", "eat"]}`,
+			patch:    `[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+			expected: `{"foo": ["all", "cows", "eat", "grass"]}`,
+		},
+		{
+			name:     "copy a value",
+			document: `{"foo": {"bar": [1]}}`,
+			patch:    `[{"op": "copy", "from": "/foo/bar", "path": "/baz"}, {"op": "add", "path": "/baz/-", "value": 2}]`,
+			expected: `{"foo": {"bar": [1]}, "baz": [1, 2]}`,
+		},
+		{
+			name:     "test a value",
+			document: `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+			patch:    `[{"op": "test", "path": "/baz", "value": "qux"}, {"op": "test", "path": "/foo/1", "value": 2.0}]`,
+			expected: `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+		},
+		{
+			name:     "add a null value",
+			document: `{"foo": "bar"}`,
+			patch:    `[{"op": "add", "path": "/child", "value": {"grandchild": null}}]`,
+			expected: `{"foo": "bar", "child": {"grandchild": null}}`,
+		},
+		{
+			name:     "test a value that differs",
+			document: `{"baz": "qux"}`,
+			patch:    `[{"op": "test", "path": "/baz", "value": "bar"}]`,
+			err:      godiff.ErrInvalidDiffs,
+		},
+		{
+			name:     "add to a missing object",
+			document: `{"foo": "bar"}`,
+			patch:    `[{"op": "add", "path": "/baz/bat", "value": "qux"}]`,
+			err:      godiff.ErrInvalidDiffs,
+		},
+		{
+			name:     "remove a missing member",
+			document: `{"foo": "bar"}`,
+			patch:    `[{"op": "remove", "path": "/baz"}]`,
+			err:      godiff.ErrInvalidDiffs,
+		},
+		{
+			name:     "index out of range",
+			document: `[1, 2]`,
+			patch:    `[{"op": "add", "path": "/3", "value": 3}]`,
+			err:      godiff.ErrInvalidDiffs,
+		},
+		{
+			name:     "invalid index",
+			document: `[1, 2]`,
+			patch:    `[{"op": "replace", "path": "/01", "value": 3}]`,
+			err:      godiff.ErrInvalidDiffs,
+		},
+		{
+			name:     "move into itself",
+			document: `{"a": {"b": {}}}`,
+			patch:    `[{"op": "move", "from": "/a", "path": "/a/b/c"}]`,
+			err:      godiff.ErrInvalidDiffs,
+		},
+		{
+			name:     "missing value",
+			document: `{}`,
+			patch:    `[{"op": "add", "path": "/a"}]`,
+			err:      godiff.ErrInvalidDiffs,
+		},
+		{
+			name:     "unknown operation",
+			document: `{}`,
+			patch:    `[{"op": "merge", "path": "/a", "value": 1}]`,
+			err:      godiff.ErrInvalidDiffs,
+		},
+		{
+			name:     "invalid document",
+			document: `{`,
+			patch:    `[]`,
+			err:      godiff.ErrInvalidFormat,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var patch []*godiff.JSONPatchOperation
+			require.NoError(t, json.Unmarshal([]byte(tc.patch), &patch))
+
+			patched, err := godiff.ApplyJSONPatch([]byte(tc.document), patch)
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expected, string(patched))
+		})
+	}
+}
@@ -0,0 +1,407 @@
+package godiff
+
+import (
+	"fmt"
+	"hash"
+	"io"
+)
+
+// MergeSource identifies which one of the merged versions a region's data comes from
+type MergeSource int
+
+func (s MergeSource) String() string {
+	switch s {
+	case MergeSourceBase:
+		return "Base"
+	case MergeSourceOurs:
+		return "Ours"
+	case MergeSourceTheirs:
+		return "Theirs"
+	default:
+		return ""
+	}
+}
+
+const (
+	MergeSourceBase MergeSource = iota
+	MergeSourceOurs
+	MergeSourceTheirs
+)
+
+// MergeRange is a range of consecutive chunks within one of the merged versions
+type MergeRange struct {
+	Position   int // Position of the first chunk
+	Chunks     []*Chunk
+	DataOffset int64
+	DataLen    int64
+}
+
+// MergeConflict describes a range of the base version that was changed differently by ours and theirs
+type MergeConflict struct {
+	Base   *MergeRange
+	Ours   *MergeRange
+	Theirs *MergeRange
+}
+
+// MergeRegion is a consecutive part of the merged data. It's either taken as it is from one of the versions,
+// or it's a conflict, in which case Conflict is set and Source/MergeRange are not relevant.
+type MergeRegion struct {
+	Source MergeSource
+	*MergeRange
+	Conflict *MergeConflict
+}
+
+// MergeResult contains the regions that make up the merged data, in order, and all the conflicts found among them
+type MergeResult struct {
+	Regions   []*MergeRegion
+	Conflicts []*MergeConflict
+
+	base, ours, theirs io.ReaderAt
+}
+
+// mergeHunk is a range of base chunks [baseStart, baseEnd) replaced by the side chunks [sideStart, sideEnd)
+type mergeHunk struct {
+	baseStart, baseEnd int
+	sideStart, sideEnd int
+}
+
+// Merge3 merges 2 concurrent updates (ours and theirs) of the same base data. All 3 versions are chunked,
+// then the changes of each side against the base are calculated. The changes touching different ranges of base chunks
+// are applied automatically, identical changes are applied once, and the rest are reported as conflicts.
+func Merge3(base, ours, theirs ReaderAt, hashFn func() hash.Hash, minChunkSize, divisor, prime int64) (*MergeResult, error) {
+	cfg, err := rabinConfig(hashFn, minChunkSize, divisor, prime)
+	if err != nil {
+		return nil, err
+	}
+
+	return Merge3WithConfig(base, ours, theirs, cfg)
+}
+
+// Merge3WithConfig works like Merge3, using the given config. The refinement mode isn't used.
+func Merge3WithConfig(base, ours, theirs ReaderAt, cfg *Config) (*MergeResult, error) {
+	cfg, err := cfg.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	baseChunks, err := ChunkDataWithConfig(base, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error chunking base data: %w", err)
+	}
+
+	oursChunks, err := ChunkDataWithConfig(ours, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error chunking ours data: %w", err)
+	}
+
+	theirsChunks, err := ChunkDataWithConfig(theirs, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error chunking theirs data: %w", err)
+	}
+
+	oursHunks, err := getMergeHunks(baseChunks, oursChunks)
+	if err != nil {
+		return nil, fmt.Errorf("error getting base vs ours changes: %w", err)
+	}
+
+	theirsHunks, err := getMergeHunks(baseChunks, theirsChunks)
+	if err != nil {
+		return nil, fmt.Errorf("error getting base vs theirs changes: %w", err)
+	}
+
+	result := &MergeResult{base: base, ours: ours, theirs: theirs}
+
+	var (
+		// Cursors for the ours and theirs hunks
+		oc, tc int
+
+		// Position of the first base chunk not merged yet
+		basePos int
+	)
+
+	for oc < len(oursHunks) || tc < len(theirsHunks) {
+		// Start a group of overlapping hunks with the first one in the base order, then extend it
+		// until no other hunk overlaps it
+		var start, end int
+		switch {
+		case tc >= len(theirsHunks) || (oc < len(oursHunks) && oursHunks[oc].baseStart <= theirsHunks[tc].baseStart):
+			start, end = oursHunks[oc].baseStart, oursHunks[oc].baseEnd
+		default:
+			start, end = theirsHunks[tc].baseStart, theirsHunks[tc].baseEnd
+		}
+
+		var oursGroup, theirsGroup []*mergeHunk
+		for extended := true; extended; {
+			extended = false
+			if oc < len(oursHunks) && overlapsHunk(oursHunks[oc], start, end) {
+				oursGroup = append(oursGroup, oursHunks[oc])
+				if oursHunks[oc].baseEnd > end {
+					end = oursHunks[oc].baseEnd
+				}
+				oc++
+				extended = true
+			}
+			if tc < len(theirsHunks) && overlapsHunk(theirsHunks[tc], start, end) {
+				theirsGroup = append(theirsGroup, theirsHunks[tc])
+				if theirsHunks[tc].baseEnd > end {
+					end = theirsHunks[tc].baseEnd
+				}
+				tc++
+				extended = true
+			}
+		}
+
+		// Everything in between was left unchanged by both sides
+		if basePos < start {
+			result.Regions = append(result.Regions, &MergeRegion{Source: MergeSourceBase, MergeRange: newMergeRange(baseChunks, basePos, start)})
+		}
+		basePos = end
+
+		switch {
+		case len(theirsGroup) == 0:
+			// Changed only by ours
+			oursStart, oursEnd := sideRange(oursGroup, start, end)
+			result.Regions = append(result.Regions, &MergeRegion{Source: MergeSourceOurs, MergeRange: newMergeRange(oursChunks, oursStart, oursEnd)})
+
+		case len(oursGroup) == 0:
+			// Changed only by theirs
+			theirsStart, theirsEnd := sideRange(theirsGroup, start, end)
+			result.Regions = append(result.Regions, &MergeRegion{Source: MergeSourceTheirs, MergeRange: newMergeRange(theirsChunks, theirsStart, theirsEnd)})
+
+		default:
+			// Changed by both, it's a conflict unless they made exactly the same change
+			oursStart, oursEnd := sideRange(oursGroup, start, end)
+			theirsStart, theirsEnd := sideRange(theirsGroup, start, end)
+			oursRange := newMergeRange(oursChunks, oursStart, oursEnd)
+			theirsRange := newMergeRange(theirsChunks, theirsStart, theirsEnd)
+
+			if sameChunks(oursRange.Chunks, theirsRange.Chunks) {
+				result.Regions = append(result.Regions, &MergeRegion{Source: MergeSourceOurs, MergeRange: oursRange})
+				continue
+			}
+
+			conflict := &MergeConflict{
+				Base:   newMergeRange(baseChunks, start, end),
+				Ours:   oursRange,
+				Theirs: theirsRange,
+			}
+			result.Conflicts = append(result.Conflicts, conflict)
+			result.Regions = append(result.Regions, &MergeRegion{Source: MergeSourceBase, MergeRange: conflict.Base, Conflict: conflict})
+		}
+	}
+
+	if basePos < len(baseChunks) {
+		result.Regions = append(result.Regions, &MergeRegion{Source: MergeSourceBase, MergeRange: newMergeRange(baseChunks, basePos, len(baseChunks))})
+	}
+
+	return result, nil
+}
+
+// WriteMerged writes the merged data to w. It fails if there's any conflict, as there's no way to decide
+// which side to take, WriteWithMarkers can be used instead.
+func (m *MergeResult) WriteMerged(w io.Writer) error {
+	if len(m.Conflicts) > 0 {
+		return fmt.Errorf("unable to write merged data, found %d conflict(s): %w", len(m.Conflicts), ErrConflict)
+	}
+
+	for i, region := range m.Regions {
+		if err := m.writeRange(w, region.Source, region.MergeRange); err != nil {
+			return fmt.Errorf("error writing region #%d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// WriteWithMarkers writes the merged data to w, surrounding the conflicts with diff3-style markers:
+//
+//	<<<<<<< ours
+//	(ours data)
+//	||||||| base
+//	(base data)
+//	=======
+//	(theirs data)
+//	>>>>>>> theirs
+//
+// It's meant for text data, a new line is added before each marker, if the data doesn't already end with one.
+func (m *MergeResult) WriteWithMarkers(w io.Writer) error {
+	lw := &lastByteWriter{w: w}
+
+	for i, region := range m.Regions {
+		if region.Conflict == nil {
+			if err := m.writeRange(lw, region.Source, region.MergeRange); err != nil {
+				return fmt.Errorf("error writing region #%d: %w", i, err)
+			}
+			continue
+		}
+
+		sections := []struct {
+			marker string
+			source MergeSource
+			r      *MergeRange
+		}{
+			{marker: "<<<<<<< ours\n", source: MergeSourceOurs, r: region.Conflict.Ours},
+			{marker: "||||||| base\n", source: MergeSourceBase, r: region.Conflict.Base},
+			{marker: "=======\n", source: MergeSourceTheirs, r: region.Conflict.Theirs},
+			{marker: ">>>>>>> theirs\n"},
+		}
+		for _, section := range sections {
+			if err := lw.writeMarker(section.marker); err != nil {
+				return fmt.Errorf("error writing region #%d marker: %w", i, err)
+			}
+			if section.r == nil {
+				continue
+			}
+			if err := m.writeRange(lw, section.source, section.r); err != nil {
+				return fmt.Errorf("error writing region #%d: %w", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *MergeResult) reader(source MergeSource) io.ReaderAt {
+	switch source {
+	case MergeSourceOurs:
+		return m.ours
+	case MergeSourceTheirs:
+		return m.theirs
+	default:
+		return m.base
+	}
+}
+
+func (m *MergeResult) writeRange(w io.Writer, source MergeSource, r *MergeRange) error {
+	_, err := io.Copy(w, io.NewSectionReader(m.reader(source), r.DataOffset, r.DataLen))
+	if err != nil {
+		return fmt.Errorf("error copying %s data at %d (len=%d): %w", source, r.DataOffset, r.DataLen, err)
+	}
+	return nil
+}
+
+// lastByteWriter keeps track of the last written byte, to know whether a new line is needed before a marker
+type lastByteWriter struct {
+	w    io.Writer
+	last byte
+	n    int64
+}
+
+func (l *lastByteWriter) Write(b []byte) (int, error) {
+	n, err := l.w.Write(b)
+	if n > 0 {
+		l.last = b[n-1]
+		l.n += int64(n)
+	}
+	return n, err
+}
+
+func (l *lastByteWriter) writeMarker(marker string) error {
+	if l.n > 0 && l.last != '\n' {
+		if _, err := io.WriteString(l, "\n"); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(l, marker)
+	return err
+}
+
+// getMergeHunks provides the ranges of base chunks that were changed by the side, and what they were changed into
+func getMergeHunks(base, side []*Chunk) ([]*mergeHunk, error) {
+	deltas, err := GetChunksDeltas(base, side)
+	if err != nil {
+		return nil, err
+	}
+	return deltasHunks(base, side, deltas)
+}
+
+// deltasHunks groups the deltas between the base and side chunks into hunks
+func deltasHunks(base, side []*Chunk, deltas []*ChunkDelta) ([]*mergeHunk, error) {
+	removed := make(map[int]bool)
+	added := make(map[int]bool)
+	for _, delta := range deltas {
+		switch delta.Type {
+		case DeltaTypeRemove:
+			removed[delta.Position] = true
+		case DeltaTypeAdd:
+			added[delta.Position] = true
+		}
+	}
+
+	var (
+		hunks   []*mergeHunk
+		current *mergeHunk
+		bc, sc  int // Cursors for the base and side chunks
+	)
+
+	// Kept chunks are in the same order in both base and side, anything in between them is a hunk
+	for bc < len(base) || sc < len(side) {
+		isRemoved := bc < len(base) && removed[bc]
+		isAdded := sc < len(side) && added[sc]
+
+		if !isRemoved && !isAdded {
+			if bc >= len(base) || sc >= len(side) || !sameChunk(base[bc], side[sc]) {
+				return nil, fmt.Errorf("kept chunks don't match at base %d and side %d: %w", bc, sc, ErrInvalidDiffs)
+			}
+			current = nil
+			bc++
+			sc++
+			continue
+		}
+
+		if current == nil {
+			current = &mergeHunk{baseStart: bc, baseEnd: bc, sideStart: sc, sideEnd: sc}
+			hunks = append(hunks, current)
+		}
+		if isRemoved {
+			bc++
+			current.baseEnd = bc
+		}
+		if isAdded {
+			sc++
+			current.sideEnd = sc
+		}
+	}
+
+	return hunks, nil
+}
+
+// overlapsHunk tells whether the hunk touches the base range [start, end), insertions at the same point
+// or at the edges of the range are considered overlapping too, as their order can't be decided.
+func overlapsHunk(h *mergeHunk, start, end int) bool {
+	return h.baseStart < end ||
+		h.baseStart == start ||
+		(h.baseStart == end && (start == end || h.baseStart == h.baseEnd))
+}
+
+// sideRange provides the range of side chunks corresponding to the base range [start, end), given the side's hunks
+// within it. The base chunks around the hunks are kept, so they shift the side range by the same amount.
+func sideRange(hunks []*mergeHunk, start, end int) (int, int) {
+	first, last := hunks[0], hunks[len(hunks)-1]
+	return first.sideStart - (first.baseStart - start), last.sideEnd + (end - last.baseEnd)
+}
+
+func newMergeRange(chunks []*Chunk, start, end int) *MergeRange {
+	r := &MergeRange{Position: start, Chunks: chunks[start:end]}
+	if start < len(chunks) {
+		r.DataOffset = chunks[start].DataOffset
+	} else if len(chunks) > 0 {
+		r.DataOffset = chunks[len(chunks)-1].DataOffset + chunks[len(chunks)-1].DataLen
+	}
+	for _, chunk := range r.Chunks {
+		r.DataLen += chunk.DataLen
+	}
+	return r
+}
+
+func sameChunks(a, b []*Chunk) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !sameChunk(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,125 @@
+package godiff_test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"github.com/mihailozarinschi/godiff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	tt := []struct {
+		name      string
+		base      string
+		ours      string
+		theirs    string
+		merged    string
+		conflicts int
+	}{
+		{
+			name:   "no changes",
+			base:   loremIpsum,
+			ours:   loremIpsum,
+			theirs: loremIpsum,
+			merged: loremIpsum,
+		},
+		{
+			name:   "changed only by ours",
+			base:   loremIpsum,
+			ours:   strings.Replace(loremIpsum, "consectetur", "xxxxxxxxxxx", 1),
+			theirs: loremIpsum,
+			merged: strings.Replace(loremIpsum, "consectetur", "xxxxxxxxxxx", 1),
+		},
+		{
+			name:   "changed only by theirs",
+			base:   loremIpsum,
+			ours:   loremIpsum,
+			theirs: strings.Replace(loremIpsum, "consectetur", "xxxxxxxxxxx", 1),
+			merged: strings.Replace(loremIpsum, "consectetur", "xxxxxxxxxxx", 1),
+		},
+		{
+			name:   "non-overlapping changes",
+			base:   loremIpsum,
+			ours:   strings.Replace(loremIpsum, "consectetur", "xxxxxxxxxxx", 1),
+			theirs: strings.Replace(loremIpsum, "Excepteur", "yyyyyyyyy", 1) + " Appended data.",
+			merged: strings.Replace(strings.Replace(loremIpsum, "consectetur", "xxxxxxxxxxx", 1), "Excepteur", "yyyyyyyyy", 1) + " Appended data.",
+		},
+		{
+			name:   "same changes",
+			base:   loremIpsum,
+			ours:   strings.Replace(loremIpsum, "consectetur", "xxxxxxxxxxx", 1),
+			theirs: strings.Replace(loremIpsum, "consectetur", "xxxxxxxxxxx", 1),
+			merged: strings.Replace(loremIpsum, "consectetur", "xxxxxxxxxxx", 1),
+		},
+		{
+			name:      "conflicting changes",
+			base:      loremIpsum,
+			ours:      strings.Replace(loremIpsum, "consectetur", "xxxxxxxxxxx", 1),
+			theirs:    strings.Replace(loremIpsum, "consectetur", "yyyyyyyyyyy", 1),
+			conflicts: 1,
+		},
+		{
+			name:      "conflicting insertions",
+			base:      loremIpsum,
+			ours:      "Ours prepended data. " + loremIpsum,
+			theirs:    "Theirs prepended data. " + loremIpsum,
+			conflicts: 1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			base := strings.NewReader(tc.base)
+			ours := strings.NewReader(tc.ours)
+			theirs := strings.NewReader(tc.theirs)
+
+			result, err := godiff.Merge3(base, ours, theirs, sha1.New, 4, 16, 7)
+			require.NoError(t, err)
+			require.Equal(t, tc.conflicts, len(result.Conflicts))
+
+			var merged bytes.Buffer
+			err = result.WriteMerged(&merged)
+			if tc.conflicts > 0 {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.merged, merged.String())
+
+			// Without conflicts, there are no markers either
+			var withMarkers bytes.Buffer
+			require.NoError(t, result.WriteWithMarkers(&withMarkers))
+			assert.Equal(t, tc.merged, withMarkers.String())
+		})
+	}
+}
+
+func TestMerge3WithMarkers(t *testing.T) {
+	base := "first line\nsecond line\nthird line\n"
+	ours := "first line\nsecond line changed by ours\nthird line\n"
+	theirs := "first line\nsecond line changed by theirs\nthird line\n"
+
+	result, err := godiff.Merge3(strings.NewReader(base), strings.NewReader(ours), strings.NewReader(theirs), sha1.New, 4, 16, 7)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(result.Conflicts))
+
+	// Chunks don't follow the lines, the conflict starts and ends at chunks' boundaries
+	conflict := result.Conflicts[0]
+	assert.Equal(t, "ond line\nthird line\n", base[conflict.Base.DataOffset:conflict.Base.DataOffset+conflict.Base.DataLen])
+	assert.Equal(t, "ond line changed by ours\nthird line\n", ours[conflict.Ours.DataOffset:conflict.Ours.DataOffset+conflict.Ours.DataLen])
+	assert.Equal(t, "ond line changed by theirs\nthird line\n", theirs[conflict.Theirs.DataOffset:conflict.Theirs.DataOffset+conflict.Theirs.DataLen])
+
+	var withMarkers bytes.Buffer
+	require.NoError(t, result.WriteWithMarkers(&withMarkers))
+	assert.Equal(t, "first line\nsec\n"+
+		"<<<<<<< ours\n"+
+		"ond line changed by ours\nthird line\n"+
+		"||||||| base\n"+
+		"ond line\nthird line\n"+
+		"=======\n"+
+		"ond line changed by theirs\nthird line\n"+
+		">>>>>>> theirs\n", withMarkers.String())
+}
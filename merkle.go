@@ -0,0 +1,498 @@
+package godiff
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxMerkleFanoutFactor limits the number of children of a node, relative to the fanout, as MaxChunkSize does
+const maxMerkleFanoutFactor = 4
+
+// MerkleNode is a node of a MerkleTree: a chunk for the leaves (level 0), or the hash of its children's hashes
+// for the internal nodes. It covers the data of all the chunks below it.
+type MerkleNode struct {
+	Hash       string
+	Level      int
+	DataOffset int64
+	DataLen    int64
+	Weak       uint32 // The chunk's weak checksum, leaves only
+	HasWeak    bool   // Whether Weak is set, as it can be 0
+
+	children             []*MerkleNode
+	chunkStart, chunkEnd int // Range of the tree's chunks below the node
+}
+
+// Children provides the children of the node, none for the leaves
+func (n *MerkleNode) Children() []*MerkleNode {
+	return n.children
+}
+
+// MerkleTree is a Merkle tree built over the chunks of some data, so that 2 signatures can be compared without
+// exchanging all their chunks (see SyncMerkleChunks). The boundaries of the internal nodes are content-defined,
+// as the chunks' ones: a node ends after a child whose hash hits the fanout, so that inserting or removing
+// chunks only changes the nodes above them, instead of shifting all the following nodes.
+type MerkleTree struct {
+	root   *MerkleNode
+	chunks []*Chunk
+	nodes  map[merkleKey]*MerkleNode
+}
+
+// merkleKey identifies a node, the leaves are identified by their chunk's hash
+type merkleKey struct {
+	level int
+	hash  string
+}
+
+// NewMerkleTree builds the tree of the chunks, where the nodes have fanout children on average.
+// Both sides of a comparison need to use the same fanout.
+func NewMerkleTree(chunks []*Chunk, fanout int) (*MerkleTree, error) {
+	if fanout < 2 {
+		return nil, &ParamError{Name: "fanout", Value: fanout, Reason: "must be at least 2"}
+	}
+
+	t := &MerkleTree{chunks: chunks, nodes: make(map[merkleKey]*MerkleNode)}
+	level := make([]*MerkleNode, 0, len(chunks))
+	for i, chunk := range chunks {
+		if i > 0 && chunk.DataOffset != chunks[i-1].DataOffset+chunks[i-1].DataLen {
+			return nil, fmt.Errorf("chunk #%d at %d doesn't follow the previous one: %w", i, chunk.DataOffset, ErrInvalidParams)
+		}
+		level = append(level, t.add(&MerkleNode{
+			Hash:       chunk.Hash,
+			DataOffset: chunk.DataOffset,
+			DataLen:    chunk.DataLen,
+			Weak:       chunk.Weak,
+			HasWeak:    chunk.HasWeak,
+			chunkStart: i,
+			chunkEnd:   i + 1,
+		}))
+	}
+
+	// An empty tree still has a root, so that it can be compared
+	if len(level) == 0 {
+		level = append(level, t.add(newMerkleNode(1, nil)))
+	}
+
+	for len(level) > 1 {
+		var (
+			parents []*MerkleNode
+			start   int
+		)
+		for i, node := range level {
+			children := i + 1 - start
+			last := i == len(level)-1
+			// Nodes have at least 2 children, so that each level is smaller than the previous one
+			if last || (children >= 2 && merkleBoundary(node, fanout)) || children >= fanout*maxMerkleFanoutFactor {
+				parents = append(parents, t.add(newMerkleNode(node.Level+1, level[start:i+1])))
+				start = i + 1
+			}
+		}
+		level = parents
+	}
+
+	t.root = level[0]
+	return t, nil
+}
+
+// Root provides the root node
+func (t *MerkleTree) Root() (*MerkleNode, error) {
+	return t.root, nil
+}
+
+// Children provides the children of the internal nodes with the given hashes, or ErrNotFound
+func (t *MerkleTree) Children(nodes []*MerkleNode) ([][]*MerkleNode, error) {
+	children := make([][]*MerkleNode, len(nodes))
+	for i, node := range nodes {
+		n, ok := t.nodes[merkleKey{level: node.Level, hash: node.Hash}]
+		if !ok || n.Level == 0 {
+			return nil, fmt.Errorf("node %s at level %d: %w", node.Hash, node.Level, ErrNotFound)
+		}
+		children[i] = n.children
+	}
+	return children, nil
+}
+
+// Chunks provides the chunks the tree was built over
+func (t *MerkleTree) Chunks() []*Chunk {
+	return t.chunks
+}
+
+func (t *MerkleTree) add(node *MerkleNode) *MerkleNode {
+	key := merkleKey{level: node.Level, hash: node.Hash}
+	if _, ok := t.nodes[key]; !ok {
+		t.nodes[key] = node
+	}
+	return node
+}
+
+// newMerkleNode provides the internal node of the children
+func newMerkleNode(level int, children []*MerkleNode) *MerkleNode {
+	h := sha256.New()
+	var buf [binary.MaxVarintLen64]byte
+	node := &MerkleNode{Level: level, children: children}
+	for _, child := range children {
+		h.Write(binary.AppendUvarint(buf[:0], uint64(len(child.Hash))))
+		h.Write([]byte(child.Hash))
+		h.Write(binary.AppendUvarint(buf[:0], uint64(child.DataLen)))
+		h.Write(binary.BigEndian.AppendUint32(buf[:0], child.Weak))
+		node.DataLen += child.DataLen
+	}
+	if len(children) > 0 {
+		node.DataOffset = children[0].DataOffset
+		node.chunkStart, node.chunkEnd = children[0].chunkStart, children[len(children)-1].chunkEnd
+	}
+	node.Hash = hex.EncodeToString(h.Sum(nil))
+	return node
+}
+
+// merkleBoundary tells whether a node ends after the child, depending only on the child's hash and level
+func merkleBoundary(child *MerkleNode, fanout int) bool {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s", child.Level, child.Hash)))
+	return binary.BigEndian.Uint64(sum[:])%uint64(fanout) == 0
+}
+
+// MerklePeer answers the queries about a MerkleTree, e.g. a MerkleTree itself, or a MerkleStreamPeer to query a
+// remote one
+type MerklePeer interface {
+	// Root provides the root node, without its children
+	Root() (*MerkleNode, error)
+	// Children provides the children of each of the internal nodes
+	Children(nodes []*MerkleNode) ([][]*MerkleNode, error)
+}
+
+// SyncMerkleChunks provides the chunks of the remote tree, walking it top-down along the local one: the subtrees
+// found in the local tree aren't fetched, their chunks are the local ones (at the remote offsets). There's one
+// round trip per level, fetching only the children of the nodes that differ, so nearly identical data can be
+// compared with little traffic. The remote chunks can then be compared with the local ones (see GetChunksDeltas).
+func SyncMerkleChunks(local *MerkleTree, remote MerklePeer) ([]*Chunk, error) {
+	root, err := remote.Root()
+	if err != nil {
+		return nil, fmt.Errorf("error getting remote root: %w", err)
+	}
+
+	// Frontier of the walk, in the data order: the nodes to expand have no chunks yet
+	type walkNode struct {
+		node   *MerkleNode
+		chunks []*Chunk
+	}
+	resolve := func(node *MerkleNode) *walkNode {
+		if n, ok := local.nodes[merkleKey{level: node.Level, hash: node.Hash}]; ok && n.DataLen == node.DataLen {
+			return &walkNode{node: node, chunks: shiftChunks(local.chunks[n.chunkStart:n.chunkEnd], node.DataOffset-n.DataOffset)}
+		}
+		if node.Level == 0 {
+			return &walkNode{node: node, chunks: []*Chunk{{DataOffset: node.DataOffset, DataLen: node.DataLen, Hash: node.Hash, Weak: node.Weak, HasWeak: node.HasWeak}}}
+		}
+		return &walkNode{node: node}
+	}
+
+	frontier := []*walkNode{resolve(root)}
+	for {
+		var expand []*MerkleNode
+		for _, w := range frontier {
+			if w.chunks == nil {
+				expand = append(expand, w.node)
+			}
+		}
+		if len(expand) == 0 {
+			break
+		}
+
+		children, err := remote.Children(expand)
+		if err != nil {
+			return nil, fmt.Errorf("error getting remote nodes: %w", err)
+		}
+		if len(children) != len(expand) {
+			return nil, fmt.Errorf("got the children of %d nodes, expected %d: %w", len(children), len(expand), ErrInvalidFormat)
+		}
+
+		next := make([]*walkNode, 0, len(frontier))
+		var i int
+		for _, w := range frontier {
+			if w.chunks != nil {
+				next = append(next, w)
+				continue
+			}
+			if err = checkMerkleChildren(w.node, children[i]); err != nil {
+				return nil, err
+			}
+			for _, child := range children[i] {
+				next = append(next, resolve(child))
+			}
+			i++
+		}
+		frontier = next
+	}
+
+	var chunks []*Chunk
+	for _, w := range frontier {
+		chunks = append(chunks, w.chunks...)
+	}
+	return chunks, nil
+}
+
+// checkMerkleChildren checks that the children received are the node's ones, so that a remote tree can't be
+// altered below a node
+func checkMerkleChildren(node *MerkleNode, children []*MerkleNode) error {
+	offset := node.DataOffset
+	for _, child := range children {
+		if child.Level != node.Level-1 || child.DataOffset != offset || child.DataLen < 0 {
+			return fmt.Errorf("children of node %s don't cover its data: %w", node.Hash, ErrInvalidFormat)
+		}
+		offset += child.DataLen
+	}
+	if expected := newMerkleNode(node.Level, children); expected.Hash != node.Hash {
+		return fmt.Errorf("children of node %s don't match its hash: %w", node.Hash, ErrChecksumMismatch)
+	}
+	return nil
+}
+
+// shiftChunks provides copies of the chunks, moved by offset
+func shiftChunks(chunks []*Chunk, offset int64) []*Chunk {
+	shifted := make([]*Chunk, len(chunks))
+	for i, chunk := range chunks {
+		c := *chunk
+		c.DataOffset += offset
+		shifted[i] = &c
+	}
+	return shifted
+}
+
+// The Merkle protocol lets a MerkleStreamPeer query a MerkleTree served over a stream (see MerkleTree.Serve).
+// Each request is a marker (1 byte), followed by the nodes whose children are requested for the children request
+// (uvarint count, then each node's level as uvarint and hash as uvarint length + bytes). Each response is a status
+// (1 byte), followed by a uvarint number of node lists, each one made of a uvarint number of nodes:
+//   - the level, data offset and data length (uvarints)
+//   - the weak checksum presence (1 byte), and the weak checksum (4 bytes) if present
+//   - the hash (uvarint length + bytes)
+const (
+	merkleRootRequest     = 0x01
+	merkleChildrenRequest = 0x02
+	merkleEndRequest      = 0xFF
+
+	merkleStatusOK       = 0x00
+	merkleStatusNotFound = 0x01
+
+	maxMerkleNodes = 1 << 20 // Per message, way more than needed
+)
+
+// Serve answers the requests read from r, writing the responses to w, until the end request or the end of r
+func (t *MerkleTree) Serve(r io.Reader, w io.Writer) error {
+	br := bufio.NewReader(r)
+	bw := bufio.NewWriter(w)
+	for {
+		marker, err := br.ReadByte()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading request: %w", err)
+		}
+
+		var lists [][]*MerkleNode
+		switch marker {
+		case merkleEndRequest:
+			return nil
+		case merkleRootRequest:
+			lists = [][]*MerkleNode{{t.root}}
+		case merkleChildrenRequest:
+			nodes, err := readMerkleNodeList(br, false)
+			if err != nil {
+				return fmt.Errorf("error reading request: %w", err)
+			}
+			if lists, err = t.Children(nodes); errors.Is(err, ErrNotFound) {
+				if err = writeMerkleResponse(bw, merkleStatusNotFound, nil); err != nil {
+					return err
+				}
+				continue
+			}
+		default:
+			return fmt.Errorf("unknown request marker %d: %w", marker, ErrInvalidFormat)
+		}
+
+		if err = writeMerkleResponse(bw, merkleStatusOK, lists); err != nil {
+			return err
+		}
+	}
+}
+
+// MerkleStreamPeer queries a MerkleTree served over a stream (see MerkleTree.Serve), one request at a time.
+// Close must be called once done, to end the session.
+type MerkleStreamPeer struct {
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// NewMerkleStreamPeer provides a peer writing its requests to w, and reading the responses from r
+func NewMerkleStreamPeer(r io.Reader, w io.Writer) *MerkleStreamPeer {
+	return &MerkleStreamPeer{r: bufio.NewReader(r), w: bufio.NewWriter(w)}
+}
+
+func (p *MerkleStreamPeer) Root() (*MerkleNode, error) {
+	if err := p.w.WriteByte(merkleRootRequest); err != nil {
+		return nil, fmt.Errorf("error writing request: %w", err)
+	}
+	lists, err := p.roundTrip()
+	if err != nil {
+		return nil, err
+	}
+	if len(lists) != 1 || len(lists[0]) != 1 {
+		return nil, fmt.Errorf("invalid root response: %w", ErrInvalidFormat)
+	}
+	return lists[0][0], nil
+}
+
+func (p *MerkleStreamPeer) Children(nodes []*MerkleNode) ([][]*MerkleNode, error) {
+	if err := p.w.WriteByte(merkleChildrenRequest); err != nil {
+		return nil, fmt.Errorf("error writing request: %w", err)
+	}
+	if err := writeMerkleNodeList(p.w, nodes, false); err != nil {
+		return nil, fmt.Errorf("error writing request: %w", err)
+	}
+	return p.roundTrip()
+}
+
+// Close ends the session
+func (p *MerkleStreamPeer) Close() error {
+	if err := p.w.WriteByte(merkleEndRequest); err != nil {
+		return fmt.Errorf("error writing end request: %w", err)
+	}
+	if err := p.w.Flush(); err != nil {
+		return fmt.Errorf("error writing end request: %w", err)
+	}
+	return nil
+}
+
+func (p *MerkleStreamPeer) roundTrip() ([][]*MerkleNode, error) {
+	if err := p.w.Flush(); err != nil {
+		return nil, fmt.Errorf("error writing request: %w", err)
+	}
+
+	status, err := p.r.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %w", unexpectedEOF(err))
+	}
+	count, err := readMerkleCount(p.r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %w", err)
+	}
+	switch status {
+	case merkleStatusOK:
+	case merkleStatusNotFound:
+		return nil, fmt.Errorf("remote node: %w", ErrNotFound)
+	default:
+		return nil, fmt.Errorf("unknown response status %d: %w", status, ErrInvalidFormat)
+	}
+
+	lists := make([][]*MerkleNode, 0, count)
+	for i := 0; i < count; i++ {
+		nodes, err := readMerkleNodeList(p.r, true)
+		if err != nil {
+			return nil, fmt.Errorf("error reading response: %w", err)
+		}
+		lists = append(lists, nodes)
+	}
+	return lists, nil
+}
+
+func writeMerkleResponse(w *bufio.Writer, status byte, lists [][]*MerkleNode) error {
+	buf := append(make([]byte, 0, 1+binary.MaxVarintLen64), status)
+	buf = binary.AppendUvarint(buf, uint64(len(lists)))
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("error writing response: %w", err)
+	}
+	for _, nodes := range lists {
+		if err := writeMerkleNodeList(w, nodes, true); err != nil {
+			return fmt.Errorf("error writing response: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error writing response: %w", err)
+	}
+	return nil
+}
+
+// writeMerkleNodeList writes the nodes' level and hash, and with full, their data offset, length and weak checksum
+func writeMerkleNodeList(w *bufio.Writer, nodes []*MerkleNode, full bool) error {
+	buf := binary.AppendUvarint(nil, uint64(len(nodes)))
+	for _, node := range nodes {
+		buf = binary.AppendUvarint(buf, uint64(node.Level))
+		if full {
+			buf = binary.AppendUvarint(buf, uint64(node.DataOffset))
+			buf = binary.AppendUvarint(buf, uint64(node.DataLen))
+			if node.HasWeak {
+				buf = append(buf, 1)
+				buf = binary.BigEndian.AppendUint32(buf, node.Weak)
+			} else {
+				buf = append(buf, 0)
+			}
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(node.Hash)))
+		buf = append(buf, node.Hash...)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+func readMerkleNodeList(r *bufio.Reader, full bool) ([]*MerkleNode, error) {
+	count, err := readMerkleCount(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []*MerkleNode
+	for i := 0; i < count; i++ {
+		var values [3]uint64
+		fields := values[:1]
+		if full {
+			fields = values[:]
+		}
+		for j := range fields {
+			if fields[j], err = binary.ReadUvarint(r); err != nil {
+				return nil, fmt.Errorf("error reading node #%d: %w", i, unexpectedEOF(err))
+			}
+			if fields[j] > 1<<62 {
+				return nil, fmt.Errorf("node #%d field %d is too big: %w", i, fields[j], ErrInvalidFormat)
+			}
+		}
+
+		node := &MerkleNode{Level: int(values[0]), DataOffset: int64(values[1]), DataLen: int64(values[2])}
+		if full {
+			hasWeak, err := r.ReadByte()
+			if err != nil {
+				return nil, fmt.Errorf("error reading node #%d: %w", i, unexpectedEOF(err))
+			}
+			if hasWeak > 1 {
+				return nil, fmt.Errorf("node #%d weak checksum presence %d: %w", i, hasWeak, ErrInvalidFormat)
+			}
+			if node.HasWeak = hasWeak == 1; node.HasWeak {
+				var weak [4]byte
+				if _, err = io.ReadFull(r, weak[:]); err != nil {
+					return nil, fmt.Errorf("error reading node #%d: %w", i, unexpectedEOF(err))
+				}
+				node.Weak = binary.BigEndian.Uint32(weak[:])
+			}
+		}
+		hash, err := readBytes(r, maxEncodedHashLen)
+		if err != nil {
+			return nil, fmt.Errorf("error reading node #%d hash: %w", i, err)
+		}
+		node.Hash = string(hash)
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+func readMerkleCount(r *bufio.Reader) (int, error) {
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	if count > maxMerkleNodes {
+		return 0, fmt.Errorf("%d nodes exceed the maximum of %d: %w", count, maxMerkleNodes, ErrInvalidFormat)
+	}
+	return int(count), nil
+}
@@ -0,0 +1,168 @@
+package godiff_test
+
+import (
+	"bytes"
+	"github.com/mihailozarinschi/godiff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+)
+
+func TestSyncMerkleChunks(t *testing.T) {
+	cfg := &godiff.Config{AvgChunkSize: 1024}
+	original := randomData(7, 4*1024*1024)
+
+	insert := append(append(append([]byte{}, original[:1024*1024]...), "inserted"...), original[1024*1024:]...)
+	edit := append([]byte{}, original...)
+	edit[3*1024*1024] ^= 0xFF
+	remove := append(append([]byte{}, original[:2*1024*1024]...), original[2*1024*1024+5000:]...)
+
+	tt := []struct {
+		name    string
+		updated []byte
+	}{
+		{name: "same data", updated: original},
+		{name: "insertion", updated: insert},
+		{name: "edit", updated: edit},
+		{name: "removal", updated: remove},
+		{name: "empty data", updated: nil},
+	}
+
+	localChunks, err := godiff.ChunkDataWithConfig(bytes.NewReader(original), cfg)
+	require.NoError(t, err)
+	local, err := godiff.NewMerkleTree(localChunks, 16)
+	require.NoError(t, err)
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			remoteChunks, err := godiff.ChunkDataWithConfig(bytes.NewReader(tc.updated), cfg)
+			require.NoError(t, err)
+			remote, err := godiff.NewMerkleTree(remoteChunks, 16)
+			require.NoError(t, err)
+
+			// Querying the tree directly
+			chunks, err := godiff.SyncMerkleChunks(local, remote)
+			require.NoError(t, err)
+			assert.Equal(t, remoteChunks, chunks)
+
+			// Querying the tree over a stream, counting the traffic
+			requests, responses := &countingPipe{}, &countingPipe{}
+			requests.r, requests.w = io.Pipe()
+			responses.r, responses.w = io.Pipe()
+			served := make(chan error, 1)
+			go func() {
+				served <- remote.Serve(requests, responses)
+			}()
+
+			peer := godiff.NewMerkleStreamPeer(responses, requests)
+			chunks, err = godiff.SyncMerkleChunks(local, peer)
+			require.NoError(t, err)
+			require.NoError(t, peer.Close())
+			require.NoError(t, <-served)
+			assert.Equal(t, remoteChunks, chunks)
+
+			// A few KB, instead of the whole signature (~240KB)
+			assert.Less(t, requests.n+responses.n, 16*1024)
+		})
+	}
+}
+
+func TestMerkleTreeContentDefined(t *testing.T) {
+	chunks := make([]*godiff.Chunk, 10000)
+	for i := range chunks {
+		chunks[i] = &godiff.Chunk{DataOffset: int64(i), DataLen: 1, Hash: string(randomData(int64(i), 8))}
+	}
+	tree, err := godiff.NewMerkleTree(chunks, 8)
+	require.NoError(t, err)
+
+	// Inserting a chunk only changes the nodes above it
+	inserted := append(append(append([]*godiff.Chunk{}, chunks[:5000]...), &godiff.Chunk{Hash: "inserted"}), chunks[5000:]...)
+	for i, chunk := range inserted {
+		inserted[i] = &godiff.Chunk{DataOffset: int64(i), DataLen: 1, Hash: chunk.Hash}
+	}
+	updated, err := godiff.NewMerkleTree(inserted, 8)
+	require.NoError(t, err)
+
+	original := merkleNodes(tree)
+	var changed int
+	for key := range merkleNodes(updated) {
+		if !original[key] {
+			changed++
+		}
+	}
+	assert.Less(t, changed, 16)
+}
+
+func TestSyncMerkleChunksInvalid(t *testing.T) {
+	chunks, err := godiff.ChunkDataWithConfig(bytes.NewReader(randomData(8, 256*1024)), &godiff.Config{AvgChunkSize: 1024})
+	require.NoError(t, err)
+	tree, err := godiff.NewMerkleTree(chunks, 4)
+	require.NoError(t, err)
+	empty, err := godiff.NewMerkleTree(nil, 4)
+	require.NoError(t, err)
+
+	_, err = godiff.NewMerkleTree(chunks, 1)
+	assert.ErrorIs(t, err, godiff.ErrInvalidParams)
+	_, err = godiff.NewMerkleTree([]*godiff.Chunk{chunks[0], chunks[2]}, 4)
+	assert.ErrorIs(t, err, godiff.ErrInvalidParams)
+
+	// Unknown nodes
+	_, err = tree.Children([]*godiff.MerkleNode{{Level: 1, Hash: "unknown"}})
+	assert.ErrorIs(t, err, godiff.ErrNotFound)
+
+	// Children not matching their parent
+	_, err = godiff.SyncMerkleChunks(empty, &tamperedPeer{tree})
+	assert.ErrorIs(t, err, godiff.ErrChecksumMismatch)
+}
+
+// tamperedPeer alters the hash of the first leaf
+type tamperedPeer struct {
+	*godiff.MerkleTree
+}
+
+func (p *tamperedPeer) Children(nodes []*godiff.MerkleNode) ([][]*godiff.MerkleNode, error) {
+	lists, err := p.MerkleTree.Children(nodes)
+	if err != nil {
+		return nil, err
+	}
+	for i, nodes := range lists {
+		if len(nodes) > 0 && nodes[0].Level == 0 {
+			tampered := *nodes[0]
+			tampered.Hash = "tampered"
+			lists[i] = append([]*godiff.MerkleNode{&tampered}, nodes[1:]...)
+			break
+		}
+	}
+	return lists, nil
+}
+
+// countingPipe counts the bytes going through a pipe
+type countingPipe struct {
+	r *io.PipeReader
+	w *io.PipeWriter
+	n int
+}
+
+func (p *countingPipe) Read(b []byte) (int, error) {
+	return p.r.Read(b)
+}
+
+func (p *countingPipe) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.n += n
+	return n, err
+}
+
+// merkleNodes provides the hashes of all the nodes of the tree
+func merkleNodes(tree *godiff.MerkleTree) map[string]bool {
+	root, _ := tree.Root()
+	nodes := make(map[string]bool)
+	pending := []*godiff.MerkleNode{root}
+	for len(pending) > 0 {
+		node := pending[len(pending)-1]
+		pending = append(pending[:len(pending)-1], node.Children()...)
+		nodes[node.Hash] = true
+	}
+	return nodes
+}
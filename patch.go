@@ -0,0 +1,222 @@
+package godiff
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Patch writes to w the updated data, rebuilt from the original data and the diffs (as provided by CalcDiffs).
+// The original data that wasn't removed is copied as it is, and the added data is inserted at its offset
+// in the updated data, so only the Data of the additions is needed.
+func Patch(originalData io.ReaderAt, diffs []*Diff, w io.Writer) error {
+	return PatchVerified(originalData, diffs, w, nil)
+}
+
+// PatchVerification tells what PatchVerified verifies, the nil fields aren't verified
+type PatchVerification struct {
+	// HashFn verifies the data of each diff against its hash (truncated with StrongHashLen), so it must be the one
+	// the diffs were calculated with (with the keyed chunking, the HMAC based on it). The removed chunks are read
+	// from the original data.
+	HashFn func() hash.Hash
+
+	// Source and Target are the digests of the whole original and updated data
+	Source *FileDigest
+	Target *FileDigest
+}
+
+// VerificationError tells where the data stopped matching what was expected. It matches ErrChecksumMismatch
+// with errors.Is.
+type VerificationError struct {
+	Data string // "original" or "updated"
+
+	// Delta is the first chunk whose data doesn't match its hash, ActualHash being the hash of its data.
+	// It's nil if all the chunks match, but the whole data doesn't match its digest.
+	Delta      *ChunkDelta
+	ActualHash string
+
+	Expected *FileDigest
+	Actual   *FileDigest
+}
+
+func (e *VerificationError) Error() string {
+	if e.Delta != nil {
+		return fmt.Sprintf("%s data chunk #%d at %d (len=%d) doesn't match its hash, expected %s, got %s",
+			e.Data, e.Delta.Position, e.Delta.DataOffset, e.Delta.DataLen, e.Delta.Hash, e.ActualHash)
+	}
+	return fmt.Sprintf("%s data doesn't match its digest, expected size=%d digest=%s, got size=%d digest=%s",
+		e.Data, e.Expected.Size, e.Expected.Digest, e.Actual.Size, e.Actual.Digest)
+}
+
+func (e *VerificationError) Unwrap() error {
+	return ErrChecksumMismatch
+}
+
+// PatchVerified works like Patch, verifying the data while it's being patched. The original data is read once,
+// from start to end, including the removed chunks. If anything doesn't match, a *VerificationError is returned,
+// pointing to the first chunk not matching, if any. As the data is streamed, whatever was patched until then
+// was already written to w.
+func PatchVerified(originalData io.ReaderAt, diffs []*Diff, w io.Writer, v *PatchVerification) error {
+	var removals, additions []*Diff
+	for i, diff := range diffs {
+		switch diff.Type {
+		case DeltaTypeRemove:
+			removals = append(removals, diff)
+		case DeltaTypeAdd:
+			if int64(len(diff.Data)) != diff.DataLen {
+				return fmt.Errorf("diff #%d has %d bytes of data, expected %d: %w", i, len(diff.Data), diff.DataLen, ErrInvalidDiffs)
+			}
+			additions = append(additions, diff)
+		default:
+			return fmt.Errorf("diff #%d has an unknown type %d: %w", i, diff.Type, ErrInvalidDiffs)
+		}
+	}
+
+	// Both removals and additions are applied from start to end
+	sort.SliceStable(removals, func(i, j int) bool { return removals[i].DataOffset < removals[j].DataOffset })
+	sort.SliceStable(additions, func(i, j int) bool { return additions[i].DataOffset < additions[j].DataOffset })
+
+	kept := &keptReader{r: originalData, removals: removals}
+	var target *digestWriter
+	if v != nil {
+		kept.hashFn = v.HashFn
+		if v.Source != nil {
+			kept.digest = newDigestWriter()
+		}
+		if v.Target != nil {
+			target = newDigestWriter()
+			w = io.MultiWriter(w, target)
+		}
+	}
+
+	var offset int64 // Current offset in the updated data
+	for _, addition := range additions {
+		// Copy the kept original data until the addition
+		if addition.DataOffset < offset {
+			return fmt.Errorf("addition at %d (len=%d) overlaps the previous one: %w", addition.DataOffset, addition.DataLen, ErrInvalidDiffs)
+		}
+		n, err := io.CopyN(w, kept, addition.DataOffset-offset)
+		if errors.Is(err, io.EOF) {
+			err = ErrShortRead // The original data ended before the addition
+		}
+		if err != nil {
+			return fmt.Errorf("error copying original data at %d (len=%d, copied=%d): %w", offset, addition.DataOffset-offset, n, err)
+		}
+
+		if v != nil && v.HashFn != nil {
+			if actual := hashData(v.HashFn(), addition.Data); !matchesHash(actual, addition.Hash) {
+				return &VerificationError{Data: "updated", Delta: addition.ChunkDelta, ActualHash: actual}
+			}
+		}
+
+		if _, err = w.Write(addition.Data); err != nil {
+			return fmt.Errorf("error writing added data at %d (len=%d): %w", addition.DataOffset, addition.DataLen, err)
+		}
+		offset = addition.DataOffset + addition.DataLen
+	}
+
+	// Copy the rest of the kept original data
+	if _, err := io.Copy(w, kept); err != nil {
+		return fmt.Errorf("error copying original data at %d: %w", offset, err)
+	}
+
+	if kept.digest != nil {
+		if actual := kept.digest.digest(); *actual != *v.Source {
+			return &VerificationError{Data: "original", Expected: v.Source, Actual: actual}
+		}
+	}
+	if target != nil {
+		if actual := target.digest(); *actual != *v.Target {
+			return &VerificationError{Data: "updated", Expected: v.Target, Actual: actual}
+		}
+	}
+
+	return nil
+}
+
+// keptReader reads the original data, skipping all the removed chunks (sorted by offset).
+// If hashFn or digest are set, the removed chunks are read too, to be verified.
+type keptReader struct {
+	r        io.ReaderAt
+	offset   int64
+	removals []*Diff
+
+	hashFn func() hash.Hash // Verifies the data of the removed chunks
+	digest *digestWriter    // Digest of the whole original data
+}
+
+func (k *keptReader) Read(b []byte) (int, error) {
+	// Skip the removed chunks starting at the current offset
+	for len(k.removals) > 0 && k.removals[0].DataOffset <= k.offset {
+		if err := k.verifyRemoval(k.removals[0]); err != nil {
+			return 0, err
+		}
+		if end := k.removals[0].DataOffset + k.removals[0].DataLen; end > k.offset {
+			k.offset = end
+		}
+		k.removals = k.removals[1:]
+	}
+
+	// Don't read past the next removed chunk
+	if len(k.removals) > 0 && int64(len(b)) > k.removals[0].DataOffset-k.offset {
+		b = b[:k.removals[0].DataOffset-k.offset]
+	}
+
+	n, err := k.r.ReadAt(b, k.offset)
+	k.offset += int64(n)
+	if k.digest != nil {
+		k.digest.Write(b[:n])
+	}
+	if errors.Is(err, io.EOF) && len(k.removals) > 0 {
+		return n, fmt.Errorf("removed chunk at %d is past the end of the original data: %w", k.removals[0].DataOffset, ErrShortRead)
+	}
+	return n, err
+}
+
+// verifyRemoval reads the data of a removed chunk starting at the current offset, if it needs to be verified
+func (k *keptReader) verifyRemoval(removal *Diff) error {
+	if k.hashFn == nil && k.digest == nil {
+		return nil
+	}
+
+	// Overlapping removals are only read from the current offset
+	start := k.offset
+	end := removal.DataOffset + removal.DataLen
+	if end <= start {
+		return nil
+	}
+
+	data := make([]byte, end-start)
+	n, err := k.r.ReadAt(data, start)
+	if n < len(data) {
+		if err == nil || errors.Is(err, io.EOF) {
+			err = ErrShortRead
+		}
+		return fmt.Errorf("error reading removed chunk at %d (len=%d): %w", removal.DataOffset, removal.DataLen, err)
+	}
+
+	if k.digest != nil {
+		k.digest.Write(data)
+	}
+	if k.hashFn != nil && start == removal.DataOffset {
+		if actual := hashData(k.hashFn(), data); !matchesHash(actual, removal.Hash) {
+			return &VerificationError{Data: "original", Delta: removal.ChunkDelta, ActualHash: actual}
+		}
+	}
+	return nil
+}
+
+// hashData provides the hash of the data, as found in the chunks
+func hashData(h hash.Hash, data []byte) string {
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// matchesHash tells whether the actual hash matches the expected one, which may be truncated (see StrongHashLen)
+func matchesHash(actual, expected string) bool {
+	return expected != "" && strings.HasPrefix(actual, expected)
+}
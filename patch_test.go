@@ -0,0 +1,223 @@
+package godiff_test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"github.com/mihailozarinschi/godiff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"strings"
+	"testing"
+)
+
+const loremIpsum = "Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua. Ut enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat. Duis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur. Excepteur sint occaecat cupidatat non proident, sunt in culpa qui officia deserunt mollit anim id est laborum."
+
+func TestPatch(t *testing.T) {
+	tt := []struct {
+		name     string
+		original func(t *testing.T) []byte
+		updated  func(t *testing.T) []byte
+	}{
+		{
+			name:     "both empty",
+			original: func(_ *testing.T) []byte { return nil },
+			updated:  func(_ *testing.T) []byte { return nil },
+		},
+		{
+			name:     "empty original",
+			original: func(_ *testing.T) []byte { return nil },
+			updated:  func(_ *testing.T) []byte { return []byte(loremIpsum) },
+		},
+		{
+			name:     "empty updated",
+			original: func(_ *testing.T) []byte { return []byte(loremIpsum) },
+			updated:  func(_ *testing.T) []byte { return nil },
+		},
+		{
+			name:     "same data",
+			original: func(_ *testing.T) []byte { return []byte(loremIpsum) },
+			updated:  func(_ *testing.T) []byte { return []byte(loremIpsum) },
+		},
+		{
+			name:     "prepended data",
+			original: func(_ *testing.T) []byte { return []byte(loremIpsum) },
+			updated:  func(_ *testing.T) []byte { return []byte("Prepended data. " + loremIpsum) },
+		},
+		{
+			name:     "appended data",
+			original: func(_ *testing.T) []byte { return []byte(loremIpsum) },
+			updated:  func(_ *testing.T) []byte { return []byte(loremIpsum + " Appended data.") },
+		},
+		{
+			name:     "swapped halves",
+			original: func(_ *testing.T) []byte { return []byte(loremIpsum) },
+			updated: func(_ *testing.T) []byte {
+				return []byte(loremIpsum[len(loremIpsum)/2:] + loremIpsum[:len(loremIpsum)/2])
+			},
+		},
+		{
+			name:     "repeated data",
+			original: func(_ *testing.T) []byte { return []byte(loremIpsum) },
+			updated:  func(_ *testing.T) []byte { return []byte(strings.Repeat(loremIpsum, 3)) },
+		},
+		{
+			name: "lorem ipsum (file)",
+			original: func(t *testing.T) []byte {
+				data, err := os.ReadFile("testdata/original.txt")
+				require.NoError(t, err)
+				return data
+			},
+			updated: func(t *testing.T) []byte {
+				data, err := os.ReadFile("testdata/updated.txt")
+				require.NoError(t, err)
+				return data
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			original := tc.original(t)
+			updated := tc.updated(t)
+
+			diffs, err := godiff.CalcDiffs(bytes.NewReader(original), bytes.NewReader(updated), sha1.New, 4, 16, 7)
+			require.NoError(t, err)
+
+			var patched bytes.Buffer
+			err = godiff.Patch(bytes.NewReader(original), diffs, &patched)
+			require.NoError(t, err)
+			assert.Equal(t, string(updated), patched.String())
+		})
+	}
+}
+
+func TestPatchInvalidDiffs(t *testing.T) {
+	tt := []struct {
+		name  string
+		diffs []*godiff.Diff
+	}{
+		{
+			name: "addition without data",
+			diffs: []*godiff.Diff{
+				{ChunkDelta: &godiff.ChunkDelta{Chunk: &godiff.Chunk{DataOffset: 0, DataLen: 5}, Type: godiff.DeltaTypeAdd}},
+			},
+		},
+		{
+			name: "removal past the end",
+			diffs: []*godiff.Diff{
+				{ChunkDelta: &godiff.ChunkDelta{Chunk: &godiff.Chunk{DataOffset: 100, DataLen: 5}, Type: godiff.DeltaTypeRemove}},
+			},
+		},
+		{
+			name: "addition past the end",
+			diffs: []*godiff.Diff{
+				{ChunkDelta: &godiff.ChunkDelta{Chunk: &godiff.Chunk{DataOffset: 100, DataLen: 1}, Type: godiff.DeltaTypeAdd}, Data: []byte("x")},
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := godiff.Patch(strings.NewReader("short"), tc.diffs, &bytes.Buffer{})
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestPatchVerified(t *testing.T) {
+	updated := strings.Replace(loremIpsum, "consectetur", "xxxxxxxxxxx", 1) + " Appended data."
+	diffs, err := godiff.CalcDiffs(strings.NewReader(loremIpsum), strings.NewReader(updated), sha1.New, 4, 16, 7)
+	require.NoError(t, err)
+
+	source, err := godiff.DigestData(strings.NewReader(loremIpsum))
+	require.NoError(t, err)
+	target, err := godiff.DigestData(strings.NewReader(updated))
+	require.NoError(t, err)
+
+	verification := &godiff.PatchVerification{HashFn: sha1.New, Source: source, Target: target}
+
+	// The first removed and added chunks, in the order of the data
+	var firstRemoval, firstAddition *godiff.Diff
+	for _, diff := range diffs {
+		switch {
+		case diff.Type == godiff.DeltaTypeRemove && (firstRemoval == nil || diff.DataOffset < firstRemoval.DataOffset):
+			firstRemoval = diff
+		case diff.Type == godiff.DeltaTypeAdd && (firstAddition == nil || diff.DataOffset < firstAddition.DataOffset):
+			firstAddition = diff
+		}
+	}
+	require.NotNil(t, firstRemoval)
+	require.NotNil(t, firstAddition)
+
+	tt := []struct {
+		name     string
+		original string
+		diffs    func() []*godiff.Diff
+		// Expected error, nil if the patch is verified
+		data  string
+		delta *godiff.ChunkDelta
+	}{
+		{
+			name:     "verified",
+			original: loremIpsum,
+			diffs:    func() []*godiff.Diff { return diffs },
+		},
+		{
+			name:     "removed chunk not matching",
+			original: strings.Replace(loremIpsum, "consectetur", "consectetuR", 1),
+			diffs:    func() []*godiff.Diff { return diffs },
+			data:     "original",
+			delta:    firstRemoval.ChunkDelta,
+		},
+		{
+			name:     "kept data not matching",
+			original: strings.Replace(loremIpsum, "Excepteur", "excepteur", 1),
+			diffs:    func() []*godiff.Diff { return diffs },
+			data:     "original",
+		},
+		{
+			name:     "added chunk not matching",
+			original: loremIpsum,
+			diffs: func() []*godiff.Diff {
+				corrupted := make([]*godiff.Diff, len(diffs))
+				for i, diff := range diffs {
+					corrupted[i] = diff
+					if diff == firstAddition {
+						corrupted[i] = &godiff.Diff{ChunkDelta: diff.ChunkDelta, Data: bytes.ToUpper(diff.Data)}
+					}
+				}
+				return corrupted
+			},
+			data:  "updated",
+			delta: firstAddition.ChunkDelta,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var patched bytes.Buffer
+			err := godiff.PatchVerified(strings.NewReader(tc.original), tc.diffs(), &patched, verification)
+			if tc.data == "" {
+				require.NoError(t, err)
+				assert.Equal(t, updated, patched.String())
+				return
+			}
+
+			require.ErrorIs(t, err, godiff.ErrChecksumMismatch)
+			var verificationErr *godiff.VerificationError
+			require.ErrorAs(t, err, &verificationErr)
+			assert.Equal(t, tc.data, verificationErr.Data)
+			assert.Equal(t, tc.delta, verificationErr.Delta)
+		})
+	}
+
+	t.Run("only the target digest", func(t *testing.T) {
+		err := godiff.PatchVerified(strings.NewReader(loremIpsum), diffs, &bytes.Buffer{}, &godiff.PatchVerification{Target: source})
+
+		var verificationErr *godiff.VerificationError
+		require.ErrorAs(t, err, &verificationErr)
+		assert.Equal(t, "updated", verificationErr.Data)
+		assert.Equal(t, target, verificationErr.Actual)
+	})
+}
@@ -1,25 +1,248 @@
 package godiff
 
-import "io"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
 
 type ReaderAt interface {
 	io.Reader
 	io.ReaderAt
 }
 
-// NewReaderAt provides a wrapper around an io.ReadSeeker implementation that doesn't implement io.ReaderAt
+// NewReaderAt provides a wrapper around an io.ReadSeeker implementation that doesn't implement io.ReaderAt.
+// Read and ReadAt don't affect each other: Read keeps its own offset, and ReadAt doesn't move it.
+// Both are safe for concurrent use, the access to the underlying io.ReadSeeker is serialized.
+// Read starts at offset 0, wherever the io.ReadSeeker was moved to before.
 func NewReaderAt(rs io.ReadSeeker) ReaderAt {
-	return &readerAt{rs}
+	return &readerAt{rs: rs, seekOffset: -1}
 }
 
 type readerAt struct {
-	io.ReadSeeker
+	mu         sync.Mutex
+	rs         io.ReadSeeker
+	seekOffset int64 // Current offset of the underlying io.ReadSeeker, -1 until it's moved the first time
+	readOffset int64 // Offset of the next Read
 }
 
-func (r *readerAt) ReadAt(b []byte, off int64) (n int, err error) {
-	_, err = r.Seek(off, io.SeekStart)
+func (r *readerAt) Read(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.seek(r.readOffset); err != nil {
+		return 0, err
+	}
+
+	n, err := r.rs.Read(b)
+	r.seekOffset += int64(n)
+	r.readOffset += int64(n)
+	if err != nil && !errors.Is(err, io.EOF) {
+		r.seekOffset = -1 // The io.ReadSeeker might have moved anyway
+	}
+	return n, err
+}
+
+// ReadAt reads until b is full, as required by io.ReaderAt, returning io.EOF if the data ends before
+func (r *readerAt) ReadAt(b []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.seek(off); err != nil {
+		return 0, err
+	}
+
+	n, err := io.ReadFull(r.rs, b)
+	r.seekOffset += int64(n)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		r.seekOffset = -1 // The io.ReadSeeker might have moved anyway
+	}
+	return n, err
+}
+
+// seek moves the underlying io.ReadSeeker, only if it's not already at the given offset
+func (r *readerAt) seek(off int64) error {
+	if off == r.seekOffset {
+		return nil
+	}
+
+	_, err := r.rs.Seek(off, io.SeekStart)
 	if err != nil {
+		r.seekOffset = -1
+		return err
+	}
+	r.seekOffset = off
+	return nil
+}
+
+// spillChunkSize is how much data is read at once from the source of a SpillReaderAt
+const spillChunkSize = 32 * 1024
+
+// SpillReaderAt turns any io.Reader (pipes, network streams, etc.) into a ReaderAt, by keeping everything read
+// from it: in memory up to maxMemory bytes, then in a temporary file. The source is only read when needed,
+// so the data can be chunked while it's still arriving. It's safe for concurrent use, and Close must be called
+// to remove the temporary file.
+type SpillReaderAt struct {
+	mu        sync.Mutex
+	src       io.Reader
+	srcErr    error // Error of the last source read, io.EOF once it was fully read
+	maxMemory int64
+
+	mem  []byte   // Data read so far, until it grows past maxMemory
+	file *os.File // Data read so far, once it grew past maxMemory
+	size int64    // Size of the data read so far
+
+	readOffset int64 // Offset of the next Read
+	closed     bool
+}
+
+// NewSpillReaderAt provides a ReaderAt reading from r, keeping at most maxMemory bytes in memory
+func NewSpillReaderAt(r io.Reader, maxMemory int64) *SpillReaderAt {
+	return &SpillReaderAt{src: r, maxMemory: maxMemory}
+}
+
+func (s *SpillReaderAt) Read(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return 0, os.ErrClosed
+	}
+	// Unlike ReadAt, there's no need to wait until b is full
+	if err := s.fill(s.readOffset + 1); err != nil {
+		return 0, err
+	}
+	if s.readOffset >= s.size {
+		return 0, io.EOF
+	}
+	if int64(len(b)) > s.size-s.readOffset {
+		b = b[:s.size-s.readOffset]
+	}
+
+	n, err := s.readBuffered(b, s.readOffset)
+	s.readOffset += int64(n)
+	return n, err
+}
+
+// ReadAt reads until b is full, as required by io.ReaderAt, returning io.EOF if the data ends before
+func (s *SpillReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &ParamError{Name: "off", Value: off, Reason: "must not be negative"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return 0, os.ErrClosed
+	}
+	if err := s.fill(off + int64(len(b))); err != nil {
 		return 0, err
 	}
-	return r.Read(b)
+	if off >= s.size {
+		return 0, io.EOF
+	}
+
+	var eof bool
+	if int64(len(b)) > s.size-off {
+		b = b[:s.size-off]
+		eof = true
+	}
+
+	n, err := s.readBuffered(b, off)
+	if err == nil && eof {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Close removes the temporary file, if any. It doesn't close the source. Read and ReadAt return os.ErrClosed
+// afterwards.
+func (s *SpillReaderAt) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	s.mem = nil
+	if s.file == nil {
+		return nil
+	}
+
+	closeErr := s.file.Close()
+	removeErr := os.Remove(s.file.Name())
+	s.file = nil
+	if closeErr != nil {
+		return fmt.Errorf("error closing temporary file: %w", closeErr)
+	}
+	if removeErr != nil {
+		return fmt.Errorf("error removing temporary file: %w", removeErr)
+	}
+	return nil
+}
+
+// fill reads from the source until at least size bytes were read, or the source ended. The source's errors are
+// only returned if there isn't enough data read already.
+func (s *SpillReaderAt) fill(size int64) error {
+	if s.size >= size {
+		return nil
+	}
+
+	buf := make([]byte, spillChunkSize)
+	for s.size < size && s.srcErr == nil {
+		n, err := s.src.Read(buf)
+		if n > 0 {
+			if werr := s.buffer(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		s.srcErr = err
+	}
+
+	if s.srcErr != nil && !errors.Is(s.srcErr, io.EOF) {
+		return fmt.Errorf("error reading source: %w", s.srcErr)
+	}
+	return nil
+}
+
+// buffer keeps the data read from the source, spilling it to a temporary file once there's too much of it
+func (s *SpillReaderAt) buffer(b []byte) error {
+	if s.file == nil && s.size+int64(len(b)) > s.maxMemory {
+		f, err := os.CreateTemp("", "godiff-spill-*")
+		if err != nil {
+			return fmt.Errorf("error creating temporary file: %w", err)
+		}
+		s.file = f
+		if _, err = s.file.Write(s.mem); err != nil {
+			return fmt.Errorf("error writing temporary file: %w", err)
+		}
+		s.mem = nil
+	}
+
+	if s.file != nil {
+		if _, err := s.file.Write(b); err != nil {
+			return fmt.Errorf("error writing temporary file: %w", err)
+		}
+	} else {
+		s.mem = append(s.mem, b...)
+	}
+	s.size += int64(len(b))
+	return nil
+}
+
+// readBuffered reads already buffered data
+func (s *SpillReaderAt) readBuffered(b []byte, off int64) (int, error) {
+	if s.file == nil {
+		return copy(b, s.mem[off:]), nil
+	}
+
+	n, err := s.file.ReadAt(b, off)
+	if err != nil {
+		return n, fmt.Errorf("error reading temporary file: %w", err)
+	}
+	return n, nil
 }
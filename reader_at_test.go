@@ -0,0 +1,178 @@
+package godiff_test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"github.com/mihailozarinschi/godiff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+)
+
+// halfReadSeeker returns at most half of the requested bytes on each Read, like some network/compressed streams
+type halfReadSeeker struct {
+	io.ReadSeeker
+}
+
+func (h *halfReadSeeker) Read(b []byte) (int, error) {
+	if len(b) > 1 {
+		b = b[:len(b)/2]
+	}
+	return h.ReadSeeker.Read(b)
+}
+
+func TestNewReaderAt(t *testing.T) {
+	data := []byte(loremIpsum)
+
+	tt := []struct {
+		name string
+		rs   func() io.ReadSeeker
+	}{
+		{
+			name: "bytes.Reader",
+			rs:   func() io.ReadSeeker { return bytes.NewReader(data) },
+		},
+		{
+			name: "short reads",
+			rs:   func() io.ReadSeeker { return &halfReadSeeker{ReadSeeker: bytes.NewReader(data)} },
+		},
+		{
+			name: "already read from",
+			rs: func() io.ReadSeeker {
+				rs := bytes.NewReader(data)
+				_, _ = rs.Read(make([]byte, 4))
+				return rs
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r := godiff.NewReaderAt(tc.rs())
+			assert.NoError(t, iotest.TestReader(r, data))
+
+			// ReadAt fills the whole buffer, and reports io.EOF if the data ends before
+			r = godiff.NewReaderAt(tc.rs())
+			buf := make([]byte, 100)
+			n, err := r.ReadAt(buf, 10)
+			require.NoError(t, err)
+			assert.Equal(t, 100, n)
+			assert.Equal(t, data[10:110], buf)
+
+			n, err = r.ReadAt(buf, int64(len(data)-40))
+			assert.ErrorIs(t, err, io.EOF)
+			assert.Equal(t, 40, n)
+			assert.Equal(t, data[len(data)-40:], buf[:n])
+
+			// ReadAt doesn't move the Read offset
+			all, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, data, all)
+		})
+	}
+}
+
+func TestNewReaderAtConcurrent(t *testing.T) {
+	data := []byte(loremIpsum)
+	r := godiff.NewReaderAt(&halfReadSeeker{ReadSeeker: bytes.NewReader(data)})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			buf := make([]byte, 20)
+			for off := i; off+len(buf) <= len(data); off += 8 {
+				n, err := r.ReadAt(buf, int64(off))
+				if !assert.NoError(t, err) || !assert.Equal(t, data[off:off+n], buf) {
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestSpillReaderAt(t *testing.T) {
+	data := []byte(loremIpsum)
+
+	tt := []struct {
+		name      string
+		maxMemory int64
+	}{
+		{name: "in memory", maxMemory: 1 << 20},
+		{name: "spilled to a temporary file", maxMemory: 64},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			t.Setenv("TMPDIR", tmpDir)
+
+			r := godiff.NewSpillReaderAt(iotest.OneByteReader(bytes.NewReader(data)), tc.maxMemory)
+			assert.NoError(t, iotest.TestReader(r, data))
+
+			buf := make([]byte, 100)
+			n, err := r.ReadAt(buf, int64(len(data)-40))
+			assert.ErrorIs(t, err, io.EOF)
+			assert.Equal(t, data[len(data)-40:], buf[:n])
+
+			_, err = r.ReadAt(buf, -1)
+			assert.ErrorIs(t, err, godiff.ErrInvalidParams)
+
+			require.NoError(t, r.Close())
+			files, err := os.ReadDir(tmpDir)
+			require.NoError(t, err)
+			assert.Empty(t, files)
+
+			_, err = r.ReadAt(buf[:2], 3)
+			assert.ErrorIs(t, err, os.ErrClosed)
+			_, err = r.Read(buf)
+			assert.ErrorIs(t, err, os.ErrClosed)
+		})
+	}
+}
+
+func TestSpillReaderAtSourceError(t *testing.T) {
+	r := godiff.NewSpillReaderAt(iotest.TimeoutReader(strings.NewReader(loremIpsum)), 1024)
+	defer r.Close()
+
+	// The first source read succeeds, the error only surfaces when more data is needed
+	buf := make([]byte, len(loremIpsum)+1)
+	_, err := r.ReadAt(buf, 0)
+	assert.ErrorIs(t, err, iotest.ErrTimeout)
+
+	// The data already read is still available
+	n, err := r.ReadAt(buf[:10], 5)
+	require.NoError(t, err)
+	assert.Equal(t, loremIpsum[5:15], string(buf[:n]))
+}
+
+func TestCalcDiffsPipe(t *testing.T) {
+	original, err := os.ReadFile(filepath.Join("testdata", "original.txt"))
+	require.NoError(t, err)
+	updated, err := os.ReadFile(filepath.Join("testdata", "updated.txt"))
+	require.NoError(t, err)
+
+	expected, err := godiff.CalcDiffs(bytes.NewReader(original), bytes.NewReader(updated), sha1.New, 16, 64, 7)
+	require.NoError(t, err)
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := pw.Write(updated)
+		pw.CloseWithError(err)
+	}()
+
+	updatedReader := godiff.NewSpillReaderAt(pr, 512)
+	defer updatedReader.Close()
+
+	diffs, err := godiff.CalcDiffs(bytes.NewReader(original), updatedReader, sha1.New, 16, 64, 7)
+	require.NoError(t, err)
+	assert.Equal(t, expected, diffs)
+}
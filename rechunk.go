@@ -0,0 +1,86 @@
+package godiff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// errResynchronized stops the rechunking once the new chunks' breakpoints match the previous ones again
+var errResynchronized = errors.New("resynchronized")
+
+// RechunkData provides the chunks of the updated data, knowing that it only differs from the previous data (whose
+// chunks are given) in the range [dirtyStart, dirtyEnd) of the updated data: the data before it is unchanged, and
+// the data after it is the previous data shifted by the difference of sizes. Breakpoints only depend on the data
+// since the previous breakpoint, so only the data from the last breakpoint before dirtyStart is chunked again,
+// until a new breakpoint after dirtyEnd matches a previous one. The previous chunks must have been calculated
+// with the same config.
+func RechunkData(previous []*Chunk, updated io.ReaderAt, updatedSize, dirtyStart, dirtyEnd int64, cfg *Config) ([]*Chunk, error) {
+	cfg, err := cfg.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	var previousSize int64
+	boundaries := make(map[int64]int, len(previous)) // Chunk index by offset
+	for i, chunk := range previous {
+		if chunk.DataOffset != previousSize {
+			return nil, fmt.Errorf("chunk #%d at %d doesn't follow the previous one: %w", i, chunk.DataOffset, ErrInvalidParams)
+		}
+		boundaries[chunk.DataOffset] = i
+		previousSize += chunk.DataLen
+	}
+
+	// Offset of the updated data after the dirty range, in the previous data
+	shift := updatedSize - previousSize
+	switch {
+	case dirtyStart < 0 || dirtyStart > dirtyEnd || dirtyEnd > updatedSize:
+		return nil, &ParamError{Name: "dirtyStart/dirtyEnd", Value: [2]int64{dirtyStart, dirtyEnd}, Reason: fmt.Sprintf("must be a range of the updated data (%d bytes)", updatedSize)}
+	case dirtyEnd-shift < dirtyStart || dirtyEnd-shift > previousSize:
+		return nil, &ParamError{Name: "dirtyEnd", Value: dirtyEnd, Reason: fmt.Sprintf("doesn't match the size difference (%d bytes)", shift)}
+	}
+
+	// Keep the chunks before the dirty range, except the last one which could have been cut by the end of the data
+	var kept int
+	for kept < len(previous)-1 && previous[kept].DataOffset+previous[kept].DataLen <= dirtyStart {
+		kept++
+	}
+	chunks := append([]*Chunk(nil), previous[:kept]...)
+
+	var start int64
+	if kept > 0 {
+		start = previous[kept-1].DataOffset + previous[kept-1].DataLen
+	}
+
+	var tail []*Chunk
+	r := io.NewSectionReader(updated, start, updatedSize-start)
+	err = ChunkDataFuncWithConfig(r, cfg, func(chunk *Chunk) error {
+		chunk.DataOffset += start
+		chunks = append(chunks, chunk)
+
+		// Once past the dirty range, the following breakpoints are the previous ones from a common breakpoint on
+		end := chunk.DataOffset + chunk.DataLen
+		if end < dirtyEnd || end == updatedSize {
+			return nil
+		}
+		if i, ok := boundaries[end-shift]; ok {
+			tail = shiftChunks(previous[i:], shift)
+			return errResynchronized
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errResynchronized) {
+		return nil, fmt.Errorf("error chunking updated data: %w", err)
+	}
+
+	if len(tail) == 0 {
+		var end int64
+		if len(chunks) > 0 {
+			end = chunks[len(chunks)-1].DataOffset + chunks[len(chunks)-1].DataLen
+		}
+		if end != updatedSize {
+			return nil, fmt.Errorf("updated data ended at %d, expected %d bytes: %w", end, updatedSize, ErrShortRead)
+		}
+	}
+	return append(chunks, tail...), nil
+}
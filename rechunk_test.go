@@ -0,0 +1,94 @@
+package godiff_test
+
+import (
+	"bytes"
+	"github.com/mihailozarinschi/godiff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRechunkData(t *testing.T) {
+	original := randomData(10, 256*1024)
+
+	// splice replaces original[start:end] with data
+	splice := func(start, end int, data string) []byte {
+		return append(append(append([]byte{}, original[:start]...), data...), original[end:]...)
+	}
+
+	edits := []struct {
+		name       string
+		start, end int // Range of the original data replaced
+		data       string
+	}{
+		{name: "insertion", start: 100 * 1024, end: 100 * 1024, data: "inserted"},
+		{name: "removal", start: 50 * 1024, end: 60 * 1024},
+		{name: "overwrite", start: 200 * 1024, end: 200*1024 + 8, data: "replaced"},
+		{name: "at the start", start: 0, end: 10, data: "start"},
+		{name: "at the end", start: 256*1024 - 10, end: 256 * 1024, data: "end"},
+		{name: "appended", start: 256 * 1024, end: 256 * 1024, data: "appended"},
+		{name: "everything", start: 0, end: 256 * 1024, data: "everything"},
+		{name: "nothing", start: 1000, end: 1000},
+	}
+
+	configs := []struct {
+		name string
+		cfg  *godiff.Config
+	}{
+		{name: "gear", cfg: &godiff.Config{AvgChunkSize: 1024}},
+		{name: "rabin", cfg: &godiff.Config{Algorithm: godiff.AlgorithmRabin, MinChunkSize: 16, AvgChunkSize: 512, MaxChunkSize: 2048}},
+	}
+
+	for _, c := range configs {
+		previous, err := godiff.ChunkDataWithConfig(bytes.NewReader(original), c.cfg)
+		require.NoError(t, err)
+
+		for _, edit := range edits {
+			t.Run(c.name+", "+edit.name, func(t *testing.T) {
+				updated := splice(edit.start, edit.end, edit.data)
+				expected, err := godiff.ChunkDataWithConfig(bytes.NewReader(updated), c.cfg)
+				require.NoError(t, err)
+
+				r := &countingReaderAt{ReaderAt: bytes.NewReader(updated)}
+				dirtyEnd := int64(edit.start + len(edit.data))
+				chunks, err := godiff.RechunkData(previous, r, int64(len(updated)), int64(edit.start), dirtyEnd, c.cfg)
+				require.NoError(t, err)
+				assert.Equal(t, expected, chunks)
+
+				// Only the data around the edit was read
+				if edit.name != "everything" {
+					assert.Less(t, r.readLen, int64(64*1024))
+				}
+			})
+		}
+	}
+}
+
+func TestRechunkDataInvalid(t *testing.T) {
+	cfg := &godiff.Config{AvgChunkSize: 1024}
+	original := randomData(11, 16*1024)
+	previous, err := godiff.ChunkDataWithConfig(bytes.NewReader(original), cfg)
+	require.NoError(t, err)
+
+	tt := []struct {
+		name             string
+		size, start, end int64
+		expected         error
+	}{
+		{name: "negative start", size: 16 * 1024, start: -1, end: 10, expected: godiff.ErrInvalidParams},
+		{name: "end before start", size: 16 * 1024, start: 10, end: 5, expected: godiff.ErrInvalidParams},
+		{name: "end past the data", size: 16 * 1024, start: 10, end: 16*1024 + 1, expected: godiff.ErrInvalidParams},
+		{name: "range smaller than the size difference", size: 16*1024 + 10, start: 10, end: 15, expected: godiff.ErrInvalidParams},
+		{name: "data shorter than its size", size: 32 * 1024, start: 16 * 1024, end: 32 * 1024, expected: godiff.ErrShortRead},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := godiff.RechunkData(previous, bytes.NewReader(original), tc.size, tc.start, tc.end, cfg)
+			assert.ErrorIs(t, err, tc.expected)
+		})
+	}
+
+	_, err = godiff.RechunkData([]*godiff.Chunk{previous[1]}, bytes.NewReader(original), 16*1024, 0, 0, cfg)
+	assert.ErrorIs(t, err, godiff.ErrInvalidParams)
+}
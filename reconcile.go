@@ -0,0 +1,317 @@
+package godiff
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// The IBLT keys are derived from the chunks' hashes, whatever their length
+const (
+	ibltKeyLen     = 16
+	ibltHashCount  = 3 // Cells each key is added to, one per subtable
+	ibltMinCells   = 32
+	maxIBLTCells   = 1 << 26
+	ibltCellMaxLen = binary.MaxVarintLen64 + ibltKeyLen + 8
+)
+
+type ibltKey [ibltKeyLen]byte
+
+// chunkSetKey provides the IBLT key of a chunk's hash
+func chunkSetKey(hash string) ibltKey {
+	sum := sha256.Sum256([]byte(hash))
+	var key ibltKey
+	copy(key[:], sum[:])
+	return key
+}
+
+type ibltCell struct {
+	count   int64
+	keySum  ibltKey // XOR of the keys
+	hashSum uint64  // XOR of the keys' check hashes
+}
+
+// IBLT is an invertible Bloom lookup table of chunks' hashes. Subtracting the IBLTs of 2 sets cancels out the
+// hashes they have in common, and lists the others, as long as the IBLT has at least ~1.5 cells per difference:
+// its size only depends on the number of differences, not on the size of the sets.
+type IBLT struct {
+	cells []ibltCell
+	len   int64 // Number of keys inserted, minus the ones subtracted
+}
+
+// NewIBLT provides an empty IBLT of cells cells (rounded up), both sides of a reconciliation need the same size
+func NewIBLT(cells int) (*IBLT, error) {
+	if cells <= 0 || cells > maxIBLTCells {
+		return nil, &ParamError{Name: "cells", Value: cells, Reason: fmt.Sprintf("must be between 1 and %d", maxIBLTCells)}
+	}
+	cells = (cells + ibltHashCount - 1) / ibltHashCount * ibltHashCount
+	return &IBLT{cells: make([]ibltCell, cells)}, nil
+}
+
+// Cells provides the size of the IBLT
+func (t *IBLT) Cells() int {
+	return len(t.cells)
+}
+
+// Len provides the number of hashes inserted (minus the ones of the subtracted IBLT)
+func (t *IBLT) Len() int64 {
+	return t.len
+}
+
+// Insert adds the hash of a chunk
+func (t *IBLT) Insert(hash string) {
+	t.update(chunkSetKey(hash), 1)
+	t.len++
+}
+
+// Subtract removes all the hashes of the other IBLT, of the same size
+func (t *IBLT) Subtract(other *IBLT) error {
+	if len(other.cells) != len(t.cells) {
+		return &ParamError{Name: "other", Value: len(other.cells), Reason: fmt.Sprintf("must have %d cells", len(t.cells))}
+	}
+	for i := range t.cells {
+		t.cells[i].count -= other.cells[i].count
+		xorKey(&t.cells[i].keySum, &other.cells[i].keySum)
+		t.cells[i].hashSum ^= other.cells[i].hashSum
+	}
+	t.len -= other.len
+	return nil
+}
+
+// decode lists the keys left in the IBLT, once another one was subtracted: the ones only in this one (inserted)
+// and the ones only in the other one (removed). It returns ErrTooManyDifferences when the IBLT is too small to
+// list all of them. The IBLT is emptied as the keys are listed.
+func (t *IBLT) decode() (inserted, removed []ibltKey, err error) {
+	pending := make([]int, 0, len(t.cells))
+	for i := range t.cells {
+		pending = append(pending, i)
+	}
+
+	for len(pending) > 0 {
+		cell := t.cells[pending[len(pending)-1]]
+		pending = pending[:len(pending)-1]
+		if (cell.count != 1 && cell.count != -1) || ibltCheck(&cell.keySum) != cell.hashSum {
+			continue // Not pure, or already emptied
+		}
+
+		// There can't be more keys than cells, unless a cell was wrongly taken as pure
+		if len(inserted)+len(removed) >= len(t.cells) {
+			break
+		}
+
+		key := cell.keySum
+		if cell.count == 1 {
+			inserted = append(inserted, key)
+		} else {
+			removed = append(removed, key)
+		}
+		pending = append(pending, t.update(key, -cell.count)...)
+	}
+
+	for _, cell := range t.cells {
+		if cell.count != 0 || cell.hashSum != 0 || cell.keySum != (ibltKey{}) {
+			return nil, nil, fmt.Errorf("%d cells can't tell all the differences: %w", len(t.cells), ErrTooManyDifferences)
+		}
+	}
+	return inserted, removed, nil
+}
+
+// update adds the key count times to its cells, and returns them
+func (t *IBLT) update(key ibltKey, count int64) []int {
+	subtable := len(t.cells) / ibltHashCount
+	sum := sha256.Sum256(key[:])
+	check := binary.BigEndian.Uint64(sum[:])
+
+	indexes := make([]int, ibltHashCount)
+	for j := range indexes {
+		i := j*subtable + int(binary.BigEndian.Uint64(sum[8+8*j:])%uint64(subtable))
+		t.cells[i].count += count
+		xorKey(&t.cells[i].keySum, &key)
+		t.cells[i].hashSum ^= check
+		indexes[j] = i
+	}
+	return indexes
+}
+
+// ibltCheck provides the check hash of a key, telling whether a cell contains only that key
+func ibltCheck(key *ibltKey) uint64 {
+	sum := sha256.Sum256(key[:])
+	return binary.BigEndian.Uint64(sum[:])
+}
+
+func xorKey(dst, src *ibltKey) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
+
+// ChunkSet is a set of chunks' hashes, e.g. all the chunks of a corpus of files
+type ChunkSet struct {
+	hashes map[ibltKey]string
+}
+
+// NewChunkSet provides a set of the chunks' hashes
+func NewChunkSet(chunks []*Chunk) *ChunkSet {
+	s := &ChunkSet{hashes: make(map[ibltKey]string, len(chunks))}
+	s.Add(chunks...)
+	return s
+}
+
+// Add adds the chunks' hashes to the set
+func (s *ChunkSet) Add(chunks ...*Chunk) {
+	for _, chunk := range chunks {
+		s.hashes[chunkSetKey(chunk.Hash)] = chunk.Hash
+	}
+}
+
+// Len provides the number of hashes in the set
+func (s *ChunkSet) Len() int {
+	return len(s.hashes)
+}
+
+// IBLT provides the IBLT of the set
+func (s *ChunkSet) IBLT(cells int) (*IBLT, error) {
+	t, err := NewIBLT(cells)
+	if err != nil {
+		return nil, err
+	}
+	for _, hash := range s.hashes {
+		t.Insert(hash)
+	}
+	return t, nil
+}
+
+// ChunkSetPeer provides the IBLTs of a set of chunks' hashes, e.g. a ChunkSet itself, or a remote one
+type ChunkSetPeer interface {
+	IBLT(cells int) (*IBLT, error)
+}
+
+// SetDifference is the difference between a local and a remote set of chunks' hashes
+type SetDifference struct {
+	Missing    []string // Local hashes missing from the remote set, sorted
+	RemoteOnly int      // Number of remote hashes missing from the local set
+}
+
+// ReconcileChunkSets tells which local chunks' hashes are missing from the remote set, with traffic proportional
+// to the number of differences between the sets, whatever their size: the remote IBLT is requested with cells
+// cells (32 by default), then twice as big as long as it's too small to tell all the differences.
+func ReconcileChunkSets(local *ChunkSet, remote ChunkSetPeer, cells int) (*SetDifference, error) {
+	if cells == 0 {
+		cells = ibltMinCells
+	}
+
+	for {
+		remoteIBLT, err := remote.IBLT(cells)
+		if err != nil {
+			return nil, fmt.Errorf("error getting remote IBLT: %w", err)
+		}
+		localIBLT, err := local.IBLT(remoteIBLT.Cells())
+		if err != nil {
+			return nil, err
+		}
+		if err = localIBLT.Subtract(remoteIBLT); err != nil {
+			return nil, err
+		}
+
+		inserted, removed, err := localIBLT.decode()
+		if err == nil {
+			diff := &SetDifference{RemoteOnly: len(removed)}
+			for _, key := range inserted {
+				hash, ok := local.hashes[key]
+				if !ok {
+					return nil, fmt.Errorf("remote IBLT lists unknown local hashes: %w", ErrInvalidFormat)
+				}
+				diff.Missing = append(diff.Missing, hash)
+			}
+			sort.Strings(diff.Missing)
+			return diff, nil
+		}
+
+		// Once the IBLT is big enough for both sets, not being able to decode it isn't a matter of size
+		if int64(remoteIBLT.Cells()) > 2*(int64(local.Len())+remoteIBLT.Len())+ibltMinCells || cells*2 > maxIBLTCells {
+			return nil, err
+		}
+		cells = remoteIBLT.Cells() * 2
+	}
+}
+
+// The IBLT binary format is made of a header (magic + version), followed by the number of cells and of keys
+// (uvarints), followed by each cell: its count (varint), keys XOR (16 bytes) and check hashes XOR (8 bytes)
+const (
+	ibltMagic   = "GIBL"
+	ibltVersion = 1
+)
+
+// WriteIBLT writes the IBLT to w, in the IBLT binary format
+func WriteIBLT(w io.Writer, t *IBLT) error {
+	bw := bufio.NewWriter(w)
+	buf := append(make([]byte, 0, len(ibltMagic)+1+2*binary.MaxVarintLen64), ibltMagic...)
+	buf = append(buf, ibltVersion)
+	buf = binary.AppendUvarint(buf, uint64(len(t.cells)))
+	buf = binary.AppendVarint(buf, t.len)
+	if _, err := bw.Write(buf); err != nil {
+		return fmt.Errorf("error writing header: %w", err)
+	}
+
+	cell := make([]byte, 0, ibltCellMaxLen)
+	for i := range t.cells {
+		cell = binary.AppendVarint(cell[:0], t.cells[i].count)
+		cell = append(cell, t.cells[i].keySum[:]...)
+		cell = binary.BigEndian.AppendUint64(cell, t.cells[i].hashSum)
+		if _, err := bw.Write(cell); err != nil {
+			return fmt.Errorf("error writing cell #%d: %w", i, err)
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("error flushing IBLT: %w", err)
+	}
+	return nil
+}
+
+// ReadIBLT reads an IBLT from r
+func ReadIBLT(r io.Reader) (*IBLT, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, len(ibltMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("error reading header: %w", unexpectedEOF(err))
+	}
+	if string(header[:len(ibltMagic)]) != ibltMagic {
+		return nil, fmt.Errorf("invalid header, not an IBLT stream: %w", ErrInvalidFormat)
+	}
+	if header[len(ibltMagic)] != ibltVersion {
+		return nil, fmt.Errorf("unsupported IBLT format version %d: %w", header[len(ibltMagic)], ErrInvalidFormat)
+	}
+
+	cells, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("error reading header: %w", unexpectedEOF(err))
+	}
+	if cells == 0 || cells > maxIBLTCells || cells%ibltHashCount != 0 {
+		return nil, fmt.Errorf("invalid number of cells %d: %w", cells, ErrInvalidFormat)
+	}
+	// Don't trust the number of cells to allocate them all upfront, they're appended as they're actually read
+	t := &IBLT{cells: make([]ibltCell, 0, ibltMinCells)}
+	if t.len, err = binary.ReadVarint(br); err != nil {
+		return nil, fmt.Errorf("error reading header: %w", unexpectedEOF(err))
+	}
+
+	for i := uint64(0); i < cells; i++ {
+		var cell ibltCell
+		if cell.count, err = binary.ReadVarint(br); err != nil {
+			return nil, fmt.Errorf("error reading cell #%d: %w", i, unexpectedEOF(err))
+		}
+		var sums [ibltKeyLen + 8]byte
+		if _, err = io.ReadFull(br, sums[:]); err != nil {
+			return nil, fmt.Errorf("error reading cell #%d: %w", i, unexpectedEOF(err))
+		}
+		copy(cell.keySum[:], sums[:])
+		cell.hashSum = binary.BigEndian.Uint64(sums[ibltKeyLen:])
+		t.cells = append(t.cells, cell)
+	}
+	return t, nil
+}
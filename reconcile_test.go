@@ -0,0 +1,121 @@
+package godiff_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/mihailozarinschi/godiff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestReconcileChunkSets(t *testing.T) {
+	tt := []struct {
+		name        string
+		common      int
+		localOnly   int
+		remoteOnly  int
+		maxTraffic  int
+		initialSize int
+	}{
+		{name: "same sets", common: 10000, maxTraffic: 1024},
+		{name: "missing from the remote set", common: 10000, localOnly: 50, maxTraffic: 16 * 1024},
+		{name: "missing from both sets", common: 10000, localOnly: 50, remoteOnly: 50, maxTraffic: 16 * 1024},
+		{name: "big initial size", common: 10000, localOnly: 500, remoteOnly: 10, initialSize: 2000, maxTraffic: 64 * 1024},
+		{name: "disjoint sets", localOnly: 3000, remoteOnly: 1000, maxTraffic: 512 * 1024},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			common := hashChunks("common", tc.common)
+			localOnly := hashChunks("local", tc.localOnly)
+			local := godiff.NewChunkSet(common)
+			local.Add(localOnly...)
+			remote := godiff.NewChunkSet(common)
+			remote.Add(hashChunks("remote", tc.remoteOnly)...)
+
+			peer := &encodingSetPeer{set: remote}
+			diff, err := godiff.ReconcileChunkSets(local, peer, tc.initialSize)
+			require.NoError(t, err)
+
+			var expected []string
+			for _, chunk := range localOnly {
+				expected = append(expected, chunk.Hash)
+			}
+			sort.Strings(expected)
+			assert.Equal(t, expected, diff.Missing)
+			assert.Equal(t, tc.remoteOnly, diff.RemoteOnly)
+			assert.Less(t, peer.traffic, tc.maxTraffic)
+		})
+	}
+}
+
+func TestIBLT(t *testing.T) {
+	_, err := godiff.NewIBLT(0)
+	assert.ErrorIs(t, err, godiff.ErrInvalidParams)
+
+	a, err := godiff.NewIBLT(100)
+	require.NoError(t, err)
+	assert.Equal(t, 102, a.Cells())
+	b, err := godiff.NewIBLT(30)
+	require.NoError(t, err)
+	assert.ErrorIs(t, a.Subtract(b), godiff.ErrInvalidParams)
+
+	for _, chunk := range hashChunks("a", 10) {
+		a.Insert(chunk.Hash)
+	}
+	assert.EqualValues(t, 10, a.Len())
+
+	var buf bytes.Buffer
+	require.NoError(t, godiff.WriteIBLT(&buf, a))
+	decoded, err := godiff.ReadIBLT(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, a, decoded)
+
+	_, err = godiff.ReadIBLT(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	assert.ErrorIs(t, err, godiff.ErrShortRead)
+	_, err = godiff.ReadIBLT(strings.NewReader("GSIG\x01"))
+	assert.ErrorIs(t, err, godiff.ErrInvalidFormat)
+
+	// A header announcing lots of cells doesn't allocate them before they're read
+	header := binary.AppendUvarint([]byte("GIBL\x01"), 3*(1<<26/3))
+	header = binary.AppendVarint(header, 0)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err = godiff.ReadIBLT(bytes.NewReader(header))
+	runtime.ReadMemStats(&after)
+	assert.ErrorIs(t, err, godiff.ErrShortRead)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(1<<20))
+}
+
+// encodingSetPeer sends the IBLTs of a set in their binary format, counting the traffic
+type encodingSetPeer struct {
+	set     *godiff.ChunkSet
+	traffic int
+}
+
+func (p *encodingSetPeer) IBLT(cells int) (*godiff.IBLT, error) {
+	t, err := p.set.IBLT(cells)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err = godiff.WriteIBLT(&buf, t); err != nil {
+		return nil, err
+	}
+	p.traffic += buf.Len()
+	return godiff.ReadIBLT(&buf)
+}
+
+// hashChunks provides n chunks with distinct SHA-256 like hashes
+func hashChunks(prefix string, n int) []*godiff.Chunk {
+	chunks := make([]*godiff.Chunk, n)
+	for i := range chunks {
+		chunks[i] = &godiff.Chunk{Hash: fmt.Sprintf("%s-%060d", prefix, i)}
+	}
+	return chunks
+}
@@ -0,0 +1,120 @@
+package godiff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// refineDeltas trims the bytes common to the removed chunks and the added chunks replacing them (RefinementBytes).
+// The chunks are trimmed, and dropped if nothing is left of them, so each hunk only covers the bytes that changed.
+// The data of each hunk is loaded in memory to be compared.
+func refineDeltas(original, updated io.ReaderAt, originalChunks, updatedChunks []*Chunk, deltas []*ChunkDelta, cfg *Config) ([]*ChunkDelta, error) {
+	hunks, err := deltasHunks(originalChunks, updatedChunks, deltas)
+	if err != nil {
+		return nil, err
+	}
+
+	type deltaKey struct {
+		deltaType DeltaType
+		position  int
+	}
+	refined := make(map[deltaKey]*ChunkDelta) // A nil delta means it was dropped
+
+	for _, hunk := range hunks {
+		// Pure removals/additions have nothing to be compared with
+		if hunk.baseStart == hunk.baseEnd || hunk.sideStart == hunk.sideEnd {
+			continue
+		}
+
+		removedChunks := originalChunks[hunk.baseStart:hunk.baseEnd]
+		removedData, err := readChunksData(original, removedChunks)
+		if err != nil {
+			return nil, fmt.Errorf("error reading original data: %w", err)
+		}
+
+		addedChunks := updatedChunks[hunk.sideStart:hunk.sideEnd]
+		addedData, err := readChunksData(updated, addedChunks)
+		if err != nil {
+			return nil, fmt.Errorf("error reading updated data: %w", err)
+		}
+
+		prefix := commonPrefixLen(removedData, addedData)
+		suffix := commonSuffixLen(removedData[prefix:], addedData[prefix:])
+
+		h := cfg.newChunkHasher()
+		for i, chunk := range removedChunks {
+			refined[deltaKey{DeltaTypeRemove, hunk.baseStart + i}] = trimChunkDelta(
+				&ChunkDelta{Chunk: chunk, Type: DeltaTypeRemove, Position: hunk.baseStart + i},
+				removedChunks[0].DataOffset, removedData, prefix, len(removedData)-suffix, h)
+		}
+		for i, chunk := range addedChunks {
+			refined[deltaKey{DeltaTypeAdd, hunk.sideStart + i}] = trimChunkDelta(
+				&ChunkDelta{Chunk: chunk, Type: DeltaTypeAdd, Position: hunk.sideStart + i},
+				addedChunks[0].DataOffset, addedData, prefix, len(addedData)-suffix, h)
+		}
+	}
+
+	result := make([]*ChunkDelta, 0, len(deltas))
+	for _, delta := range deltas {
+		if r, ok := refined[deltaKey{delta.Type, delta.Position}]; ok {
+			if r == nil {
+				continue
+			}
+			delta = r
+		}
+		result = append(result, delta)
+	}
+	return result, nil
+}
+
+// trimChunkDelta keeps only the part of the delta's chunk within [start, end) of the hunk's data (starting at
+// offset), or returns nil if there's nothing left
+func trimChunkDelta(delta *ChunkDelta, offset int64, data []byte, start, end int, h *chunkHasher) *ChunkDelta {
+	chunkStart := int(delta.DataOffset - offset)
+	chunkEnd := chunkStart + int(delta.DataLen)
+	if chunkStart < start {
+		chunkStart = start
+	}
+	if chunkEnd > end {
+		chunkEnd = end
+	}
+	if chunkStart >= chunkEnd {
+		return nil
+	}
+	if int64(chunkStart)+offset == delta.DataOffset && int64(chunkEnd-chunkStart) == delta.DataLen {
+		return delta // Untouched
+	}
+
+	h.Reset()
+	h.Write(data[chunkStart:chunkEnd])
+	return &ChunkDelta{
+		Chunk:    h.chunk(offset+int64(chunkStart), int64(chunkEnd-chunkStart)),
+		Type:     delta.Type,
+		Position: delta.Position,
+	}
+}
+
+// readChunksData reads the data of consecutive chunks
+func readChunksData(r io.ReaderAt, chunks []*Chunk) ([]byte, error) {
+	last := chunks[len(chunks)-1]
+	offset := chunks[0].DataOffset
+	data := make([]byte, last.DataOffset+last.DataLen-offset)
+
+	n, err := r.ReadAt(data, offset)
+	if n == len(data) {
+		return data, nil // The data was fully read, even if the end of the input was reached too
+	}
+	if err == nil || errors.Is(err, io.EOF) {
+		err = ErrShortRead
+	}
+	return nil, fmt.Errorf("error reading chunks at %d (len=%d): %w", offset, len(data), err)
+}
+
+func commonSuffixLen(a, b []byte) int {
+	var i int
+	for i < len(a) && i < len(b) && a[len(a)-1-i] == b[len(b)-1-i] {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,319 @@
+package godiff
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// DiffRow is a row of a line by line view of a text diff: a line of the original text, a line of the updated text,
+// or both side by side
+type DiffRow struct {
+	OriginalLine int       // Number of the original line (from 1), or 0 if the row has none
+	UpdatedLine  int       // Number of the updated line (from 1), or 0 if the row has none
+	Original     []Segment // Segments of the original line (Equal or Delete), without its line break
+	Updated      []Segment // Segments of the updated line (Equal or Insert), without its line break
+}
+
+// Equal tells whether the row's lines are the same
+func (r *DiffRow) Equal() bool {
+	if r.OriginalLine == 0 || r.UpdatedLine == 0 {
+		return false
+	}
+	for _, segment := range append(r.Original[:len(r.Original):len(r.Original)], r.Updated...) {
+		if segment.Type != SegmentEqual {
+			return false
+		}
+	}
+	return true
+}
+
+// DiffRows splits the segments of a text diff into rows of lines. The lines sharing some equal text are put side
+// by side, the changed lines in between them too, in order.
+func DiffRows(segments []Segment) []*DiffRow {
+	var (
+		rows                            []*DiffRow
+		original, updated               = &diffLine{}, &diffLine{} // Current lines
+		pendingOriginal, pendingUpdated []*diffLine                // Lines ended since the last shared line break
+		originalLine, updatedLine       int
+	)
+
+	addRow := func(o, u *diffLine) {
+		row := &DiffRow{}
+		if o != nil {
+			originalLine++
+			row.OriginalLine, row.Original = originalLine, o.segments
+		}
+		if u != nil {
+			updatedLine++
+			row.UpdatedLine, row.Updated = updatedLine, u.segments
+		}
+		rows = append(rows, row)
+	}
+
+	flush := func() {
+		o, u := pendingOriginal, pendingUpdated
+		for len(o) > 0 && len(u) > 0 {
+			switch {
+			case o[0].shares(u[0]):
+				addRow(o[0], u[0])
+				o, u = o[1:], u[1:]
+			case o[0].sharesAny(u[1:]):
+				addRow(nil, u[0])
+				u = u[1:]
+			case u[0].sharesAny(o[1:]):
+				addRow(o[0], nil)
+				o = o[1:]
+			default:
+				addRow(o[0], u[0])
+				o, u = o[1:], u[1:]
+			}
+		}
+		for _, line := range o {
+			addRow(line, nil)
+		}
+		for _, line := range u {
+			addRow(nil, line)
+		}
+		pendingOriginal, pendingUpdated = nil, nil
+	}
+
+	for i, segment := range segments {
+		for j, part := range strings.SplitAfter(segment.Text, "\n") {
+			if part == "" {
+				continue
+			}
+			text := strings.TrimSuffix(part, "\n")
+			ended := len(text) < len(part)
+			piece := [2]int{i, j}
+
+			if segment.Type != SegmentInsert {
+				original.add(segment.Type, text, piece)
+				if ended {
+					pendingOriginal = append(pendingOriginal, original)
+					original = &diffLine{}
+				}
+			}
+			if segment.Type != SegmentDelete {
+				updated.add(segment.Type, text, piece)
+				if ended {
+					pendingUpdated = append(pendingUpdated, updated)
+					updated = &diffLine{}
+				}
+			}
+			if ended && segment.Type == SegmentEqual {
+				flush()
+			}
+		}
+	}
+
+	// The texts' last lines, without line breaks
+	if len(original.segments) > 0 {
+		pendingOriginal = append(pendingOriginal, original)
+	}
+	if len(updated.segments) > 0 {
+		pendingUpdated = append(pendingUpdated, updated)
+	}
+	flush()
+	return rows
+}
+
+// diffLine is a line of a text diff being split into rows
+type diffLine struct {
+	segments []Segment
+	pieces   [][2]int // Segment and part indexes of the line's equal text (and line break)
+}
+
+func (l *diffLine) add(t SegmentType, text string, piece [2]int) {
+	if text != "" {
+		l.segments = append(l.segments, Segment{Type: t, Text: text})
+	}
+	if t == SegmentEqual {
+		l.pieces = append(l.pieces, piece)
+	}
+}
+
+// shares tells whether both lines have some of the same equal text
+func (l *diffLine) shares(other *diffLine) bool {
+	for _, piece := range l.pieces {
+		for _, otherPiece := range other.pieces {
+			if piece == otherPiece {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (l *diffLine) sharesAny(others []*diffLine) bool {
+	for _, other := range others {
+		if l.shares(other) {
+			return true
+		}
+	}
+	return false
+}
+
+// HTMLLayout is how RenderHTML lays out the lines of a diff
+type HTMLLayout int
+
+const (
+	// HTMLSideBySide puts the original lines on the left and the updated ones on the right
+	HTMLSideBySide HTMLLayout = iota
+	// HTMLInline puts the original lines above the updated ones
+	HTMLInline
+)
+
+// htmlStyle makes the rendered HTML self-contained, its classes can also be styled by the embedding page
+const htmlStyle = `<style>
+.godiff { border-collapse: collapse; font-family: monospace; }
+.godiff td { padding: 0 4px; vertical-align: top; white-space: pre-wrap; }
+.godiff .godiff-num { color: #6e7781; text-align: right; user-select: none; }
+.godiff .godiff-delete { background: #ffebe9; }
+.godiff .godiff-insert { background: #e6ffec; }
+.godiff .godiff-empty { background: #f6f8fa; }
+.godiff del { background: #ffc1c0; text-decoration: none; }
+.godiff ins { background: #abf2bc; text-decoration: none; }
+</style>
+`
+
+// RenderHTML writes the segments of a text diff (e.g. from DiffWords or DiffSegments) as an HTML table, with line
+// numbers, and the changes within the lines highlighted. The texts are escaped.
+func RenderHTML(w io.Writer, segments []Segment, layout HTMLLayout) error {
+	var sb strings.Builder
+	sb.WriteString(htmlStyle)
+
+	switch layout {
+	case HTMLSideBySide:
+		sb.WriteString("<table class=\"godiff godiff-side-by-side\">\n")
+		for _, row := range DiffRows(segments) {
+			if row.Equal() {
+				sb.WriteString("<tr class=\"godiff-equal\">")
+			} else {
+				sb.WriteString("<tr class=\"godiff-changed\">")
+			}
+			writeHTMLCells(&sb, row.OriginalLine, row.Original, "godiff-delete", row.Equal())
+			writeHTMLCells(&sb, row.UpdatedLine, row.Updated, "godiff-insert", row.Equal())
+			sb.WriteString("</tr>\n")
+		}
+	case HTMLInline:
+		sb.WriteString("<table class=\"godiff godiff-inline\">\n")
+		for _, row := range DiffRows(segments) {
+			if row.Equal() {
+				fmt.Fprintf(&sb, "<tr class=\"godiff-equal\"><td class=\"godiff-num\">%d</td><td class=\"godiff-num\">%d</td><td class=\"godiff-line\">%s</td></tr>\n",
+					row.OriginalLine, row.UpdatedLine, htmlSegments(row.Original))
+				continue
+			}
+			if row.OriginalLine > 0 {
+				fmt.Fprintf(&sb, "<tr class=\"godiff-changed\"><td class=\"godiff-num\">%d</td><td class=\"godiff-num\"></td><td class=\"godiff-line godiff-delete\">%s</td></tr>\n",
+					row.OriginalLine, htmlSegments(row.Original))
+			}
+			if row.UpdatedLine > 0 {
+				fmt.Fprintf(&sb, "<tr class=\"godiff-changed\"><td class=\"godiff-num\"></td><td class=\"godiff-num\">%d</td><td class=\"godiff-line godiff-insert\">%s</td></tr>\n",
+					row.UpdatedLine, htmlSegments(row.Updated))
+			}
+		}
+	default:
+		return &ParamError{Name: "layout", Value: layout, Reason: "unknown HTML layout"}
+	}
+	sb.WriteString("</table>\n")
+
+	if _, err := io.WriteString(w, sb.String()); err != nil {
+		return fmt.Errorf("error writing HTML diff: %w", err)
+	}
+	return nil
+}
+
+// writeHTMLCells writes the cells of a line number and its segments, or empty cells if the row has no line
+func writeHTMLCells(sb *strings.Builder, line int, segments []Segment, class string, equal bool) {
+	switch {
+	case line == 0:
+		sb.WriteString("<td class=\"godiff-num godiff-empty\"></td><td class=\"godiff-line godiff-empty\"></td>")
+	case equal:
+		fmt.Fprintf(sb, "<td class=\"godiff-num\">%d</td><td class=\"godiff-line\">%s</td>", line, htmlSegments(segments))
+	default:
+		fmt.Fprintf(sb, "<td class=\"godiff-num\">%d</td><td class=\"godiff-line %s\">%s</td>", line, class, htmlSegments(segments))
+	}
+}
+
+func htmlSegments(segments []Segment) string {
+	var sb strings.Builder
+	for _, segment := range segments {
+		switch segment.Type {
+		case SegmentDelete:
+			sb.WriteString("<del>" + html.EscapeString(segment.Text) + "</del>")
+		case SegmentInsert:
+			sb.WriteString("<ins>" + html.EscapeString(segment.Text) + "</ins>")
+		default:
+			sb.WriteString(html.EscapeString(segment.Text))
+		}
+	}
+	return sb.String()
+}
+
+// ANSI escape codes of the terminal colors
+const (
+	ansiReset     = "\x1b[0m"
+	ansiRed       = "\x1b[31m"
+	ansiGreen     = "\x1b[32m"
+	ansiReverse   = "\x1b[7m"
+	ansiNoReverse = "\x1b[27m"
+)
+
+// RenderANSI writes the segments of a text diff (e.g. from DiffWords or DiffSegments) for a terminal: line numbers,
+// the original lines in red above the updated ones in green, and the changes within the lines in reverse video.
+// Control characters of the texts are shown as their Unicode pictures, so they can't drive the terminal.
+func RenderANSI(w io.Writer, segments []Segment) error {
+	var sb strings.Builder
+	for _, row := range DiffRows(segments) {
+		if row.Equal() {
+			fmt.Fprintf(&sb, "%5d %5d   %s\n", row.OriginalLine, row.UpdatedLine, ansiSegments(row.Original))
+			continue
+		}
+		if row.OriginalLine > 0 {
+			fmt.Fprintf(&sb, "%s%5d %5s - %s%s\n", ansiRed, row.OriginalLine, "", ansiSegments(row.Original), ansiReset)
+		}
+		if row.UpdatedLine > 0 {
+			fmt.Fprintf(&sb, "%s%5s %5d + %s%s\n", ansiGreen, "", row.UpdatedLine, ansiSegments(row.Updated), ansiReset)
+		}
+	}
+
+	if _, err := io.WriteString(w, sb.String()); err != nil {
+		return fmt.Errorf("error writing ANSI diff: %w", err)
+	}
+	return nil
+}
+
+func ansiSegments(segments []Segment) string {
+	var sb strings.Builder
+	for _, segment := range segments {
+		text := strings.Map(ansiSafeRune, segment.Text)
+		if segment.Type == SegmentEqual {
+			sb.WriteString(text)
+		} else {
+			sb.WriteString(ansiReverse + text + ansiNoReverse)
+		}
+	}
+	return sb.String()
+}
+
+// ansiSafeRune replaces the C0 control characters, except tabs, by their Unicode pictures (e.g. ␛ for ESC), the C1
+// ones (e.g. CSI) by the replacement character, and drops the carriage returns (e.g. of CRLF line breaks)
+func ansiSafeRune(r rune) rune {
+	switch {
+	case r == '\t':
+		return r
+	case r == '\r':
+		return -1
+	case r < 0x20:
+		return 0x2400 + r
+	case r == 0x7f:
+		return 0x2421
+	case r >= 0x80 && r <= 0x9f:
+		return utf8.RuneError
+	default:
+		return r
+	}
+}
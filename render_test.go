@@ -0,0 +1,170 @@
+package godiff_test
+
+import (
+	"bytes"
+	"flag"
+	"github.com/mihailozarinschi/godiff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+const (
+	renderOriginal = "package main\n\nfunc main() {\n\tfmt.Println(\"<b>héllo</b> & bye\")\n\treturn\n}\n"
+	renderUpdated  = "package main\n\n// main greets\nfunc main() {\n\tfmt.Println(\"<i>hello</i> & bye\")\n}\n"
+)
+
+func TestRender(t *testing.T) {
+	segments := godiff.CleanupSemantic(godiff.DiffWords(renderOriginal, renderUpdated))
+
+	tt := []struct {
+		name   string
+		golden string
+		render func(w *bytes.Buffer) error
+	}{
+		{
+			name:   "HTML side by side",
+			golden: "side_by_side.html",
+			render: func(w *bytes.Buffer) error { return godiff.RenderHTML(w, segments, godiff.HTMLSideBySide) },
+		},
+		{
+			name:   "HTML inline",
+			golden: "inline.html",
+			render: func(w *bytes.Buffer) error { return godiff.RenderHTML(w, segments, godiff.HTMLInline) },
+		},
+		{
+			name:   "ANSI",
+			golden: "ansi.txt",
+			render: func(w *bytes.Buffer) error { return godiff.RenderANSI(w, segments) },
+		},
+		{
+			name:   "ANSI control characters",
+			golden: "ansi_control.txt",
+			render: func(w *bytes.Buffer) error {
+				return godiff.RenderANSI(w, godiff.DiffRunes("ok\r\nbell\a\n", "ok\r\n\x1b[2Jbell\u009b31m\n"))
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, tc.render(&buf))
+
+			golden := filepath.Join("testdata", "render", tc.golden)
+			if *update {
+				require.NoError(t, os.WriteFile(golden, buf.Bytes(), 0o644))
+			}
+			expected, err := os.ReadFile(golden)
+			require.NoError(t, err)
+			assert.Equal(t, string(expected), buf.String())
+		})
+	}
+
+	err := godiff.RenderHTML(&bytes.Buffer{}, segments, godiff.HTMLLayout(-1))
+	assert.ErrorIs(t, err, godiff.ErrInvalidParams)
+}
+
+func TestDiffRows(t *testing.T) {
+	tt := []struct {
+		name     string
+		segments []godiff.Segment
+		rows     []*godiff.DiffRow
+	}{
+		{
+			name: "changed line",
+			segments: []godiff.Segment{
+				{Type: godiff.SegmentEqual, Text: "a\nb"},
+				{Type: godiff.SegmentDelete, Text: "c"},
+				{Type: godiff.SegmentInsert, Text: "x"},
+				{Type: godiff.SegmentEqual, Text: "\nd\n"},
+			},
+			rows: []*godiff.DiffRow{
+				{OriginalLine: 1, UpdatedLine: 1, Original: []godiff.Segment{{Type: godiff.SegmentEqual, Text: "a"}}, Updated: []godiff.Segment{{Type: godiff.SegmentEqual, Text: "a"}}},
+				{
+					OriginalLine: 2, UpdatedLine: 2,
+					Original: []godiff.Segment{{Type: godiff.SegmentEqual, Text: "b"}, {Type: godiff.SegmentDelete, Text: "c"}},
+					Updated:  []godiff.Segment{{Type: godiff.SegmentEqual, Text: "b"}, {Type: godiff.SegmentInsert, Text: "x"}},
+				},
+				{OriginalLine: 3, UpdatedLine: 3, Original: []godiff.Segment{{Type: godiff.SegmentEqual, Text: "d"}}, Updated: []godiff.Segment{{Type: godiff.SegmentEqual, Text: "d"}}},
+			},
+		},
+		{
+			name: "removed and added lines",
+			segments: []godiff.Segment{
+				{Type: godiff.SegmentEqual, Text: "a\n"},
+				{Type: godiff.SegmentDelete, Text: "b\n"},
+				{Type: godiff.SegmentEqual, Text: "c\n"},
+				{Type: godiff.SegmentInsert, Text: "d"},
+			},
+			rows: []*godiff.DiffRow{
+				{OriginalLine: 1, UpdatedLine: 1, Original: []godiff.Segment{{Type: godiff.SegmentEqual, Text: "a"}}, Updated: []godiff.Segment{{Type: godiff.SegmentEqual, Text: "a"}}},
+				{OriginalLine: 2, Original: []godiff.Segment{{Type: godiff.SegmentDelete, Text: "b"}}},
+				{OriginalLine: 3, UpdatedLine: 2, Original: []godiff.Segment{{Type: godiff.SegmentEqual, Text: "c"}}, Updated: []godiff.Segment{{Type: godiff.SegmentEqual, Text: "c"}}},
+				{UpdatedLine: 3, Updated: []godiff.Segment{{Type: godiff.SegmentInsert, Text: "d"}}},
+			},
+		},
+		{
+			// The equal text tells which lines are the same, not their positions
+			name: "line break added after an equal line",
+			segments: []godiff.Segment{
+				{Type: godiff.SegmentEqual, Text: "a\n"},
+				{Type: godiff.SegmentDelete, Text: "b\n"},
+				{Type: godiff.SegmentEqual, Text: "c"},
+				{Type: godiff.SegmentInsert, Text: "\nd"},
+			},
+			rows: []*godiff.DiffRow{
+				{OriginalLine: 1, UpdatedLine: 1, Original: []godiff.Segment{{Type: godiff.SegmentEqual, Text: "a"}}, Updated: []godiff.Segment{{Type: godiff.SegmentEqual, Text: "a"}}},
+				{OriginalLine: 2, Original: []godiff.Segment{{Type: godiff.SegmentDelete, Text: "b"}}},
+				{OriginalLine: 3, UpdatedLine: 2, Original: []godiff.Segment{{Type: godiff.SegmentEqual, Text: "c"}}, Updated: []godiff.Segment{{Type: godiff.SegmentEqual, Text: "c"}}},
+				{UpdatedLine: 3, Updated: []godiff.Segment{{Type: godiff.SegmentInsert, Text: "d"}}},
+			},
+		},
+		{
+			name: "empty lines",
+			segments: []godiff.Segment{
+				{Type: godiff.SegmentDelete, Text: "a\n"},
+				{Type: godiff.SegmentEqual, Text: "\n"},
+			},
+			rows: []*godiff.DiffRow{
+				{OriginalLine: 1, Original: []godiff.Segment{{Type: godiff.SegmentDelete, Text: "a"}}},
+				{OriginalLine: 2, UpdatedLine: 1},
+			},
+		},
+		{
+			name: "empty texts",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rows := godiff.DiffRows(tc.segments)
+			assert.Equal(t, tc.rows, rows)
+		})
+	}
+}
+
+func TestDiffSegments(t *testing.T) {
+	original, err := os.ReadFile("testdata/original.txt")
+	require.NoError(t, err)
+	updated, err := os.ReadFile("testdata/updated.txt")
+	require.NoError(t, err)
+
+	cfg := &godiff.Config{MinChunkSize: 16, AvgChunkSize: 64, MaxChunkSize: 256}
+	diffs, err := godiff.CalcDiffsWithConfig(bytes.NewReader(original), bytes.NewReader(updated), cfg)
+	require.NoError(t, err)
+	require.NotEmpty(t, diffs)
+
+	segments, err := godiff.DiffSegments(bytes.NewReader(original), diffs)
+	require.NoError(t, err)
+	assert.Equal(t, string(original), godiff.OriginalText(segments))
+	assert.Equal(t, string(updated), godiff.UpdatedText(segments))
+
+	// The original data must match the diffs
+	_, err = godiff.DiffSegments(bytes.NewReader(original[:len(original)/2]), diffs)
+	assert.ErrorIs(t, err, godiff.ErrShortRead)
+}
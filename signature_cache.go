@@ -0,0 +1,219 @@
+package godiff
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The signature cache binary format is made of a header (magic + version), followed by:
+//   - the ID of the chunking settings (32 bytes)
+//   - the file's size, modification time (Unix nanoseconds) and inode (8 bytes each)
+//   - the file's path (uvarint length + bytes)
+//   - the file's chunks, in the signature binary format (see WriteSignature)
+const (
+	signatureCacheMagic   = "GSCC"
+	signatureCacheVersion = 1
+
+	signatureCacheProbe = "godiff signature cache"
+)
+
+// racyCacheInterval is how recently modified a file can't be cached: the file system could store its
+// modification time with a coarse precision, so a change right after chunking it could go unnoticed
+const racyCacheInterval = 2 * time.Second
+
+// SignatureCache keeps the chunks of files in a directory, so that the files that didn't change since they were
+// last chunked aren't chunked again. A file is considered unchanged while its path, size, modification time and
+// inode are the same, and it's chunked with the same settings.
+type SignatureCache struct {
+	dir string
+	cfg *Config
+	id  []byte
+}
+
+// fileStamp identifies a version of a file
+type fileStamp struct {
+	size    int64
+	modTime int64
+	inode   uint64
+}
+
+// OpenSignatureCache opens the cache stored in dir, creating it if needed, for the chunks calculated with cfg
+func OpenSignatureCache(dir string, cfg *Config) (*SignatureCache, error) {
+	cfg, err := cfg.resolve()
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating cache directory: %w", err)
+	}
+	return &SignatureCache{dir: dir, cfg: cfg, id: chunkingID(cfg)}, nil
+}
+
+// Chunks provides the chunks of the file, from the cache when the file didn't change since they were cached,
+// otherwise the file is chunked and its chunks cached
+func (c *SignatureCache) Chunks(path string) ([]*Chunk, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving path: %w", err)
+	}
+
+	stamp, err := statFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// Unreadable entries are chunked again, and replaced
+	if chunks, err := c.load(path, stamp); err == nil {
+		return chunks, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %w", err)
+	}
+	defer f.Close()
+
+	chunks, err := ChunkDataWithConfig(f, c.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error chunking file: %w", err)
+	}
+
+	// The file must not have changed while being chunked, nor be changeable unnoticed
+	after, err := statFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if after != stamp || time.Since(time.Unix(0, stamp.modTime)) < racyCacheInterval {
+		return chunks, nil
+	}
+
+	if err = c.store(path, stamp, chunks); err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
+
+// Invalidate removes the cached chunks of the file, if any
+func (c *SignatureCache) Invalidate(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("error resolving path: %w", err)
+	}
+	if err = os.Remove(c.entryPath(path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error removing cache entry: %w", err)
+	}
+	return nil
+}
+
+// entryPath provides the path of the file's cache entry
+func (c *SignatureCache) entryPath(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+// load provides the cached chunks of the file, or ErrNotFound if they're missing or outdated
+func (c *SignatureCache) load(path string, stamp fileStamp) ([]*Chunk, error) {
+	data, err := os.ReadFile(c.entryPath(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("cache entry: %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading cache entry: %w", err)
+	}
+
+	entryPath, entryStamp, entryID, chunks, err := readSignatureCacheEntry(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if entryPath != path || entryStamp != stamp || !bytes.Equal(entryID, c.id) {
+		return nil, fmt.Errorf("outdated cache entry: %w", ErrNotFound)
+	}
+	return chunks, nil
+}
+
+func (c *SignatureCache) store(path string, stamp fileStamp, chunks []*Chunk) error {
+	var buf bytes.Buffer
+	if err := writeSignatureCacheEntry(&buf, path, stamp, c.id, chunks); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(c.entryPath(path), buf.Bytes()); err != nil {
+		return fmt.Errorf("error writing cache entry: %w", err)
+	}
+	return nil
+}
+
+func statFile(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, fmt.Errorf("error reading file info: %w", err)
+	}
+	return fileStamp{size: info.Size(), modTime: info.ModTime().UnixNano(), inode: fileInode(info)}, nil
+}
+
+// chunkingID identifies the settings the chunks depend on. The hash function (and the key) is identified by the
+// hash of a probe, so that the key itself isn't kept.
+func chunkingID(cfg *Config) []byte {
+	probe := cfg.newHash()
+	probe.Write([]byte(signatureCacheProbe))
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s/%d/%d/%d/%d/%d/%t/%d/", cfg.Algorithm, cfg.WindowSize, cfg.MinChunkSize, cfg.AvgChunkSize,
+		cfg.MaxChunkSize, cfg.Prime, cfg.WeakHash, cfg.StrongHashLen)
+	h.Write(probe.Sum(nil))
+	return h.Sum(nil)
+}
+
+func writeSignatureCacheEntry(w io.Writer, path string, stamp fileStamp, id []byte, chunks []*Chunk) error {
+	header := append(make([]byte, 0, 64+len(path)), signatureCacheMagic...)
+	header = append(header, signatureCacheVersion)
+	header = append(header, id...)
+	header = binary.BigEndian.AppendUint64(header, uint64(stamp.size))
+	header = binary.BigEndian.AppendUint64(header, uint64(stamp.modTime))
+	header = binary.BigEndian.AppendUint64(header, stamp.inode)
+	header = binary.AppendUvarint(header, uint64(len(path)))
+	header = append(header, path...)
+	if _, err := w.Write(header); err != nil {
+		return fmt.Errorf("error writing header: %w", err)
+	}
+	return WriteSignature(w, chunks)
+}
+
+func readSignatureCacheEntry(r io.Reader) (path string, stamp fileStamp, id []byte, chunks []*Chunk, err error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, len(signatureCacheMagic)+1+sha256.Size+3*8)
+	if _, err = io.ReadFull(br, header); err != nil {
+		return "", stamp, nil, nil, fmt.Errorf("error reading header: %w", unexpectedEOF(err))
+	}
+	if string(header[:len(signatureCacheMagic)]) != signatureCacheMagic {
+		return "", stamp, nil, nil, fmt.Errorf("invalid header, not a signature cache entry: %w", ErrInvalidFormat)
+	}
+	if header[len(signatureCacheMagic)] != signatureCacheVersion {
+		return "", stamp, nil, nil, fmt.Errorf("unsupported signature cache format version %d: %w", header[len(signatureCacheMagic)], ErrInvalidFormat)
+	}
+
+	fields := header[len(signatureCacheMagic)+1:]
+	id, fields = fields[:sha256.Size], fields[sha256.Size:]
+	stamp = fileStamp{
+		size:    int64(binary.BigEndian.Uint64(fields)),
+		modTime: int64(binary.BigEndian.Uint64(fields[8:])),
+		inode:   binary.BigEndian.Uint64(fields[16:]),
+	}
+
+	pathBytes, err := readBytes(br, 64*1024)
+	if err != nil {
+		return "", stamp, nil, nil, fmt.Errorf("error reading path: %w", err)
+	}
+	if chunks, err = ReadSignature(br); err != nil {
+		return "", stamp, nil, nil, err
+	}
+	return string(pathBytes), stamp, id, chunks, nil
+}
@@ -0,0 +1,157 @@
+package godiff_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"github.com/mihailozarinschi/godiff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"hash"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestSignatureCache(t *testing.T) {
+	dir := t.TempDir()
+	cacheDir := filepath.Join(dir, "cache")
+	path := filepath.Join(dir, "file")
+	past := time.Now().Add(-time.Hour)
+
+	writeFile := func(t *testing.T, data []byte, modTime time.Time) {
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	var hashes int
+	cfg := &godiff.Config{
+		HashFn: func() hash.Hash {
+			hashes++
+			return sha256.New()
+		},
+		AvgChunkSize: 1024,
+	}
+	cache, err := godiff.OpenSignatureCache(cacheDir, cfg)
+	require.NoError(t, err)
+
+	// chunks provides the file's chunks from the cache, telling whether they were calculated
+	chunks := func(t *testing.T, cache *godiff.SignatureCache) ([]*godiff.Chunk, bool) {
+		hashes = 0
+		chunks, err := cache.Chunks(path)
+		require.NoError(t, err)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		expected, err := godiff.ChunkDataWithConfig(bytes.NewReader(data), &godiff.Config{AvgChunkSize: 1024})
+		require.NoError(t, err)
+		assert.Equal(t, expected, chunks)
+		return chunks, hashes > 0
+	}
+
+	data := randomData(9, 64*1024)
+	writeFile(t, data, past)
+
+	t.Run("cached once chunked", func(t *testing.T) {
+		_, chunked := chunks(t, cache)
+		assert.True(t, chunked)
+		_, chunked = chunks(t, cache)
+		assert.False(t, chunked)
+
+		// Still cached once reopened
+		reopened, err := godiff.OpenSignatureCache(cacheDir, cfg)
+		require.NoError(t, err)
+		_, chunked = chunks(t, reopened)
+		assert.False(t, chunked)
+	})
+
+	t.Run("on-disk format", func(t *testing.T) {
+		entries, err := os.ReadDir(cacheDir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+
+		entry, err := os.ReadFile(filepath.Join(cacheDir, entries[0].Name()))
+		require.NoError(t, err)
+		assert.Equal(t, "GSCC\x01", string(entry[:5]))
+		assert.Contains(t, string(entry), path)
+		assert.Contains(t, string(entry), "GSIG\x01")
+
+		// A corrupted entry is replaced
+		require.NoError(t, os.WriteFile(filepath.Join(cacheDir, entries[0].Name()), entry[:len(entry)-1], 0o644))
+		_, chunked := chunks(t, cache)
+		assert.True(t, chunked)
+		_, chunked = chunks(t, cache)
+		assert.False(t, chunked)
+	})
+
+	t.Run("modified file", func(t *testing.T) {
+		data[100] ^= 0xFF
+		writeFile(t, data, past.Add(time.Second))
+		_, chunked := chunks(t, cache)
+		assert.True(t, chunked)
+		_, chunked = chunks(t, cache)
+		assert.False(t, chunked)
+	})
+
+	t.Run("replaced file", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("no inodes")
+		}
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+
+		// Same size and modification time, but another inode
+		data[200] ^= 0xFF
+		other := filepath.Join(dir, "other")
+		require.NoError(t, os.WriteFile(other, data, 0o644))
+		require.NoError(t, os.Chtimes(other, info.ModTime(), info.ModTime()))
+		require.NoError(t, os.Rename(other, path))
+
+		_, chunked := chunks(t, cache)
+		assert.True(t, chunked)
+	})
+
+	t.Run("other chunking settings", func(t *testing.T) {
+		other, err := godiff.OpenSignatureCache(cacheDir, &godiff.Config{AvgChunkSize: 2048})
+		require.NoError(t, err)
+		otherChunks, err := other.Chunks(path)
+		require.NoError(t, err)
+		assert.Greater(t, otherChunks[0].DataLen, int64(0))
+
+		// The entry was replaced by the other settings' one
+		_, chunked := chunks(t, cache)
+		assert.True(t, chunked)
+		_, chunked = chunks(t, cache)
+		assert.False(t, chunked)
+
+		keyed, err := godiff.OpenSignatureCache(cacheDir, &godiff.Config{HashFn: cfg.HashFn, AvgChunkSize: 1024, Key: []byte("0123456789abcdef")})
+		require.NoError(t, err)
+		hashes = 0
+		_, err = keyed.Chunks(path)
+		require.NoError(t, err)
+		assert.Greater(t, hashes, 0)
+	})
+
+	t.Run("recently modified file", func(t *testing.T) {
+		writeFile(t, data, time.Now())
+		_, chunked := chunks(t, cache)
+		assert.True(t, chunked)
+		_, chunked = chunks(t, cache)
+		assert.True(t, chunked)
+	})
+
+	t.Run("invalidated", func(t *testing.T) {
+		writeFile(t, data, past)
+		_, chunked := chunks(t, cache)
+		assert.True(t, chunked)
+
+		require.NoError(t, cache.Invalidate(path))
+		_, chunked = chunks(t, cache)
+		assert.True(t, chunked)
+		require.NoError(t, cache.Invalidate(filepath.Join(dir, "missing")))
+	})
+
+	_, err = cache.Chunks(filepath.Join(dir, "missing"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,252 @@
+package godiff
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+)
+
+// The signed binary format wraps diffs or a signature (in their own binary format, see WriteDiffs and
+// WriteSignature) with an ed25519 signature. It's made of:
+//   - the header: magic, version and kind of payload (1 byte)
+//   - the source and target digests: presence (1 byte), size (8 bytes) and SHA-256 (32 bytes)
+//   - the payload size (8 bytes) and SHA-256 (32 bytes)
+//   - the ed25519 signature of everything above (64 bytes)
+//   - the payload
+//
+// Only the payload's digest is signed, so that the signature can be verified before reading the payload.
+const (
+	signedMagic   = "GSGN"
+	signedVersion = 1
+
+	signedKindDiffs     = 1
+	signedKindSignature = 2
+
+	signedHeaderLen = len(signedMagic) + 2 + 2*fileDigestLen + 8 + sha256.Size
+)
+
+// FileDigest identifies the whole data of a file
+type FileDigest struct {
+	Size   int64
+	Digest string // SHA-256 of the data
+}
+
+// fileDigestLen is the length of an encoded FileDigest: presence (1 byte), size (8 bytes) and SHA-256 (32 bytes)
+const fileDigestLen = 1 + 8 + sha256.Size
+
+// DigestData reads all the data from r and provides its digest
+func DigestData(r io.Reader) (*FileDigest, error) {
+	dw := newDigestWriter()
+	if _, err := io.Copy(dw, r); err != nil {
+		return nil, fmt.Errorf("error reading data: %w", err)
+	}
+	return dw.digest(), nil
+}
+
+// SignedDiffs contains diffs, along with the digests of the data they apply to and of the data they produce
+type SignedDiffs struct {
+	Diffs  []*Diff
+	Source *FileDigest // Original data
+	Target *FileDigest // Updated data
+}
+
+// SignedSignature contains a signature (the chunks of some data), along with the digest of that data
+type SignedSignature struct {
+	Chunks []*Chunk
+	Source *FileDigest
+}
+
+// WriteSignedDiffs writes the diffs and their digests to w, signed with the private key
+func WriteSignedDiffs(w io.Writer, signed *SignedDiffs, key ed25519.PrivateKey) error {
+	if signed.Source == nil || signed.Target == nil {
+		return &ParamError{Name: "signed", Value: signed, Reason: "both source and target digests are needed"}
+	}
+
+	var payload bytes.Buffer
+	if err := WriteDiffs(&payload, signed.Diffs); err != nil {
+		return err
+	}
+	return writeSigned(w, signedKindDiffs, signed.Source, signed.Target, payload.Bytes(), key)
+}
+
+// ReadSignedDiffs reads signed diffs from r, verifying them with the public key
+func ReadSignedDiffs(r io.Reader, key ed25519.PublicKey) (*SignedDiffs, error) {
+	source, target, payload, err := readSigned(r, signedKindDiffs, key)
+	if err != nil {
+		return nil, err
+	}
+	if source == nil || target == nil {
+		return nil, fmt.Errorf("signed diffs without source or target digest: %w", ErrInvalidFormat)
+	}
+
+	diffs, err := ReadDiffs(bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	return &SignedDiffs{Diffs: diffs, Source: source, Target: target}, nil
+}
+
+// WriteSignedSignature writes the chunks and the digest of their data to w, signed with the private key
+func WriteSignedSignature(w io.Writer, signed *SignedSignature, key ed25519.PrivateKey) error {
+	if signed.Source == nil {
+		return &ParamError{Name: "signed", Value: signed, Reason: "the source digest is needed"}
+	}
+
+	var payload bytes.Buffer
+	if err := WriteSignature(&payload, signed.Chunks); err != nil {
+		return err
+	}
+	return writeSigned(w, signedKindSignature, signed.Source, nil, payload.Bytes(), key)
+}
+
+// ReadSignedSignature reads a signed signature from r, verifying it with the public key
+func ReadSignedSignature(r io.Reader, key ed25519.PublicKey) (*SignedSignature, error) {
+	source, _, payload, err := readSigned(r, signedKindSignature, key)
+	if err != nil {
+		return nil, err
+	}
+	if source == nil {
+		return nil, fmt.Errorf("signed signature without source digest: %w", ErrInvalidFormat)
+	}
+
+	chunks, err := ReadSignature(bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	return &SignedSignature{Chunks: chunks, Source: source}, nil
+}
+
+// Patch works like Patch, but refuses to patch any original data not matching the source digest. Once patched,
+// the updated data written to w is checked against the target digest.
+func (s *SignedDiffs) Patch(originalData io.ReaderAt, w io.Writer) error {
+	if s.Source == nil || s.Target == nil {
+		return &ParamError{Name: "s", Value: s, Reason: "both source and target digests are needed"}
+	}
+
+	source, err := DigestData(io.NewSectionReader(originalData, 0, math.MaxInt64))
+	if err != nil {
+		return fmt.Errorf("error reading original data: %w", err)
+	}
+	if *source != *s.Source {
+		return &VerificationError{Data: "original", Expected: s.Source, Actual: source}
+	}
+
+	return PatchVerified(originalData, s.Diffs, w, &PatchVerification{Target: s.Target})
+}
+
+func writeSigned(w io.Writer, kind byte, source, target *FileDigest, payload []byte, key ed25519.PrivateKey) error {
+	if len(key) != ed25519.PrivateKeySize {
+		return &ParamError{Name: "key", Value: fmt.Sprintf("(%d bytes)", len(key)), Reason: fmt.Sprintf("must be %d bytes", ed25519.PrivateKeySize)}
+	}
+
+	header := make([]byte, 0, signedHeaderLen+ed25519.SignatureSize)
+	header = append(header, signedMagic...)
+	header = append(header, signedVersion, kind)
+	for _, digest := range []*FileDigest{source, target} {
+		var err error
+		if header, err = appendFileDigest(header, digest); err != nil {
+			return err
+		}
+	}
+	payloadDigest := sha256.Sum256(payload)
+	header = binary.BigEndian.AppendUint64(header, uint64(len(payload)))
+	header = append(header, payloadDigest[:]...)
+	header = append(header, ed25519.Sign(key, header)...)
+
+	if _, err := w.Write(header); err != nil {
+		return fmt.Errorf("error writing header: %w", err)
+	}
+	if _, err := w.Write(payload); err != nil {
+		return fmt.Errorf("error writing payload: %w", err)
+	}
+	return nil
+}
+
+func readSigned(r io.Reader, kind byte, key ed25519.PublicKey) (source, target *FileDigest, payload []byte, err error) {
+	if len(key) != ed25519.PublicKeySize {
+		return nil, nil, nil, &ParamError{Name: "key", Value: fmt.Sprintf("(%d bytes)", len(key)), Reason: fmt.Sprintf("must be %d bytes", ed25519.PublicKeySize)}
+	}
+
+	header := make([]byte, signedHeaderLen+ed25519.SignatureSize)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return nil, nil, nil, fmt.Errorf("error reading header: %w", unexpectedEOF(err))
+	}
+	if string(header[:len(signedMagic)]) != signedMagic {
+		return nil, nil, nil, fmt.Errorf("invalid header, not a signed stream: %w", ErrInvalidFormat)
+	}
+	if !ed25519.Verify(key, header[:signedHeaderLen], header[signedHeaderLen:]) {
+		return nil, nil, nil, fmt.Errorf("header doesn't match its signature: %w", ErrInvalidSignature)
+	}
+
+	// From here on, the header can be trusted
+	fields := header[len(signedMagic):signedHeaderLen]
+	if fields[0] != signedVersion {
+		return nil, nil, nil, fmt.Errorf("unsupported signed format version %d: %w", fields[0], ErrInvalidFormat)
+	}
+	if fields[1] != kind {
+		return nil, nil, nil, fmt.Errorf("unexpected kind of signed payload %d, expected %d: %w", fields[1], kind, ErrInvalidFormat)
+	}
+	fields = fields[2:]
+	source, fields = readFileDigest(fields)
+	target, fields = readFileDigest(fields)
+
+	payloadLen := binary.BigEndian.Uint64(fields)
+	var buf bytes.Buffer
+	if _, err = io.CopyN(&buf, r, int64(payloadLen)); err != nil {
+		return nil, nil, nil, fmt.Errorf("error reading payload: %w", unexpectedEOF(err))
+	}
+	if payloadDigest := sha256.Sum256(buf.Bytes()); !bytes.Equal(payloadDigest[:], fields[8:]) {
+		return nil, nil, nil, fmt.Errorf("payload doesn't match its signed digest: %w", ErrInvalidSignature)
+	}
+
+	return source, target, buf.Bytes(), nil
+}
+
+func appendFileDigest(b []byte, digest *FileDigest) ([]byte, error) {
+	if digest == nil {
+		return append(b, make([]byte, fileDigestLen)...), nil
+	}
+
+	sum, err := hex.DecodeString(digest.Digest)
+	if err != nil || len(sum) != sha256.Size || digest.Size < 0 {
+		return nil, &ParamError{Name: "digest", Value: digest, Reason: "must be the size and SHA-256 of some data"}
+	}
+	b = append(b, 1)
+	b = binary.BigEndian.AppendUint64(b, uint64(digest.Size))
+	return append(b, sum...), nil
+}
+
+func readFileDigest(b []byte) (*FileDigest, []byte) {
+	if b[0] == 0 {
+		return nil, b[fileDigestLen:]
+	}
+	return &FileDigest{
+		Size:   int64(binary.BigEndian.Uint64(b[1:])),
+		Digest: hex.EncodeToString(b[9:fileDigestLen]),
+	}, b[fileDigestLen:]
+}
+
+// digestWriter calculates the digest of everything written to it
+type digestWriter struct {
+	h    hash.Hash
+	size int64
+}
+
+func newDigestWriter() *digestWriter {
+	return &digestWriter{h: sha256.New()}
+}
+
+func (d *digestWriter) Write(b []byte) (int, error) {
+	d.size += int64(len(b))
+	return d.h.Write(b)
+}
+
+func (d *digestWriter) digest() *FileDigest {
+	return &FileDigest{Size: d.size, Digest: hex.EncodeToString(d.h.Sum(nil))}
+}
@@ -0,0 +1,112 @@
+package godiff_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha1"
+	"github.com/mihailozarinschi/godiff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestSignedDiffs(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	otherPublicKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	updated := strings.Replace(loremIpsum, "consectetur", "xxxxxxxxxxx", 1) + " Appended data."
+	diffs, err := godiff.CalcDiffs(strings.NewReader(loremIpsum), strings.NewReader(updated), sha1.New, 4, 16, 7)
+	require.NoError(t, err)
+
+	source, err := godiff.DigestData(strings.NewReader(loremIpsum))
+	require.NoError(t, err)
+	target, err := godiff.DigestData(strings.NewReader(updated))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, godiff.WriteSignedDiffs(&buf, &godiff.SignedDiffs{Diffs: diffs, Source: source, Target: target}, privateKey))
+	signed := buf.Bytes()
+
+	t.Run("verified and patched", func(t *testing.T) {
+		decoded, err := godiff.ReadSignedDiffs(bytes.NewReader(signed), publicKey)
+		require.NoError(t, err)
+		assert.Equal(t, diffs, decoded.Diffs)
+		assert.Equal(t, source, decoded.Source)
+		assert.Equal(t, target, decoded.Target)
+
+		var patched bytes.Buffer
+		require.NoError(t, decoded.Patch(strings.NewReader(loremIpsum), &patched))
+		assert.Equal(t, updated, patched.String())
+	})
+
+	t.Run("wrong base", func(t *testing.T) {
+		decoded, err := godiff.ReadSignedDiffs(bytes.NewReader(signed), publicKey)
+		require.NoError(t, err)
+
+		var patched bytes.Buffer
+		err = decoded.Patch(strings.NewReader(updated), &patched)
+		assert.ErrorIs(t, err, godiff.ErrChecksumMismatch)
+		assert.Empty(t, patched.Bytes())
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		_, err := godiff.ReadSignedDiffs(bytes.NewReader(signed), otherPublicKey)
+		assert.ErrorIs(t, err, godiff.ErrInvalidSignature)
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		// Every single byte is covered, either by the signature, or by the signed payload digest
+		for i := range signed {
+			tampered := append([]byte{}, signed...)
+			tampered[i] ^= 0x01
+
+			_, err := godiff.ReadSignedDiffs(bytes.NewReader(tampered), publicKey)
+			require.Error(t, err, "byte %d", i)
+			if i >= len("GSGN") {
+				require.ErrorIs(t, err, godiff.ErrInvalidSignature, "byte %d", i)
+			}
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		_, err := godiff.ReadSignedDiffs(bytes.NewReader(signed[:len(signed)-1]), publicKey)
+		assert.ErrorIs(t, err, godiff.ErrShortRead)
+	})
+
+	t.Run("not diffs", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, godiff.WriteSignedSignature(&buf, &godiff.SignedSignature{Source: source}, privateKey))
+
+		_, err := godiff.ReadSignedDiffs(&buf, publicKey)
+		assert.ErrorIs(t, err, godiff.ErrInvalidFormat)
+	})
+}
+
+func TestSignedSignature(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	chunks, err := godiff.ChunkData(strings.NewReader(loremIpsum), sha1.New(), 4, 16, 7)
+	require.NoError(t, err)
+	source, err := godiff.DigestData(strings.NewReader(loremIpsum))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, godiff.WriteSignedSignature(&buf, &godiff.SignedSignature{Chunks: chunks, Source: source}, privateKey))
+	signed := buf.Bytes()
+
+	decoded, err := godiff.ReadSignedSignature(bytes.NewReader(signed), publicKey)
+	require.NoError(t, err)
+	assert.Equal(t, chunks, decoded.Chunks)
+	assert.Equal(t, source, decoded.Source)
+
+	signed[len(signed)-2] ^= 0x01
+	_, err = godiff.ReadSignedSignature(bytes.NewReader(signed), publicKey)
+	assert.ErrorIs(t, err, godiff.ErrInvalidSignature)
+
+	err = godiff.WriteSignedSignature(&buf, &godiff.SignedSignature{Chunks: chunks, Source: source}, privateKey[:10])
+	assert.ErrorIs(t, err, godiff.ErrInvalidParams)
+}
@@ -0,0 +1,147 @@
+package godiff
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ChunkStore stores blobs (e.g. chunks' data) by key
+type ChunkStore interface {
+	// Put stores the blob, replacing any blob already stored with the same key
+	Put(key string, blob []byte) error
+	// Get provides the blob stored with the key, or ErrNotFound
+	Get(key string) ([]byte, error)
+	// Has tells whether a blob is stored with the key
+	Has(key string) (bool, error)
+	// Keys provides the keys of all the blobs stored
+	Keys() ([]string, error)
+}
+
+// MemoryStore is a ChunkStore keeping the blobs in memory, safe for concurrent use
+type MemoryStore struct {
+	mu    sync.RWMutex
+	blobs map[string][]byte
+}
+
+// NewMemoryStore provides an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{blobs: make(map[string][]byte)}
+}
+
+func (s *MemoryStore) Put(key string, blob []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[key] = append([]byte(nil), blob...)
+	return nil
+}
+
+func (s *MemoryStore) Get(key string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	blob, ok := s.blobs[key]
+	if !ok {
+		return nil, fmt.Errorf("blob %s: %w", key, ErrNotFound)
+	}
+	return append([]byte(nil), blob...), nil
+}
+
+func (s *MemoryStore) Has(key string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.blobs[key]
+	return ok, nil
+}
+
+func (s *MemoryStore) Keys() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]string, 0, len(s.blobs))
+	for key := range s.blobs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// DirStore is a ChunkStore keeping each blob in its own file, in a directory
+type DirStore struct {
+	dir string
+}
+
+// NewDirStore provides a DirStore storing the blobs in dir, creating it if needed
+func NewDirStore(dir string) (*DirStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating store directory: %w", err)
+	}
+	return &DirStore{dir: dir}, nil
+}
+
+func (s *DirStore) Put(key string, blob []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err = writeFileAtomic(path, blob); err != nil {
+		return fmt.Errorf("error writing blob %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *DirStore) Get(key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("blob %s: %w", key, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading blob %s: %w", key, err)
+	}
+	return blob, nil
+}
+
+func (s *DirStore) Has(key string) (bool, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error checking blob %s: %w", key, err)
+	}
+	return true, nil
+}
+
+func (s *DirStore) Keys() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("error listing store directory: %w", err)
+	}
+
+	var keys []string
+	for _, entry := range entries {
+		// Skip the leftovers of interrupted writes
+		if entry.Type().IsRegular() && !strings.HasSuffix(entry.Name(), ".tmp") {
+			keys = append(keys, entry.Name())
+		}
+	}
+	return keys, nil
+}
+
+// path provides the path of the blob's file, the key must be a valid file name
+func (s *DirStore) path(key string) (string, error) {
+	if key == "" || key != filepath.Base(key) || strings.HasPrefix(key, ".") || strings.HasSuffix(key, ".tmp") {
+		return "", &ParamError{Name: "key", Value: key, Reason: "must be a valid file name"}
+	}
+	return filepath.Join(s.dir, key), nil
+}
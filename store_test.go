@@ -0,0 +1,65 @@
+package godiff_test
+
+import (
+	"github.com/mihailozarinschi/godiff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestChunkStores(t *testing.T) {
+	tt := []struct {
+		name  string
+		store func(t *testing.T) godiff.ChunkStore
+	}{
+		{
+			name:  "memory",
+			store: func(_ *testing.T) godiff.ChunkStore { return godiff.NewMemoryStore() },
+		},
+		{
+			name: "directory",
+			store: func(t *testing.T) godiff.ChunkStore {
+				store, err := godiff.NewDirStore(t.TempDir())
+				require.NoError(t, err)
+				return store
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			store := tc.store(t)
+
+			_, err := store.Get("a")
+			assert.ErrorIs(t, err, godiff.ErrNotFound)
+			ok, err := store.Has("a")
+			require.NoError(t, err)
+			assert.False(t, ok)
+
+			require.NoError(t, store.Put("b", []byte("blob b")))
+			require.NoError(t, store.Put("a", []byte("blob a")))
+			require.NoError(t, store.Put("a", []byte("blob a, replaced")))
+
+			blob, err := store.Get("a")
+			require.NoError(t, err)
+			assert.Equal(t, []byte("blob a, replaced"), blob)
+			ok, err = store.Has("a")
+			require.NoError(t, err)
+			assert.True(t, ok)
+
+			keys, err := store.Keys()
+			require.NoError(t, err)
+			assert.Equal(t, []string{"a", "b"}, keys)
+		})
+	}
+}
+
+func TestDirStoreInvalidKeys(t *testing.T) {
+	store, err := godiff.NewDirStore(t.TempDir())
+	require.NoError(t, err)
+
+	for _, key := range []string{"", "../a", "a/b", ".hidden", "a.tmp"} {
+		err := store.Put(key, []byte("blob"))
+		assert.ErrorIs(t, err, godiff.ErrInvalidParams, key)
+	}
+}
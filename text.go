@@ -0,0 +1,419 @@
+package godiff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SegmentType tells whether a segment of a text diff is in both texts, or only in one of them
+type SegmentType int
+
+const (
+	SegmentEqual SegmentType = iota
+	SegmentDelete
+	SegmentInsert
+)
+
+func (t SegmentType) String() string {
+	switch t {
+	case SegmentEqual:
+		return "Equal"
+	case SegmentDelete:
+		return "Delete"
+	case SegmentInsert:
+		return "Insert"
+	default:
+		return ""
+	}
+}
+
+// Segment is a part of a text diff: text of the original text (SegmentDelete), of the updated text
+// (SegmentInsert), or of both (SegmentEqual)
+type Segment struct {
+	Type SegmentType
+	Text string
+}
+
+// DiffRunes provides the segments of the differences between 2 texts, rune by rune, so multibyte characters are
+// never split. Within each change, the deleted text comes before the inserted one.
+func DiffRunes(original, updated string) []Segment {
+	return diffTokens(strings.Split(original, ""), strings.Split(updated, ""))
+}
+
+// DiffWords works like DiffRunes, word by word: the texts are split into words (letters, digits and
+// underscores), runs of spaces, and single punctuation characters
+func DiffWords(original, updated string) []Segment {
+	return diffTokens(splitWords(original), splitWords(updated))
+}
+
+// DiffSegments provides the segments of the differences between the original data and the diffs' updated data
+// (as provided by CalcDiffs), so they can be rendered like a text diff. The segments follow the chunks' boundaries,
+// so a change could start or end in the middle of a multibyte character.
+func DiffSegments(originalData io.ReaderAt, diffs []*Diff) ([]Segment, error) {
+	var removals, additions []*Diff
+	for i, diff := range diffs {
+		switch diff.Type {
+		case DeltaTypeRemove:
+			removals = append(removals, diff)
+		case DeltaTypeAdd:
+			if int64(len(diff.Data)) != diff.DataLen {
+				return nil, fmt.Errorf("diff #%d has %d bytes of data, expected %d: %w", i, len(diff.Data), diff.DataLen, ErrInvalidDiffs)
+			}
+			additions = append(additions, diff)
+		default:
+			return nil, fmt.Errorf("diff #%d has an unknown type %d: %w", i, diff.Type, ErrInvalidDiffs)
+		}
+	}
+	sort.SliceStable(removals, func(i, j int) bool { return removals[i].DataOffset < removals[j].DataOffset })
+	sort.SliceStable(additions, func(i, j int) bool { return additions[i].DataOffset < additions[j].DataOffset })
+
+	var (
+		segments          []Segment
+		original, updated int64 // Current offsets in the original and updated data
+	)
+	for {
+		// Removed chunks starting at the current offset, overlapping ones are only removed once
+		for len(removals) > 0 && removals[0].DataOffset <= original {
+			if end := removals[0].DataOffset + removals[0].DataLen; end > original {
+				data, err := readOriginal(originalData, original, end-original)
+				if err != nil {
+					return nil, fmt.Errorf("error reading removed chunk at %d (len=%d): %w", removals[0].DataOffset, removals[0].DataLen, err)
+				}
+				segments = append(segments, Segment{Type: SegmentDelete, Text: string(data)})
+				original = end
+			}
+			removals = removals[1:]
+		}
+
+		if len(additions) > 0 {
+			if additions[0].DataOffset < updated {
+				return nil, fmt.Errorf("addition at %d (len=%d) overlaps the previous one: %w", additions[0].DataOffset, additions[0].DataLen, ErrInvalidDiffs)
+			}
+			if additions[0].DataOffset == updated {
+				segments = append(segments, Segment{Type: SegmentInsert, Text: string(additions[0].Data)})
+				updated += additions[0].DataLen
+				additions = additions[1:]
+				continue
+			}
+		}
+
+		// Kept data until the next removal or addition, or until the end of the original data
+		n := int64(-1)
+		if len(removals) > 0 {
+			n = removals[0].DataOffset - original
+		}
+		if len(additions) > 0 && (n < 0 || additions[0].DataOffset-updated < n) {
+			n = additions[0].DataOffset - updated
+		}
+
+		var (
+			data []byte
+			err  error
+		)
+		if n < 0 {
+			data, err = io.ReadAll(io.NewSectionReader(originalData, original, 1<<62))
+		} else {
+			data, err = readOriginal(originalData, original, n)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading original data at %d: %w", original, err)
+		}
+		segments = append(segments, Segment{Type: SegmentEqual, Text: string(data)})
+		original += int64(len(data))
+		updated += int64(len(data))
+
+		if n < 0 {
+			return mergeSegments(segments), nil
+		}
+	}
+}
+
+// OriginalText rebuilds the original text from the segments
+func OriginalText(segments []Segment) string {
+	return joinSegments(segments, SegmentDelete)
+}
+
+// UpdatedText rebuilds the updated text from the segments
+func UpdatedText(segments []Segment) string {
+	return joinSegments(segments, SegmentInsert)
+}
+
+// CleanupSemantic makes the segments easier to read for humans: the equalities that are no longer than the changes
+// on both of their sides (e.g. a single space between 2 changed words) are merged into the changes
+func CleanupSemantic(segments []Segment) []Segment {
+	segments = append([]Segment(nil), segments...)
+
+	var (
+		equalities   []int // Indexes of the equalities that could still be merged
+		lastEquality string
+		// Lengths of the changes before and after the last equality
+		deletedBefore, insertedBefore int
+		deletedAfter, insertedAfter   int
+		changed                       bool
+	)
+
+	for i := 0; i < len(segments); i++ {
+		if segments[i].Type == SegmentEqual {
+			equalities = append(equalities, i)
+			deletedBefore, insertedBefore = deletedAfter, insertedAfter
+			deletedAfter, insertedAfter = 0, 0
+			lastEquality = segments[i].Text
+			continue
+		}
+
+		if segments[i].Type == SegmentDelete {
+			deletedAfter += utf8.RuneCountInString(segments[i].Text)
+		} else {
+			insertedAfter += utf8.RuneCountInString(segments[i].Text)
+		}
+
+		length := utf8.RuneCountInString(lastEquality)
+		if lastEquality == "" || length > maxInt(deletedBefore, insertedBefore) || length > maxInt(deletedAfter, insertedAfter) {
+			continue
+		}
+
+		// The equality becomes a deletion followed by an insertion of the same text
+		at := equalities[len(equalities)-1]
+		segments[at].Type = SegmentInsert
+		segments = append(segments[:at], append([]Segment{{Type: SegmentDelete, Text: lastEquality}}, segments[at:]...)...)
+
+		// The previous equality has to be checked again, with the changes merged
+		equalities = equalities[:len(equalities)-1]
+		if len(equalities) > 0 {
+			equalities = equalities[:len(equalities)-1]
+		}
+		i = -1
+		if len(equalities) > 0 {
+			i = equalities[len(equalities)-1]
+		}
+		deletedBefore, insertedBefore, deletedAfter, insertedAfter = 0, 0, 0, 0
+		lastEquality = ""
+		changed = true
+	}
+
+	if !changed {
+		return segments
+	}
+	return mergeSegments(segments)
+}
+
+// maxTextEdits is the most tokens that can differ between 2 texts for their diff to be the shortest one. Finding it
+// takes quadratic memory in the number of differences.
+const maxTextEdits = 1024
+
+// diffTokens provides the segments of the differences between the tokens: the fewest deleted and inserted tokens,
+// unless there are more than maxTextEdits of them
+func diffTokens(original, updated []string) []Segment {
+	// Trimming the common prefix and suffix first keeps the changes where they happened
+	prefix := 0
+	for prefix < len(original) && prefix < len(updated) && original[prefix] == updated[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(original)-prefix && suffix < len(updated)-prefix &&
+		original[len(original)-1-suffix] == updated[len(updated)-1-suffix] {
+		suffix++
+	}
+	o, u := original[prefix:len(original)-suffix], updated[prefix:len(updated)-suffix]
+
+	removed, added, ok := shortestEdits(o, u, maxTextEdits)
+	if !ok {
+		// Too different to find the fewest changes quickly, the engine of DiffSlices is linear
+		removed, added = make([]bool, len(o)), make([]bool, len(u))
+		for _, delta := range DiffSlices(o, u) {
+			if delta.Type == DeltaTypeRemove {
+				removed[delta.Position] = true
+			} else {
+				added[delta.Position] = true
+			}
+		}
+	}
+
+	segments := []Segment{{Type: SegmentEqual, Text: strings.Join(original[:prefix], "")}}
+	// Kept tokens are in the same order in both, anything in between them is a change
+	var oc, uc int
+	for oc < len(o) || uc < len(u) {
+		switch {
+		case oc < len(o) && removed[oc]:
+			segments = append(segments, Segment{Type: SegmentDelete, Text: o[oc]})
+			oc++
+		case uc < len(u) && added[uc]:
+			segments = append(segments, Segment{Type: SegmentInsert, Text: u[uc]})
+			uc++
+		default:
+			segments = append(segments, Segment{Type: SegmentEqual, Text: o[oc]})
+			oc++
+			uc++
+		}
+	}
+	segments = append(segments, Segment{Type: SegmentEqual, Text: strings.Join(original[len(original)-suffix:], "")})
+
+	return mergeSegments(segments)
+}
+
+// shortestEdits finds the fewest tokens to remove from the original tokens and to add to them to get the updated
+// ones (Myers' algorithm), if there are at most maxEdits of them
+func shortestEdits(original, updated []string, maxEdits int) (removed, added []bool, ok bool) {
+	n, m := len(original), len(updated)
+
+	// trace[d][k+d] is the furthest original offset reached on the diagonal k (original - updated offset),
+	// with d edits
+	var trace [][]int
+	for d := 0; d <= maxEdits; d++ {
+		v := make([]int, 2*d+1)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			switch {
+			case d == 0:
+			case k == -d || (k != d && trace[d-1][k-1+d-1] < trace[d-1][k+1+d-1]):
+				x = trace[d-1][k+1+d-1] // Addition
+			default:
+				x = trace[d-1][k-1+d-1] + 1 // Removal
+			}
+			y := x - k
+			for x < n && y < m && original[x] == updated[y] {
+				x++
+				y++
+			}
+			v[k+d] = x
+
+			if x < n || y < m {
+				continue
+			}
+
+			// Walk the edits back from the end
+			trace = append(trace, v)
+			removed, added = make([]bool, n), make([]bool, m)
+			for ; d > 0; d-- {
+				k = x - y
+				prev := trace[d-1]
+				if k == -d || (k != d && prev[k-1+d-1] < prev[k+1+d-1]) {
+					x = prev[k+1+d-1]
+					y = x - k - 1
+					added[y] = true
+				} else {
+					x = prev[k-1+d-1]
+					y = x - k + 1
+					removed[x] = true
+				}
+			}
+			return removed, added, true
+		}
+		trace = append(trace, v)
+	}
+	return nil, nil, false
+}
+
+// mergeSegments merges the consecutive segments of the same type, drops the empty ones, and puts the deletions
+// before the insertions within each change
+func mergeSegments(segments []Segment) []Segment {
+	var (
+		merged            []Segment
+		deleted, inserted strings.Builder
+	)
+	flush := func() {
+		if deleted.Len() > 0 {
+			merged = append(merged, Segment{Type: SegmentDelete, Text: deleted.String()})
+			deleted.Reset()
+		}
+		if inserted.Len() > 0 {
+			merged = append(merged, Segment{Type: SegmentInsert, Text: inserted.String()})
+			inserted.Reset()
+		}
+	}
+
+	for _, segment := range segments {
+		switch segment.Type {
+		case SegmentDelete:
+			deleted.WriteString(segment.Text)
+		case SegmentInsert:
+			inserted.WriteString(segment.Text)
+		default:
+			if segment.Text == "" {
+				continue
+			}
+			flush()
+			if last := len(merged) - 1; last >= 0 && merged[last].Type == SegmentEqual {
+				merged[last].Text += segment.Text
+			} else {
+				merged = append(merged, segment)
+			}
+		}
+	}
+	flush()
+	return merged
+}
+
+// readOriginal reads exactly n bytes of the original data at the offset
+func readOriginal(r io.ReaderAt, offset, n int64) ([]byte, error) {
+	if offset < 0 || n < 0 {
+		return nil, fmt.Errorf("invalid offset/length %d/%d: %w", offset, n, ErrInvalidFormat)
+	}
+	data := make([]byte, n)
+	read, err := r.ReadAt(data, offset)
+	if read == len(data) {
+		return data, nil
+	}
+	if err == nil || errors.Is(err, io.EOF) {
+		err = ErrShortRead
+	}
+	return nil, err
+}
+
+func joinSegments(segments []Segment, changes SegmentType) string {
+	var sb strings.Builder
+	for _, segment := range segments {
+		if segment.Type == SegmentEqual || segment.Type == changes {
+			sb.WriteString(segment.Text)
+		}
+	}
+	return sb.String()
+}
+
+// splitWords splits the text into words, runs of spaces, and single other characters
+func splitWords(text string) []string {
+	var tokens []string
+	for len(text) > 0 {
+		r, size := utf8.DecodeRuneInString(text)
+		class := wordClass(r)
+		for class != wordOther && size < len(text) {
+			next, nextSize := utf8.DecodeRuneInString(text[size:])
+			if wordClass(next) != class {
+				break
+			}
+			size += nextSize
+		}
+		tokens = append(tokens, text[:size])
+		text = text[size:]
+	}
+	return tokens
+}
+
+const (
+	wordOther = iota
+	wordLetter
+	wordSpace
+)
+
+func wordClass(r rune) int {
+	switch {
+	case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || unicode.Is(unicode.Mn, r):
+		return wordLetter
+	case unicode.IsSpace(r):
+		return wordSpace
+	default:
+		return wordOther
+	}
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
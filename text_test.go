@@ -0,0 +1,251 @@
+package godiff_test
+
+import (
+	"github.com/mihailozarinschi/godiff"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDiffRunes(t *testing.T) {
+	tt := []struct {
+		name     string
+		original string
+		updated  string
+		segments []godiff.Segment
+	}{
+		{
+			name:     "replaced letters",
+			original: "kitten",
+			updated:  "sitting",
+			segments: []godiff.Segment{
+				{Type: godiff.SegmentDelete, Text: "k"},
+				{Type: godiff.SegmentInsert, Text: "s"},
+				{Type: godiff.SegmentEqual, Text: "itt"},
+				{Type: godiff.SegmentDelete, Text: "e"},
+				{Type: godiff.SegmentInsert, Text: "i"},
+				{Type: godiff.SegmentEqual, Text: "n"},
+				{Type: godiff.SegmentInsert, Text: "g"},
+			},
+		},
+		{
+			name:     "multibyte characters",
+			original: "héllo wörld",
+			updated:  "hallo wörld!",
+			segments: []godiff.Segment{
+				{Type: godiff.SegmentEqual, Text: "h"},
+				{Type: godiff.SegmentDelete, Text: "é"},
+				{Type: godiff.SegmentInsert, Text: "a"},
+				{Type: godiff.SegmentEqual, Text: "llo wörld"},
+				{Type: godiff.SegmentInsert, Text: "!"},
+			},
+		},
+		{
+			// Both runes start with the same bytes
+			name:     "runes sharing bytes",
+			original: "日本語のテキスト",
+			updated:  "日本誤のテキスト",
+			segments: []godiff.Segment{
+				{Type: godiff.SegmentEqual, Text: "日本"},
+				{Type: godiff.SegmentDelete, Text: "語"},
+				{Type: godiff.SegmentInsert, Text: "誤"},
+				{Type: godiff.SegmentEqual, Text: "のテキスト"},
+			},
+		},
+		{
+			name:     "all different",
+			original: "abc",
+			updated:  "xyz",
+			segments: []godiff.Segment{
+				{Type: godiff.SegmentDelete, Text: "abc"},
+				{Type: godiff.SegmentInsert, Text: "xyz"},
+			},
+		},
+		{
+			name:     "empty original",
+			original: "",
+			updated:  "ab",
+			segments: []godiff.Segment{{Type: godiff.SegmentInsert, Text: "ab"}},
+		},
+		{
+			name:     "same",
+			original: "abc",
+			updated:  "abc",
+			segments: []godiff.Segment{{Type: godiff.SegmentEqual, Text: "abc"}},
+		},
+		{
+			name:     "both empty",
+			original: "",
+			updated:  "",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			segments := godiff.DiffRunes(tc.original, tc.updated)
+			assert.Equal(t, tc.segments, segments)
+			assert.Equal(t, tc.original, godiff.OriginalText(segments))
+			assert.Equal(t, tc.updated, godiff.UpdatedText(segments))
+			for _, segment := range segments {
+				assert.True(t, utf8.ValidString(segment.Text))
+			}
+		})
+	}
+}
+
+func TestDiffWords(t *testing.T) {
+	tt := []struct {
+		name     string
+		original string
+		updated  string
+		segments []godiff.Segment
+	}{
+		{
+			name:     "replaced words",
+			original: "The quick brown fox jumps",
+			updated:  "The slow brown dog jumps",
+			segments: []godiff.Segment{
+				{Type: godiff.SegmentEqual, Text: "The "},
+				{Type: godiff.SegmentDelete, Text: "quick"},
+				{Type: godiff.SegmentInsert, Text: "slow"},
+				{Type: godiff.SegmentEqual, Text: " brown "},
+				{Type: godiff.SegmentDelete, Text: "fox"},
+				{Type: godiff.SegmentInsert, Text: "dog"},
+				{Type: godiff.SegmentEqual, Text: " jumps"},
+			},
+		},
+		{
+			name:     "punctuation and spaces",
+			original: "Hello, world.",
+			updated:  "Hello,  world!",
+			segments: []godiff.Segment{
+				{Type: godiff.SegmentEqual, Text: "Hello,"},
+				{Type: godiff.SegmentDelete, Text: " "},
+				{Type: godiff.SegmentInsert, Text: "  "},
+				{Type: godiff.SegmentEqual, Text: "world"},
+				{Type: godiff.SegmentDelete, Text: "."},
+				{Type: godiff.SegmentInsert, Text: "!"},
+			},
+		},
+		{
+			// The fewest changes, even if a word of the inserted line is also in the next one
+			name:     "inserted line",
+			original: "package main\n\nfunc main() {}\n",
+			updated:  "package main\n\n// main greets\nfunc main() {}\n",
+			segments: []godiff.Segment{
+				{Type: godiff.SegmentEqual, Text: "package main\n\n"},
+				{Type: godiff.SegmentInsert, Text: "// main greets\n"},
+				{Type: godiff.SegmentEqual, Text: "func main() {}\n"},
+			},
+		},
+		{
+			name:     "multibyte words",
+			original: "Größe über alles",
+			updated:  "Größe unter allem",
+			segments: []godiff.Segment{
+				{Type: godiff.SegmentEqual, Text: "Größe "},
+				{Type: godiff.SegmentDelete, Text: "über"},
+				{Type: godiff.SegmentInsert, Text: "unter"},
+				{Type: godiff.SegmentEqual, Text: " "},
+				{Type: godiff.SegmentDelete, Text: "alles"},
+				{Type: godiff.SegmentInsert, Text: "allem"},
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			segments := godiff.DiffWords(tc.original, tc.updated)
+			assert.Equal(t, tc.segments, segments)
+			assert.Equal(t, tc.original, godiff.OriginalText(segments))
+			assert.Equal(t, tc.updated, godiff.UpdatedText(segments))
+		})
+	}
+}
+
+func TestDiffRunesVeryDifferent(t *testing.T) {
+	// Too many differences for the shortest diff, the texts are still rebuilt from the segments
+	original, updated := string(randomData(12, 8*1024)), string(randomData(13, 8*1024))
+	segments := godiff.DiffRunes(original, updated)
+	assert.Equal(t, original, godiff.OriginalText(segments))
+	assert.Equal(t, updated, godiff.UpdatedText(segments))
+}
+
+func TestCleanupSemantic(t *testing.T) {
+	tt := []struct {
+		name     string
+		segments []godiff.Segment
+		expected []godiff.Segment
+	}{
+		{
+			name: "small equalities merged",
+			segments: []godiff.Segment{
+				{Type: godiff.SegmentDelete, Text: "m"},
+				{Type: godiff.SegmentInsert, Text: "s"},
+				{Type: godiff.SegmentEqual, Text: "o"},
+				{Type: godiff.SegmentDelete, Text: "u"},
+				{Type: godiff.SegmentInsert, Text: "fa"},
+				{Type: godiff.SegmentEqual, Text: "s"},
+				{Type: godiff.SegmentDelete, Text: "e"},
+			},
+			expected: []godiff.Segment{
+				{Type: godiff.SegmentDelete, Text: "mouse"},
+				{Type: godiff.SegmentInsert, Text: "sofas"},
+			},
+		},
+		{
+			name: "equality longer than a change kept",
+			segments: []godiff.Segment{
+				{Type: godiff.SegmentEqual, Text: "The "},
+				{Type: godiff.SegmentDelete, Text: "quick"},
+				{Type: godiff.SegmentInsert, Text: "slow"},
+				{Type: godiff.SegmentEqual, Text: " brown "},
+				{Type: godiff.SegmentDelete, Text: "fox"},
+			},
+			expected: []godiff.Segment{
+				{Type: godiff.SegmentEqual, Text: "The "},
+				{Type: godiff.SegmentDelete, Text: "quick"},
+				{Type: godiff.SegmentInsert, Text: "slow"},
+				{Type: godiff.SegmentEqual, Text: " brown "},
+				{Type: godiff.SegmentDelete, Text: "fox"},
+			},
+		},
+		{
+			name: "lengths counted in runes",
+			segments: []godiff.Segment{
+				{Type: godiff.SegmentDelete, Text: "ab"},
+				{Type: godiff.SegmentEqual, Text: "日本"},
+				{Type: godiff.SegmentInsert, Text: "cd"},
+			},
+			expected: []godiff.Segment{
+				{Type: godiff.SegmentDelete, Text: "ab日本"},
+				{Type: godiff.SegmentInsert, Text: "日本cd"},
+			},
+		},
+		{
+			name: "equalities at the ends kept",
+			segments: []godiff.Segment{
+				{Type: godiff.SegmentEqual, Text: "a"},
+				{Type: godiff.SegmentDelete, Text: "bcd"},
+				{Type: godiff.SegmentEqual, Text: "e"},
+			},
+			expected: []godiff.Segment{
+				{Type: godiff.SegmentEqual, Text: "a"},
+				{Type: godiff.SegmentDelete, Text: "bcd"},
+				{Type: godiff.SegmentEqual, Text: "e"},
+			},
+		},
+		{
+			name: "empty",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			segments := godiff.CleanupSemantic(tc.segments)
+			assert.Equal(t, tc.expected, segments)
+			assert.Equal(t, godiff.OriginalText(tc.segments), godiff.OriginalText(segments))
+			assert.Equal(t, godiff.UpdatedText(tc.segments), godiff.UpdatedText(segments))
+		})
+	}
+}
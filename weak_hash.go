@@ -0,0 +1,177 @@
+package godiff
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/adler32"
+	"math"
+)
+
+// weakHashBits is the size of the weak checksum (Adler-32)
+const weakHashBits = 32
+
+// chunkHasher calculates the hashes of the chunks, as configured: the strong hash, truncated to StrongHashLen,
+// and the weak checksum with WeakHash
+type chunkHasher struct {
+	strong    hash.Hash
+	weak      hash.Hash32 // nil without WeakHash
+	strongLen int
+}
+
+// newChunkHasher provides the hasher of the chunks
+func (c *Config) newChunkHasher() *chunkHasher {
+	h := &chunkHasher{strong: c.newHash(), strongLen: c.StrongHashLen}
+	if c.WeakHash {
+		h.weak = adler32.New()
+	}
+	return h
+}
+
+func (h *chunkHasher) Write(b []byte) (int, error) {
+	if h.weak != nil {
+		h.weak.Write(b)
+	}
+	return h.strong.Write(b)
+}
+
+func (h *chunkHasher) Reset() {
+	if h.weak != nil {
+		h.weak.Reset()
+	}
+	h.strong.Reset()
+}
+
+// chunk provides the chunk of the data written since the last Reset
+func (h *chunkHasher) chunk(offset, length int64) *Chunk {
+	chunk := &Chunk{DataOffset: offset, DataLen: length, Hash: h.strongHash()}
+	if h.weak != nil {
+		chunk.Weak, chunk.HasWeak = h.weak.Sum32(), true
+	}
+	return chunk
+}
+
+// strongHash provides the hex (truncated) strong hash of the data written since the last Reset
+func (h *chunkHasher) strongHash() string {
+	sum := h.strong.Sum(nil)
+	if h.strongLen > 0 && h.strongLen < len(sum) {
+		sum = sum[:h.strongLen]
+	}
+	return hex.EncodeToString(sum)
+}
+
+// sameChunk tells whether 2 chunks have the same data, comparing the cheap weak checksums first
+func sameChunk(a, b *Chunk) bool {
+	return a.Weak == b.Weak && a.Hash == b.Hash
+}
+
+// chunkKey identifies the data of a chunk, to look chunks up by their data
+type chunkKey struct {
+	weak uint32
+	hash string
+}
+
+func keyOf(chunk *Chunk) chunkKey {
+	return chunkKey{weak: chunk.Weak, hash: chunk.Hash}
+}
+
+// SignatureIndex finds the chunks of a signature matching some data, as rsync does: the data's weak checksum is
+// looked up first, and its strong hash is only calculated when some chunks have the same weak checksum and length.
+// The chunks must have been calculated with WeakHash, and the same config.
+type SignatureIndex struct {
+	cfg    *Config
+	chunks map[uint32][]*Chunk
+}
+
+// NewSignatureIndex indexes the chunks by their weak checksum
+func NewSignatureIndex(chunks []*Chunk, cfg *Config) (*SignatureIndex, error) {
+	cfg, err := cfg.resolve()
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.WeakHash {
+		return nil, &ParamError{Name: "WeakHash", Value: cfg.WeakHash, Reason: "the chunks need a weak checksum to be indexed"}
+	}
+
+	x := &SignatureIndex{cfg: cfg, chunks: make(map[uint32][]*Chunk)}
+	for i, chunk := range chunks {
+		if !chunk.HasWeak {
+			return nil, fmt.Errorf("chunk #%d has no weak checksum: %w", i, ErrInvalidParams)
+		}
+		x.chunks[chunk.Weak] = append(x.chunks[chunk.Weak], chunk)
+	}
+	return x, nil
+}
+
+// Find provides the first chunk having the same data, or nil
+func (x *SignatureIndex) Find(data []byte) *Chunk {
+	var candidates []*Chunk
+	for _, chunk := range x.chunks[adler32.Checksum(data)] {
+		if chunk.DataLen == int64(len(data)) {
+			candidates = append(candidates, chunk)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	h := x.cfg.newChunkHasher()
+	h.strong.Write(data)
+	strong := h.strongHash()
+	for _, chunk := range candidates {
+		if chunk.Hash == strong {
+			return chunk
+		}
+	}
+	return nil
+}
+
+// CollisionProbability estimates the probability that any of the n chunks of some data is mistaken for any of the
+// m chunks of other data, when their chunks are calculated with the config. Each of the n*m pairs of different
+// chunks collides when both their weak checksum (if any) and their strong hash (as truncated) are equal, which
+// happens with a probability of 2^-bits, assuming uniformly distributed hashes.
+func CollisionProbability(n, m int64, cfg *Config) (float64, error) {
+	cfg, err := cfg.resolve()
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 || m < 0 {
+		return 0, &ParamError{Name: "n/m", Value: [2]int64{n, m}, Reason: "must not be negative"}
+	}
+
+	bits := 8 * cfg.newHash().Size()
+	if cfg.StrongHashLen > 0 {
+		bits = 8 * cfg.StrongHashLen
+	}
+	if cfg.WeakHash {
+		bits += weakHashBits
+	}
+
+	// 1 - (1 - 2^-bits)^(n*m), without losing the precision of the tiny probabilities
+	return -math.Expm1(float64(n) * float64(m) * math.Log1p(-math.Exp2(-float64(bits)))), nil
+}
+
+// MinStrongHashLen provides the shortest StrongHashLen keeping the CollisionProbability of n and m chunks at most
+// maxProbability, with the config's other settings. It's the whole hash size when even that isn't enough.
+func MinStrongHashLen(n, m int64, maxProbability float64, cfg *Config) (int, error) {
+	if !(maxProbability > 0 && maxProbability < 1) {
+		return 0, &ParamError{Name: "maxProbability", Value: maxProbability, Reason: "must be between 0 and 1"}
+	}
+	cfg, err := cfg.resolve()
+	if err != nil {
+		return 0, err
+	}
+
+	size := cfg.newHash().Size()
+	for length := 1; length < size; length++ {
+		cfg.StrongHashLen = length
+		p, err := CollisionProbability(n, m, cfg)
+		if err != nil {
+			return 0, err
+		}
+		if p <= maxProbability {
+			return length, nil
+		}
+	}
+	return size, nil
+}
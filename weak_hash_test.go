@@ -0,0 +1,187 @@
+package godiff_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/mihailozarinschi/godiff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"hash"
+	"hash/adler32"
+	"math"
+	"testing"
+)
+
+func TestWeakHash(t *testing.T) {
+	original := randomData(5, 64*1024)
+	updated := append(append(append([]byte{}, original[:32*1024]...), "inserted"...), original[32*1024:]...)
+
+	tt := []struct {
+		name string
+		cfg  *godiff.Config
+	}{
+		{
+			name: "gear",
+			cfg:  &godiff.Config{AvgChunkSize: 1024, WeakHash: true, StrongHashLen: 8},
+		},
+		{
+			name: "rabin",
+			cfg:  &godiff.Config{Algorithm: godiff.AlgorithmRabin, MinChunkSize: 16, AvgChunkSize: 512, WeakHash: true, StrongHashLen: 8},
+		},
+		{
+			name: "refined",
+			cfg:  &godiff.Config{AvgChunkSize: 1024, WeakHash: true, StrongHashLen: 8, Refinement: godiff.RefinementBytes},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			chunks, err := godiff.ChunkDataWithConfig(bytes.NewReader(original), tc.cfg)
+			require.NoError(t, err)
+
+			// Each chunk carries the Adler-32 of its data, and the truncated SHA-256
+			for _, chunk := range chunks {
+				data := original[chunk.DataOffset : chunk.DataOffset+chunk.DataLen]
+				sum := sha256.Sum256(data)
+				require.Equal(t, adler32.Checksum(data), chunk.Weak)
+				require.Equal(t, hex.EncodeToString(sum[:8]), chunk.Hash)
+			}
+
+			diffs, err := godiff.CalcDiffsWithConfig(bytes.NewReader(original), bytes.NewReader(updated), tc.cfg)
+			require.NoError(t, err)
+			assert.LessOrEqual(t, len(diffs), 6)
+
+			// The truncated hashes are verified as such
+			var patched bytes.Buffer
+			require.NoError(t, godiff.PatchVerified(bytes.NewReader(original), diffs, &patched, &godiff.PatchVerification{HashFn: sha256.New}))
+			assert.Equal(t, updated, patched.Bytes())
+		})
+	}
+}
+
+func TestSignatureIndex(t *testing.T) {
+	data := randomData(6, 64*1024)
+
+	var strongHashes int
+	cfg := &godiff.Config{
+		HashFn: func() hash.Hash {
+			strongHashes++
+			return sha256.New()
+		},
+		AvgChunkSize: 1024,
+		WeakHash:     true,
+	}
+	chunks, err := godiff.ChunkDataWithConfig(bytes.NewReader(data), cfg)
+	require.NoError(t, err)
+
+	index, err := godiff.NewSignatureIndex(chunks, cfg)
+	require.NoError(t, err)
+
+	// Known data is found, with a single strong hash calculated each time
+	for _, chunk := range chunks {
+		strongHashes = 0
+		found := index.Find(data[chunk.DataOffset : chunk.DataOffset+chunk.DataLen])
+		require.NotNil(t, found)
+		assert.Equal(t, chunk.Hash, found.Hash)
+		assert.Equal(t, 1, strongHashes)
+	}
+
+	// Unknown data is rejected on its weak checksum, without calculating any strong hash
+	strongHashes = 0
+	for offset := int64(1); offset < 1024; offset++ {
+		assert.Nil(t, index.Find(data[offset:offset+chunks[0].DataLen]))
+	}
+	assert.Zero(t, strongHashes)
+
+	// The chunks need a weak checksum
+	_, err = godiff.NewSignatureIndex(chunks, &godiff.Config{AvgChunkSize: 1024})
+	assert.ErrorIs(t, err, godiff.ErrInvalidParams)
+	_, err = godiff.NewSignatureIndex([]*godiff.Chunk{{DataLen: 1, Hash: "a"}}, cfg)
+	assert.ErrorIs(t, err, godiff.ErrInvalidParams)
+}
+
+func TestZeroWeakChecksum(t *testing.T) {
+	// Both Adler-32 sums are 0 mod 65521: 65520 is the sum of the bytes, and the leading zeros complete the other
+	data := append(make([]byte, 63473), bytes.Repeat([]byte{0xff}, 256)...)
+	data = append(data, 0xf0)
+	require.Zero(t, adler32.Checksum(data))
+
+	cfg := &godiff.Config{MinChunkSize: 64 * 1024, AvgChunkSize: 128 * 1024, WeakHash: true}
+	chunks, err := godiff.ChunkDataWithConfig(bytes.NewReader(data), cfg)
+	require.NoError(t, err)
+	require.Len(t, chunks, 1)
+	assert.True(t, chunks[0].HasWeak)
+
+	index, err := godiff.NewSignatureIndex(chunks, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, chunks[0], index.Find(data))
+
+	var buf bytes.Buffer
+	require.NoError(t, godiff.WriteSignature(&buf, chunks))
+	decoded, err := godiff.ReadSignature(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, chunks, decoded)
+}
+
+func TestCollisionProbability(t *testing.T) {
+	tt := []struct {
+		name     string
+		n, m     int64
+		cfg      *godiff.Config
+		expected float64
+	}{
+		{
+			name:     "no chunks",
+			cfg:      &godiff.Config{},
+			expected: 0,
+		},
+		{
+			name:     "32 bits strong hash",
+			n:        1 << 16,
+			m:        1 << 16,
+			cfg:      &godiff.Config{StrongHashLen: 4},
+			expected: 0.632, // 1 - 1/e
+		},
+		{
+			name:     "32 bits strong hash and weak checksum",
+			n:        1 << 16,
+			m:        1 << 16,
+			cfg:      &godiff.Config{StrongHashLen: 4, WeakHash: true},
+			expected: 1.0 / (1 << 32),
+		},
+		{
+			name:     "full SHA-256",
+			n:        1 << 30,
+			m:        1 << 30,
+			cfg:      &godiff.Config{},
+			expected: math.Exp2(-256 + 60),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := godiff.CollisionProbability(tc.n, tc.m, tc.cfg)
+			require.NoError(t, err)
+			if tc.expected == 0 {
+				assert.Zero(t, p)
+			} else {
+				assert.InEpsilon(t, tc.expected, p, 1e-3)
+			}
+		})
+	}
+
+	// 2^40 pairs of chunks, at most 1 in a billion chances (~2^-30) of a collision: 70 bits needed
+	length, err := godiff.MinStrongHashLen(1<<20, 1<<20, 1e-9, &godiff.Config{})
+	require.NoError(t, err)
+	assert.Equal(t, 9, length)
+
+	length, err = godiff.MinStrongHashLen(1<<20, 1<<20, 1e-9, &godiff.Config{WeakHash: true})
+	require.NoError(t, err)
+	assert.Equal(t, 5, length)
+
+	_, err = godiff.MinStrongHashLen(1, 1, 0, &godiff.Config{})
+	assert.ErrorIs(t, err, godiff.ErrInvalidParams)
+	_, err = godiff.CollisionProbability(-1, 1, &godiff.Config{})
+	assert.ErrorIs(t, err, godiff.ErrInvalidParams)
+}